@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/HosanaUFRRJ2014/planets-api/importer"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/scheduler"
+	"github.com/HosanaUFRRJ2014/planets-api/swapi"
+)
+
+
+/*Imports the whole SWAPI planets catalogue, upserting planets by name.
+Only failed SWAPI requests are answered as upstream errors. Anything else stopping the import is internal*/
+func ImportSWAPIPlanets(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	report, err := importer.ImportSWAPIPlanets(request.Context(), swapiClient)
+	var requestError *swapi.RequestError
+	switch {
+	case errors.As(err, &requestError):
+		formatErrorResponse(writer, &model.Error{
+			Code: model.CodeUpstreamUnavailable,
+			Message: "Import stopped before the last SWAPI page",
+			Details: map[string]interface{}{"reason": err.Error(), "report": report},
+			Err: err,
+		})
+		return
+	case err != nil:
+		formatErrorResponse(writer, &model.Error{
+			Code: model.CodeInternal,
+			Message: "Import stopped before the last SWAPI page",
+			Details: map[string]interface{}{"report": report},
+			Err: err,
+		})
+		return
+	}
+
+	formatResponse(&writer, map[string]interface{}{"report": report})
+}
+
+/*Forgets cached SWAPI searches of ?name=, or every cached search when no name is informed*/
+func PurgeSWAPICache(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	cachedClient, isCached := swapiClient.(*swapi.CachedClient)
+	if !isCached {
+		formatErrorResponse(writer, model.NewError(model.CodeNotFound, "SWAPI cache is disabled", nil))
+		return
+	}
+
+	err := cachedClient.Purge(request.Context(), request.URL.Query().Get("name"))
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	formatResponse(&writer, map[string]interface{}{"purged": true})
+}
+
+/*Refreshes SWAPI fields of stored planets. Must be set with UseScheduler before serving*/
+var swapiScheduler *scheduler.Scheduler
+
+func UseScheduler(planetsScheduler *scheduler.Scheduler) {
+	swapiScheduler = planetsScheduler
+}
+
+/*Shows the report of the last sync of every planet with SWAPI*/
+func GetLastSync(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	report, found := swapiScheduler.LastRun()
+	if !found {
+		formatErrorResponse(writer, model.NewError(model.CodeNotFound, "SWAPI sync did not run yet", nil))
+		return
+	}
+
+	formatResponse(&writer, report)
+}
+
+/*Refreshes SWAPI fields of the planet with the informed id right away*/
+func SyncPlanet(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	syncedPlanet, err := swapiScheduler.SyncPlanet(request.Context(), mux.Vars(request)["id"])
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	formatResponse(&writer, syncedPlanet)
+}
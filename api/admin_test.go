@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/HosanaUFRRJ2014/planets-api/swapi"
+)
+
+
+/*pagedSWAPI ... SWAPIClient answering catalogue pages by URL, or err for pages it doesn't have*/
+type pagedSWAPI struct {
+	pages map[string]swapi.SWAPIResponse
+	err error
+}
+
+func (client pagedSWAPI) SearchPlanets(ctx context.Context, planetName string) (swapi.SWAPIResponse, error) {
+	return swapi.SWAPIResponse{}, nil
+}
+
+func (client pagedSWAPI) GetPlanetsPage(ctx context.Context, pageURL string) (swapi.SWAPIResponse, error) {
+	page, found := client.pages[pageURL]
+	if !found {
+		return page, client.err
+	}
+	return page, nil
+}
+
+func TestImportSWAPIPlanets(t *testing.T) {
+	firstPage := swapi.SWAPIResponse{Count: 3, Next: "page2", Planets: TEST_SWAPI_PLANETS[:2]}
+	unavailable := &swapi.RequestError{Kind: swapi.ErrUnavailable, URL: "page2", StatusCode: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name string
+		client pagedSWAPI
+		wantStatus int
+		wantCode string
+		wantCreated float64
+	}{
+		{
+			"every page",
+			pagedSWAPI{pages: map[string]swapi.SWAPIResponse{"": firstPage, "page2": {Count: 3, Planets: TEST_SWAPI_PLANETS[2:]}}},
+			http.StatusOK, "", 3,
+		},
+		{
+			"SWAPI unavailable",
+			pagedSWAPI{pages: map[string]swapi.SWAPIResponse{"": firstPage}, err: unavailable},
+			http.StatusBadGateway, "upstream_unavailable", 2,
+		},
+		{
+			"pages looping",
+			pagedSWAPI{pages: map[string]swapi.SWAPIResponse{"": firstPage, "page2": {Count: 3, Next: "page2"}}},
+			http.StatusInternalServerError, "internal", 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, stop := newTestAPI(t)
+			defer stop()
+			UseSWAPIClient(test.client)
+
+			response, body := send(t, server, "POST", apiRoot + "/admin/import", "")
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d. Body: %s", response.StatusCode, test.wantStatus, body)
+			}
+
+			// Partial reports are still answered on errors
+			var answer struct {
+				Code string `json:"code"`
+				Report map[string]interface{} `json:"report"`
+				Details struct {
+					Report map[string]interface{} `json:"report"`
+				} `json:"details"`
+			}
+			if err := json.Unmarshal(body, &answer); err != nil {
+				t.Fatal(err)
+			}
+			report := answer.Report
+			if test.wantCode != "" {
+				report = answer.Details.Report
+			}
+			if answer.Code != test.wantCode || report["created"] != test.wantCreated {
+				t.Errorf("code = %q, report = %v, want %q and %v created", answer.Code, report, test.wantCode, test.wantCreated)
+			}
+		})
+	}
+}
+
+func TestPurgeSWAPICache(t *testing.T) {
+	tests := []struct {
+		name string
+		// Replaces the cached client of newTestAPI, unless nil
+		client swapi.SWAPIClient
+		path string
+		wantStatus int
+	}{
+		{"searches of a name", nil, apiRoot + "/admin/swapi-cache?name=Tatooine", http.StatusOK},
+		{"every search", nil, apiRoot + "/admin/swapi-cache", http.StatusOK},
+		{"cache disabled", pagedSWAPI{}, apiRoot + "/admin/swapi-cache", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, stop := newTestAPI(t)
+			defer stop()
+			if test.client != nil {
+				UseSWAPIClient(test.client)
+			}
+
+			response, body := send(t, server, "DELETE", test.path, "")
+			if response.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d. Body: %s", response.StatusCode, test.wantStatus, body)
+			}
+		})
+	}
+}
@@ -2,41 +2,28 @@ package api
 
 
 import (
+	"context"
 	"encoding/json"
-	"flag"
+	"fmt"
 	"html/template"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"path/filepath"
 	"time"
 	"strings"
 
 	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
 	"github.com/HosanaUFRRJ2014/planets-api/model"
 	"github.com/HosanaUFRRJ2014/planets-api/planet"
+	"github.com/HosanaUFRRJ2014/planets-api/swapi"
 )
 
-/*Structure of a response from SWAPI planets endpoint */
-type SWAPIResponse struct {
-	Next string `json:"next"`
-	Planets [] SWAPIPlanet `json:"results"`
-}
-
-/*Structure of planet from SWAPI that matters*/
-type SWAPIPlanet struct {
-	Name    string `json:"name"`
-	URL string `json:"url"`
-	Films [] string `json:"films"`
-}
-
-const PLANETS_SWAPI_URL string = "https://swapi.dev/api/planets/"
-
-
 /* API Utils*/
-func getByAttribute(request *http.Request) (string, string, string) {
+func getByAttribute(request *http.Request) (string, string, error) {
 	variables := mux.Vars(request)
-	var errorMessage string = ""
 
 	paramName := "name"
 	paramValue, ok := variables["name"]
@@ -47,255 +34,444 @@ func getByAttribute(request *http.Request) (string, string, string) {
 	}
 
 	if !ok {
-		errorMessage = "Query param is invalid. Valid options: ?id= , ?name= "
+		return paramName, paramValue, model.NewError(
+			model.CodeValidation,
+			"Query param is invalid. Valid options: ?id= , ?name= ",
+			nil,
+		)
 	}
 
-	return paramName, paramValue, errorMessage
+	return paramName, paramValue, nil
 }
 
-func formatResponse(writer *http.ResponseWriter, data ...interface{}) {
+func formatResponse(writer *http.ResponseWriter, data interface{}) {
+	(*writer).Header().Set("Content-Type", "application/json; charset=UTF-8")
 	encoder := json.NewEncoder(*writer)
 	encoder.SetIndent("", "\t")
-
-	if data[0] == nil {
-		//removes nil from response
-		data = data[:len(data)-1] 
-	}
 	encoder.Encode(data)
 }
 
-func formatPlanetResponse(writer *http.ResponseWriter, planet model.Planet) {
-	if planet.IsEmpty() {
-		formatResponse(writer, nil)
-	} else {
-		formatResponse(writer, planet)
-	}
-}
-
-func getSWAPIResponse(url, planetName string) SWAPIResponse {
-
-	searchParam := "?search=" + planetName
-	url = url + searchParam
-	response, err := http.Get(url)
-
-	if err != nil {
-		log.Println(err.Error())
-		log.Println("Error: Could not connect to SWAPI!")
-	}
-
-	responseData, err := ioutil.ReadAll(response.Body)
-    if err != nil {
-        log.Fatal(err.Error())
-	}
-	
-	var responseObject SWAPIResponse
-	json.Unmarshal(responseData, &responseObject)
-
-	return responseObject
-}
-
 func listAPIPaths(router * mux.Router)  {
 	// List all paths
 	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		fields := logging.Fields{"name": route.GetName()}
 		pathTemplate, err := route.GetPathTemplate()
 		if err == nil {
-			log.Println("ROUTE:", pathTemplate)
+			fields["path"] = pathTemplate
 		}
 		pathRegexp, err := route.GetPathRegexp()
 		if err == nil {
-			log.Println("Path regexp:", pathRegexp)
+			fields["pathRegexp"] = pathRegexp
 		}
 		queriesTemplates, err := route.GetQueriesTemplates()
 		if err == nil {
-			log.Println("Queries templates: ", strings.Join(queriesTemplates, ","))
+			fields["queries"] = strings.Join(queriesTemplates, ",")
 		}
 		queriesRegexps, err := route.GetQueriesRegexp()
 		if err == nil {
-			log.Println("Queries regexps:", strings.Join(queriesRegexps, ","))
+			fields["queriesRegexps"] = strings.Join(queriesRegexps, ",")
 		}
 		methods, err := route.GetMethods()
 		if err == nil {
-			log.Println("Methods:", strings.Join(methods, ","))
+			fields["methods"] = strings.Join(methods, ",")
 		}
-		log.Println()
+		logging.Debug(context.Background(), "Route registered", fields)
 		return nil
 	})
 
 	if err != nil {
-		log.Println(err)
+		logging.Warn(context.Background(), "Could not list routes", logging.Fields{"error": err})
 	}
-
-	http.Handle("/", router)
 }
 
 /*API functions*/
 
-func getAppearencesCountFromSWAPI(planetName string) (int, string) {
-	var appearencesCount int = 0
-	var planetURL string = ""
-	
-	responseObject := getSWAPIResponse(PLANETS_SWAPI_URL, planetName)
-
-	swapiPlanets := responseObject.Planets
-
-	if len(swapiPlanets) > 0 {
-		swapiPlanet := swapiPlanets[0]
-		films := swapiPlanet.Films
-		if len(films) > 0 {
-			appearencesCount = len(films)
-		}
-		planetURL = swapiPlanet.URL
-
-	}
+/*Used for every SWAPI lookup. Must be set with UseSWAPIClient before serving*/
+var swapiClient swapi.SWAPIClient
 
-	return appearencesCount, planetURL
+func UseSWAPIClient(client swapi.SWAPIClient) {
+	swapiClient = client
 }
 
 func APIHome(writer http.ResponseWriter, request *http.Request) {
-	homeTemplate, error := template.ParseFiles(
-		"static/home.html",
-		"static/css/style.css",
+	homeTemplate, err := template.ParseFiles(
+		filepath.Join(staticDir, "home.html"),
+		filepath.Join(staticDir, "css", "style.css"),
 	)
-	
-	if error != nil {
-		panic(error)
+
+	if err != nil {
+		formatErrorResponse(writer, fmt.Errorf("could not parse home page: %w", err))
+		return
 	}
 
-	homeTemplate.ExecuteTemplate(writer, "home.html", nil)
+	homeTemplate.ExecuteTemplate(writer, "home.html", map[string]interface{}{
+		"Sections": homeSections(openAPISpec),
+		"SpecURL": apiRoot + "/openapi.json",
+	})
 }
 
-func CreateNewPlanet(writer http.ResponseWriter, request *http.Request) {
+/*Reads, resolves on SWAPI and saves the planet sent in the request body. Errors are already answered when not saved*/
+func createPlanet(writer http.ResponseWriter, request *http.Request) (model.Planet, bool) {
+	var newPlanet model.Planet
 	body, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &newPlanet)
+	}
 	if err != nil {
-		log.Fatal("Could not read body for request")
+		formatErrorResponse(writer, invalidBodyError(err))
+		return newPlanet, false
 	}
 
-	var newPlanet model.Planet
-	var created bool = false
-	var planetUUID string
-	var errorMessage string = ""
-	var response map[string]interface{}
-	json.Unmarshal(body, &newPlanet)
-
-	newPlanet.Name, errorMessage = planet.PrepareString(newPlanet.Name)
-
-	if errorMessage == "" {
-		// Get appearences count
-		appearencesCount, planetSwapiURL := getAppearencesCountFromSWAPI(newPlanet.Name)
-	
+	newPlanet.Name, err = planet.PrepareString(newPlanet.Name)
+	if err == nil {
 		//Updates new planet with swapi information
-		newPlanet.AppearencesCount = appearencesCount
-		newPlanet.PlanetSwapiURL = planetSwapiURL
-	
+		err = planet.ResolveSWAPIFields(request.Context(), swapiClient, &newPlanet)
+	}
+
+	var planetUUID string
+	if err == nil {
 		// Saving Planet
-		created, planetUUID, errorMessage = planet.AddNewPlanet(newPlanet)
+		planetUUID, err = planet.AddNewPlanet(request.Context(), newPlanet)
+	}
+	if err == nil {
+		newPlanet.ID, err = primitive.ObjectIDFromHex(planetUUID)
 	}
 
-	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	if created {
-		response = map[string]interface{}{"created": created, "id": planetUUID}
-		writer.WriteHeader(http.StatusCreated)
-	} else {
-		response = map[string]interface{}{"created": created, "error": errorMessage}
-		writer.WriteHeader(http.StatusBadRequest)
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return newPlanet, false
 	}
 
-	encoder := json.NewEncoder(writer)
-	encoder.SetIndent("", "\t")
-	encoder.Encode([1]map[string]interface{}{response})
+	return newPlanet, true
 }
 
-func ListPlanets(writer http.ResponseWriter, request *http.Request) {
-	planets := planet.GetAllPlanets()
+func CreateNewPlanet(writer http.ResponseWriter, request *http.Request) {
+	newPlanet, created := createPlanet(writer, request)
+	if !created {
+		return
+	}
 
-	encoder := json.NewEncoder(writer)
-	encoder.SetIndent("", "\t")
-	if len(planets) == 0 {
-		empty := []int{}
-		encoder.Encode(empty)
-	} else {
-		encoder.Encode(planets)
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	writer.WriteHeader(http.StatusCreated)
+	formatResponse(&writer, map[string]interface{}{"created": true, "id": newPlanet.ID.Hex()})
+}
+
+/*Creates a planet, answering it along with its Location*/
+func CreatePlanet(writer http.ResponseWriter, request *http.Request) {
+	newPlanet, created := createPlanet(writer, request)
+	if !created {
+		return
 	}
 
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	writer.Header().Set("Location", planetsRoot + "/" + newPlanet.ID.Hex())
+	writer.WriteHeader(http.StatusCreated)
+	formatResponse(&writer, newPlanet)
 }
 
 func GetByParam(writer http.ResponseWriter, request *http.Request) {
-	var errorMessage string = ""
-	var retrievedPlanet model.Planet;
-	paramName, paramValue, errorMessage := getByAttribute(request)
+	var retrievedPlanet model.Planet
+	paramName, paramValue, err := getByAttribute(request)
 
-	if errorMessage == "" {
-		retrievedPlanet, errorMessage = planet.SearchByParam(paramName, paramValue)
+	if err == nil {
+		retrievedPlanet, err = planet.SearchByParam(request.Context(), paramName, paramValue)
+	}
 
-		if errorMessage == "" {
-			formatPlanetResponse(&writer, retrievedPlanet)
-		}
-	} 
-	
-	if len(errorMessage) > 0 {
-		response := map[string]string{"error": errorMessage}
-		formatResponse(&writer, response)
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
 	}
+
+	formatResponse(&writer, retrievedPlanet)
 }
 
 func DeletePlanetByParam(writer http.ResponseWriter, request *http.Request) {
-	var errorMessage string = ""
-	var deleted bool = false
-	var response map[string]interface{}
- 
-	paramName, paramValue, errorMessage := getByAttribute(request)
-
-	if errorMessage == "" {
-		deleted, errorMessage = planet.RemovePlanetByParam(paramName, paramValue)
-	} 
-
-	if deleted {
-		response = map[string]interface{}{"deleted": deleted}
+	paramName, paramValue, err := getByAttribute(request)
+
+	if err == nil {
+		err = planet.RemovePlanetByParam(request.Context(), paramName, paramValue)
+	}
+
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	formatResponse(&writer, map[string]interface{}{"deleted": true})
+}
+
+/*Removes the planet addressed by the {id} or {name} route variable*/
+func DeletePlanet(writer http.ResponseWriter, request *http.Request) {
+	paramName, paramValue, err := getByAttribute(request)
+	if err == nil {
+		err = planet.RemovePlanetByParam(request.Context(), paramName, paramValue)
+	}
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+/*Saves updatedPlanet over currentPlanet. SWAPI fields are only resolved again on renames.
+Sync fields are only set by syncs, so the ones sent by clients are ignored*/
+func savePlanetUpdate(ctx context.Context, writer http.ResponseWriter, currentPlanet, updatedPlanet model.Planet) {
+	var err error
+	updatedPlanet.Name, err = planet.PrepareString(updatedPlanet.Name)
+	updatedPlanet.LastSyncedAt = currentPlanet.LastSyncedAt
+	updatedPlanet.SyncStatus = currentPlanet.SyncStatus
+
+	if err == nil && updatedPlanet.Name != currentPlanet.Name {
+		err = planet.ResolveSWAPIFields(ctx, swapiClient, &updatedPlanet)
 	} else {
-		response = map[string]interface{}{"error": errorMessage, "deleted": deleted}
+		updatedPlanet.AppearencesCount = currentPlanet.AppearencesCount
+		updatedPlanet.PlanetSwapiURL = currentPlanet.PlanetSwapiURL
+		updatedPlanet.SwapiStatus = currentPlanet.SwapiStatus
+		updatedPlanet.SwapiMatchConfidence = currentPlanet.SwapiMatchConfidence
+	}
+
+	if err == nil {
+		updatedPlanet, err = planet.ReplacePlanet(ctx, currentPlanet.ID.Hex(), updatedPlanet)
+	}
+
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
 	}
 
-	formatResponse(&writer, response)
+	formatResponse(&writer, updatedPlanet)
 }
 
-func HandleRequests(host, port string) {
-	var dir string
-	flag.StringVar(&dir, ".", "static/", "")
-    flag.Parse()
-	
+/*Gets the planet addressed by the {id} route variable*/
+func getPlanetFromRoute(writer http.ResponseWriter, request *http.Request) (model.Planet, bool) {
+	currentPlanet, err := planet.SearchByParam(request.Context(), "id", mux.Vars(request)["id"])
+
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return currentPlanet, false
+	}
+
+	return currentPlanet, true
+}
+
+func ReplacePlanet(writer http.ResponseWriter, request *http.Request) {
+	currentPlanet, found := getPlanetFromRoute(writer, request)
+	if !found {
+		return
+	}
+
+	var updatedPlanet model.Planet
+	body, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &updatedPlanet)
+	}
+	if err != nil {
+		formatErrorResponse(writer, invalidBodyError(err))
+		return
+	}
+
+	savePlanetUpdate(request.Context(), writer, currentPlanet, updatedPlanet)
+}
+
+/*Partially updates a planet with a JSON Merge Patch document*/
+func PatchPlanet(writer http.ResponseWriter, request *http.Request) {
+	contentType := request.Header.Get("Content-Type")
+	if contentType != "" &&
+		!strings.HasPrefix(contentType, "application/merge-patch+json") &&
+		!strings.HasPrefix(contentType, "application/json") {
+		formatErrorResponse(writer, model.NewError(
+			CodeUnsupportedMediaType,
+			"Use Content-Type application/merge-patch+json",
+			map[string]interface{}{"contentType": contentType},
+		))
+		return
+	}
+
+	currentPlanet, found := getPlanetFromRoute(writer, request)
+	if !found {
+		return
+	}
+
+	var updatedPlanet model.Planet
+	body, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		var currentDocument []byte
+		currentDocument, err = json.Marshal(currentPlanet)
+		if err == nil {
+			body, err = mergePatch(currentDocument, body)
+		}
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &updatedPlanet)
+	}
+	if err != nil {
+		formatErrorResponse(writer, invalidBodyError(err))
+		return
+	}
+
+	savePlanetUpdate(request.Context(), writer, currentPlanet, updatedPlanet)
+}
+
+/*Path every API route is served under*/
+const apiRoot string = "/planets/api"
+
+/*Path of the planets resource*/
+const planetsRoot string = apiRoot + "/v2/planets"
+
+/*How long each request may take. Its context is cancelled afterwards, aborting storage and SWAPI calls*/
+var requestTimeout time.Duration = 15 * time.Second
+
+/*How long shutdowns wait for requests in flight*/
+var shutdownTimeout time.Duration = 30 * time.Second
+
+/*Directory of the home page, also served under /static/*/
+var staticDir string = "static/"
+
+func UseStaticDir(dir string) {
+	staticDir = dir
+}
+
+func UseTimeouts(request, shutdown time.Duration) {
+	requestTimeout = request
+	shutdownTimeout = shutdown
+}
+
+/*newRouter registers every route of the API, along with the middlewares run once a route is matched*/
+func newRouter() *mux.Router {
 	// Create the router
 	router := mux.NewRouter().StrictSlash(true)
 	
-	apiRoot := "/planets/api"
-	
 	// Serve static Files under http://{HOST}/static/<filename>
-    router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(dir))))
+    router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(staticDir))))
 
 	// Add routers
-	router.HandleFunc("/", APIHome)
-	router.HandleFunc(apiRoot, APIHome)
-	router.HandleFunc(apiRoot + "/planets", ListPlanets).Methods("GET")
-	router.HandleFunc(apiRoot  + "/create", CreateNewPlanet).Methods("POST")
-	router.Path(apiRoot + "/search").Queries("id", "{id}").HandlerFunc(GetByParam).Name("Search").Methods("GET")
-	router.Path(apiRoot +  "/search").Queries("name", "{name}").HandlerFunc(GetByParam).Name("Search").Methods("GET")
-	router.Path(apiRoot + "/delete").Queries("id", "{id}").HandlerFunc(DeletePlanetByParam).Name("Delete").Methods("DELETE")
-	router.Path(apiRoot + "/delete").Queries("name", "{name}").HandlerFunc(DeletePlanetByParam).Name("Delete").Methods("DELETE")
+	router.HandleFunc("/", APIHome).Name("Home").Methods("GET")
+	router.HandleFunc(apiRoot, APIHome).Name("APIHome").Methods("GET")
+	router.HandleFunc(apiRoot + "/openapi.json", GetOpenAPISpec).Name("GetOpenAPISpec").Methods("GET")
+	router.HandleFunc("/healthz", GetHealth).Name("GetHealth").Methods("GET")
+	router.HandleFunc("/readyz", GetReadiness).Name("GetReadiness").Methods("GET")
+	router.HandleFunc("/metrics", GetMetrics).Name("GetMetrics").Methods("GET")
+
+	// Planets resource
+	router.HandleFunc(planetsRoot, ListPlanets).Name("ListPlanets").Methods("GET")
+	router.HandleFunc(planetsRoot, CreatePlanet).Name("CreatePlanet").Methods("POST")
+	router.HandleFunc(planetsRoot + "/bulk", CreatePlanets).Name("CreatePlanets").Methods("POST")
+	router.HandleFunc(planetsRoot + "/bulk-delete", DeletePlanets).Name("DeletePlanets").Methods("POST")
+	router.HandleFunc(planetsRoot + "/export", ExportPlanets).Name("ExportPlanets").Methods("GET")
+	router.HandleFunc(planetsRoot + "/import", ImportPlanets).Name("ImportPlanets").Methods("POST")
+	router.HandleFunc(planetsRoot + "/trash", ListTrash).Name("ListTrash").Methods("GET")
+	router.HandleFunc(planetsRoot + "/trash/{id}/restore", RestorePlanet).Name("RestorePlanet").Methods("POST")
+	router.HandleFunc(planetsRoot + "/by-name/{name}", GetByParam).Name("GetPlanetByName").Methods("GET")
+	router.HandleFunc(planetsRoot + "/by-name/{name}", DeletePlanet).Name("DeletePlanetByName").Methods("DELETE")
+	router.HandleFunc(planetsRoot + "/{id}", GetByParam).Name("GetPlanet").Methods("GET")
+	router.HandleFunc(planetsRoot + "/{id}", ReplacePlanet).Name("ReplacePlanet").Methods("PUT")
+	router.HandleFunc(planetsRoot + "/{id}", PatchPlanet).Name("PatchPlanet").Methods("PATCH")
+	router.HandleFunc(planetsRoot + "/{id}", DeletePlanet).Name("DeletePlanet").Methods("DELETE")
+	router.HandleFunc(planetsRoot + "/{id}/history", GetPlanetHistory).Name("GetPlanetHistory").Methods("GET")
+	// Also served under the v1 root, where history was asked for. Not deprecated, since it's no older than v2
+	router.HandleFunc(apiRoot + "/planets/{id}/history", GetPlanetHistory).Name("GetPlanetHistoryV1").Methods("GET")
+
+	// Deprecated v1 aliases, linking to their planets resource counterparts
+	router.HandleFunc(apiRoot + "/planets", deprecatedAlias(router, "ListPlanets", ListPlanets)).Name("ListPlanetsV1").Methods("GET")
+	router.HandleFunc(apiRoot  + "/create", deprecatedAlias(router, "CreatePlanet", CreateNewPlanet)).Name("CreateNewPlanetV1").Methods("POST")
+	router.Path(apiRoot + "/search").Queries("id", "{id}").HandlerFunc(deprecatedAlias(router, "GetPlanet", GetByParam)).Name("SearchByIDV1").Methods("GET")
+	router.Path(apiRoot +  "/search").Queries("name", "{name}").HandlerFunc(deprecatedAlias(router, "GetPlanetByName", GetByParam)).Name("SearchByNameV1").Methods("GET")
+	router.Path(apiRoot + "/delete").Queries("id", "{id}").HandlerFunc(deprecatedAlias(router, "DeletePlanet", DeletePlanetByParam)).Name("DeleteByIDV1").Methods("DELETE")
+	router.Path(apiRoot + "/delete").Queries("name", "{name}").HandlerFunc(deprecatedAlias(router, "DeletePlanetByName", DeletePlanetByParam)).Name("DeleteByNameV1").Methods("DELETE")
+	router.HandleFunc(apiRoot + "/planets/{id}", deprecatedAlias(router, "ReplacePlanet", ReplacePlanet)).Name("ReplacePlanetV1").Methods("PUT")
+	router.HandleFunc(apiRoot + "/planets/{id}", deprecatedAlias(router, "PatchPlanet", PatchPlanet)).Name("PatchPlanetV1").Methods("PATCH")
+
+	// Admin
+	router.HandleFunc(apiRoot + "/admin/import", ImportSWAPIPlanets).Name("ImportSWAPIPlanets").Methods("POST")
+	router.HandleFunc(apiRoot + "/admin/swapi-cache", PurgeSWAPICache).Name("PurgeSWAPICache").Methods("DELETE")
+	router.HandleFunc(apiRoot + "/admin/sync", GetLastSync).Name("GetLastSync").Methods("GET")
+	router.HandleFunc(apiRoot + "/admin/sync/{id}", SyncPlanet).Name("SyncPlanet").Methods("POST")
+	router.HandleFunc(apiRoot + "/admin/api-keys", CreateAPIKey).Name("CreateAPIKey").Methods("POST")
+	router.HandleFunc(apiRoot + "/admin/api-keys", ListAPIKeys).Name("ListAPIKeys").Methods("GET")
+	router.HandleFunc(apiRoot + "/admin/api-keys/{id}", RevokeAPIKey).Name("RevokeAPIKey").Methods("DELETE")
+	router.HandleFunc(apiRoot + "/admin/users", ListUsers).Name("ListUsers").Methods("GET")
+	router.HandleFunc(apiRoot + "/admin/users/{id}", SaveUser).Name("SaveUser").Methods("PUT")
+	router.HandleFunc(apiRoot + "/admin/users/{id}", RemoveUser).Name("RemoveUser").Methods("DELETE")
+	router.HandleFunc(apiRoot + "/admin/roles", ListRoles).Name("ListRoles").Methods("GET")
+	router.HandleFunc(apiRoot + "/admin/roles/{name}", SaveRole).Name("SaveRole").Methods("PUT")
+	router.HandleFunc(apiRoot + "/admin/access-denials", ListAccessDenials).Name("ListAccessDenials").Methods("GET")
+	router.HandleFunc(apiRoot + "/admin/audit", ListAudit).Name("ListAudit").Methods("GET")
+
+	// Run once the route is matched, to know the permission it needs. Clients are known after authenticate,
+	// and limited before being answered 401 or 403, so credentials can't be guessed at full speed
+	router.Use(authenticate)
+	router.Use(limitRates)
+	router.Use(enforcePolicy)
+
+	return router
+}
+
+/*newHandler builds the router and the spec it serves, wrapped by the middlewares run on every request.
+Fails on routes without a permission, and on limits of unknown routes*/
+func newHandler() (http.Handler, error) {
+	router := newRouter()
 
 	//List all API Paths
 	listAPIPaths(router)
-	
+
+	// Routes missing from the spec are caught by the tests. Here they are only logged
+	openAPISpec = NewOpenAPISpec()
+	if err := checkSpecCoverage(router, openAPISpec); err != nil {
+		logging.Warn(context.Background(), "OpenAPI spec is incomplete", logging.Fields{"error": err})
+	}
+	// Every route must have a permission
+	if err := documentRoutePermissions(router, openAPISpec); err != nil {
+		return nil, err
+	}
+	if err := checkRouteLimits(router); err != nil {
+		return nil, err
+	}
+	documentRateLimits(openAPISpec)
+
+	return observeRequests(router, recoverPanics(limitRequestTime(requestTimeout, router))), nil
+}
+
+/*HandleRequests serves the API until ctx is done, then stops taking requests and waits for the ones in flight.
+Returns nil once every request is answered, or an error if the server could not start or drain in time*/
+func HandleRequests(ctx context.Context, host, port string) error {
+	handler, err := newHandler()
+	if err != nil {
+		return err
+	}
+
 	address := host
 	if len(port) > 0 {
 		address = address + ":" + port
 	}
 	service := &http.Server{
-		Handler:      router,
+		Handler:      handler,
         Addr:         address,
-        // Enforce timeouts for server
-        WriteTimeout: 15 * time.Second,
+        // Enforce timeouts for server. Writes get a little longer than handlers, so timeouts can still be answered
+        WriteTimeout: requestTimeout + time.Second,
         ReadTimeout:  15 * time.Second,
 	}
-	
-	log.Println("Listening at host", host,  ", port", port, "...")
-	log.Fatal(service.ListenAndServe())
+
+	served := make(chan error, 1)
+	go func() {
+		logging.Info(ctx, "Listening", logging.Fields{"host": host, "port": port})
+		served <- service.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	logging.Info(ctx, "Shutting down. Waiting for requests in flight", logging.Fields{"timeout": shutdownTimeout.String()})
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := service.Shutdown(shutdownCtx); err != nil {
+		service.Close()
+		return fmt.Errorf("requests in flight were cut off: %w", err)
+	}
+
+	logging.Info(ctx, "Every request in flight was answered", nil)
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+	"github.com/HosanaUFRRJ2014/planets-api/scheduler"
+	"github.com/HosanaUFRRJ2014/planets-api/swapi"
+)
+
+
+/*Planets known by the fake SWAPI of tests*/
+var TEST_SWAPI_PLANETS = []swapi.SWAPIPlanet{
+	{Name: "Tatooine", URL: "https://swapi.dev/api/planets/1/", Films: []string{"1", "3", "4", "5", "6"}},
+	{Name: "Hoth", URL: "https://swapi.dev/api/planets/4/", Films: []string{"2"}},
+	{Name: "Naboo", URL: "https://swapi.dev/api/planets/8/", Films: []string{"3", "4", "5", "6"}},
+}
+
+/*newFakeSWAPI answers searches from TEST_SWAPI_PLANETS, like SWAPI does: by case insensitive substring*/
+func newFakeSWAPI() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		search := strings.ToLower(request.URL.Query().Get("search"))
+		response := swapi.SWAPIResponse{Planets: []swapi.SWAPIPlanet{}}
+		for _, swapiPlanet := range TEST_SWAPI_PLANETS {
+			if strings.Contains(strings.ToLower(swapiPlanet.Name), search) {
+				response.Planets = append(response.Planets, swapiPlanet)
+			}
+		}
+		response.Count = len(response.Planets)
+
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(response)
+	}))
+}
+
+/*newTestAPI serves the whole API like -storage memory does, with a cached fake SWAPI and neither auth nor rate limits.
+Call the returned function to stop it*/
+func newTestAPI(t *testing.T) (*httptest.Server, func()) {
+	t.Helper()
+	swapiServer := newFakeSWAPI()
+
+	// Wrapped like main does, so storage metrics and the audit log are recorded
+	auditStore := model.NewMemoryAuditStore()
+	planet.UseRepository(model.NewAuditedRepository(model.NewInstrumentedRepository(model.NewMemoryRepository()), auditStore))
+	UseAuditStore(auditStore)
+	swapiClient := swapi.NewCachedClient(swapi.NewHTTPClient(swapiServer.URL + "/", time.Second, 0), 100, time.Hour, time.Hour, nil)
+	UseSWAPIClient(swapiClient)
+	// Never started. Syncs only run when asked to
+	UseScheduler(scheduler.NewScheduler(swapiClient, time.Hour))
+	UseAuth(nil, nil)
+	UseRateLimits(nil, nil, false)
+	UseDailyQuota(nil, 0)
+
+	handler, err := newHandler()
+	if err != nil {
+		swapiServer.Close()
+		t.Fatalf("could not build the API: %v", err)
+	}
+	server := httptest.NewServer(handler)
+
+	return server, func() {
+		server.Close()
+		swapiServer.Close()
+	}
+}
+
+/*send makes a request to server, returning the response with its body already read*/
+func send(t *testing.T, server *httptest.Server, method, path, body string) (*http.Response, []byte) {
+	t.Helper()
+	request, err := http.NewRequest(method, server.URL + path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response, responseBody
+}
+
+func TestPlanetHandlers(t *testing.T) {
+	server, stop := newTestAPI(t)
+	defer stop()
+
+	// Steps run in order, on the same storage. {id} is replaced by the id of the first planet created
+	steps := []struct {
+		name string
+		method string
+		path string
+		body string
+		wantStatus int
+		// Top level fields of the JSON response. Numbers are float64
+		wantFields map[string]interface{}
+		wantHeaders map[string]string
+		// Fields answered the same as on the step before
+		wantKept []string
+	}{
+		{
+			"create", "POST", planetsRoot, `{"name": " tatooine ", "climate": "arid", "terrain": "desert"}`,
+			http.StatusCreated,
+			map[string]interface{}{"name": "Tatooine", "climate": "arid", "appearencesCount": 5.0, "swapiStatus": "resolved"},
+			nil, nil,
+		},
+		{
+			"create with a taken name", "POST", planetsRoot, `{"name": "Tatooine"}`,
+			http.StatusConflict, map[string]interface{}{"code": "conflict"}, nil, nil,
+		},
+		{
+			"create with an invalid body", "POST", planetsRoot, `{"name": `,
+			http.StatusBadRequest, map[string]interface{}{"code": "validation"}, nil, nil,
+		},
+		{
+			"create unknown to SWAPI", "POST", planetsRoot, `{"name": "Kamino", "climate": "temperate"}`,
+			http.StatusCreated, map[string]interface{}{"appearencesCount": 0.0, "swapiStatus": "not_found"}, nil, nil,
+		},
+		{"get by id", "GET", planetsRoot + "/{id}", "", http.StatusOK, map[string]interface{}{"name": "Tatooine"}, nil, nil},
+		{"get by name", "GET", planetsRoot + "/by-name/TATOOINE", "", http.StatusOK, map[string]interface{}{"climate": "arid"}, nil, nil},
+		{"get unknown id", "GET", planetsRoot + "/5eb2f0a0f1b2c3d4e5f60718", "", http.StatusNotFound, map[string]interface{}{"code": "not_found"}, nil, nil},
+		{
+			"patch", "PATCH", planetsRoot + "/{id}", `{"climate": "temperate"}`,
+			http.StatusOK, map[string]interface{}{"name": "Tatooine", "climate": "temperate", "terrain": "desert"}, nil, nil,
+		},
+		{"sync", "POST", apiRoot + "/admin/sync/{id}", "", http.StatusOK, map[string]interface{}{"syncStatus": "unchanged"}, nil, nil},
+		{
+			"replace keeps sync fields", "PUT", planetsRoot + "/{id}",
+			`{"name": "Tatooine", "climate": "temperate", "terrain": "desert", "syncStatus": "updated", "lastSyncedAt": "2000-01-01T00:00:00Z"}`,
+			http.StatusOK, map[string]interface{}{"syncStatus": "unchanged"}, nil, []string{"lastSyncedAt", "syncStatus"},
+		},
+		{"list filtered", "GET", planetsRoot + "?climate=temperate&sort=name", "", http.StatusOK, map[string]interface{}{"total": 2.0}, nil, nil},
+		{"list with an invalid sort", "GET", planetsRoot + "?sort=climate", "", http.StatusBadRequest, map[string]interface{}{"code": "validation"}, nil, nil},
+		{
+			"v1 search", "GET", apiRoot + "/search?name=kamino", "",
+			http.StatusOK, map[string]interface{}{"name": "Kamino"},
+			map[string]string{"Deprecation": "true", "Link": "<" + planetsRoot + "/by-name/kamino>; rel=\"successor-version\""},
+			nil,
+		},
+		{"delete", "DELETE", planetsRoot + "/{id}", "", http.StatusNoContent, nil, nil, nil},
+		{"get deleted", "GET", planetsRoot + "/{id}", "", http.StatusNotFound, nil, nil, nil},
+		{"list trash", "GET", planetsRoot + "/trash", "", http.StatusOK, map[string]interface{}{"total": 1.0}, nil, nil},
+		{"restore", "POST", planetsRoot + "/trash/{id}/restore", "", http.StatusOK, map[string]interface{}{"name": "Tatooine"}, nil, nil},
+		{"get restored", "GET", planetsRoot + "/{id}", "", http.StatusOK, map[string]interface{}{"climate": "temperate"}, nil, nil},
+	}
+
+	id := ""
+	var keptFields map[string]interface{}
+	for _, step := range steps {
+		response, body := send(t, server, step.method, strings.Replace(step.path, "{id}", id, 1), step.body)
+		if response.StatusCode != step.wantStatus {
+			t.Fatalf("%s: status = %d, want %d. Body: %s", step.name, response.StatusCode, step.wantStatus, body)
+		}
+
+		var fields map[string]interface{}
+		if len(step.wantFields) > 0 || len(step.wantKept) > 0 {
+			if err := json.Unmarshal(body, &fields); err != nil {
+				t.Fatalf("%s: response is not a JSON object: %v", step.name, err)
+			}
+		}
+		for name, want := range step.wantFields {
+			if fields[name] != want {
+				t.Errorf("%s: %s = %v, want %v", step.name, name, fields[name], want)
+			}
+		}
+		for _, name := range step.wantKept {
+			if fields[name] == nil || fields[name] != keptFields[name] {
+				t.Errorf("%s: %s = %v, want %v as before", step.name, name, fields[name], keptFields[name])
+			}
+		}
+		keptFields = fields
+		for name, want := range step.wantHeaders {
+			if got := response.Header.Get(name); got != want {
+				t.Errorf("%s: header %s = %q, want %q", step.name, name, got, want)
+			}
+		}
+
+		if id == "" && step.wantStatus == http.StatusCreated {
+			id = fields["id"].(string)
+			if location := response.Header.Get("Location"); location != planetsRoot + "/" + id {
+				t.Errorf("%s: Location = %q, want the planet", step.name, location)
+			}
+		}
+	}
+}
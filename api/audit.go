@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+)
+
+
+/*Where changes to planets are recorded. Must be set with UseAuditStore before serving*/
+var auditStore model.AuditStore
+
+func UseAuditStore(store model.AuditStore) {
+	auditStore = store
+}
+
+/*Envelope of audit listings, newest entries first*/
+type AuditPageResponse struct {
+	Items []model.AuditEntry `json:"items"`
+	Next *string `json:"next"`
+}
+
+/*Reads an RFC 3339 time query param. Missing params return the zero time*/
+func getTimeQueryParam(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	moment, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return moment, model.NewError(
+			model.CodeValidation,
+			"Query param " + name + " must be an RFC 3339 time, like 2020-05-04T10:00:00Z",
+			map[string]interface{}{name: value},
+		)
+	}
+
+	return moment.UTC(), nil
+}
+
+func parseAuditQuery(query url.Values) (model.AuditQuery, error) {
+	var err error
+	auditQuery := model.AuditQuery{
+		PlanetID: query.Get("planetId"),
+		Actor: query.Get("actor"),
+		Action: model.AuditAction(query.Get("action")),
+		Cursor: query.Get("cursor"),
+	}
+
+	if auditQuery.From, err = getTimeQueryParam(query, "from"); err != nil {
+		return auditQuery, err
+	}
+	if auditQuery.To, err = getTimeQueryParam(query, "to"); err != nil {
+		return auditQuery, err
+	}
+	if auditQuery.Limit, err = getIntQueryParam(query, "limit", DEFAULT_PAGE_LIMIT); err != nil {
+		return auditQuery, err
+	}
+	if auditQuery.Limit < 1 || auditQuery.Limit > MAX_PAGE_LIMIT {
+		return auditQuery, model.NewError(
+			model.CodeValidation,
+			"Query param limit must be between 1 and " + strconv.Itoa(MAX_PAGE_LIMIT),
+			map[string]interface{}{"limit": auditQuery.Limit},
+		)
+	}
+
+	return auditQuery, auditQuery.Validate()
+}
+
+/*writeAuditPage answers page, linking to the next one*/
+func writeAuditPage(writer http.ResponseWriter, request *http.Request, page model.AuditPage) {
+	response := AuditPageResponse{Items: page.Entries}
+	if page.NextCursor != "" {
+		response.Next = makePageLink(request, map[string]string{"cursor": page.NextCursor})
+	}
+
+	formatResponse(&writer, response)
+}
+
+/*Lists changes to a planet, newest first. Planets deleted keep their history*/
+func GetPlanetHistory(writer http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)["id"]
+	auditQuery, err := parseAuditQuery(request.URL.Query())
+	var page model.AuditPage
+	if err == nil {
+		auditQuery.PlanetID = id
+		page, err = auditStore.ListAudit(request.Context(), auditQuery)
+	}
+	if err == nil && len(page.Entries) == 0 && auditQuery.Cursor == "" {
+		// No history at all. Planets stored before auditing started still exist
+		_, err = planet.SearchByParam(request.Context(), "id", id)
+	}
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	writeAuditPage(writer, request, page)
+}
+
+/*Lists changes to every planet, newest first, filtered by planet, actor, action and time range*/
+func ListAudit(writer http.ResponseWriter, request *http.Request) {
+	auditQuery, err := parseAuditQuery(request.URL.Query())
+	var page model.AuditPage
+	if err == nil {
+		page, err = auditStore.ListAudit(request.Context(), auditQuery)
+	}
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	writeAuditPage(writer, request, page)
+}
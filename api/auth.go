@@ -0,0 +1,485 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/HosanaUFRRJ2014/planets-api/auth"
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/*Permission of routes anyone can call, authenticated or not*/
+const PUBLIC string = "public"
+
+/*Permission required by each named route. Every named route must be listed, so new routes are never left open by mistake*/
+var ROUTE_PERMISSIONS = map[string]string{
+	"Home": PUBLIC,
+	"APIHome": PUBLIC,
+	"GetOpenAPISpec": PUBLIC,
+	"GetHealth": PUBLIC,
+	"GetReadiness": PUBLIC,
+	"GetMetrics": PUBLIC,
+
+	"ListPlanets": auth.PERMISSION_READ,
+	"GetPlanet": auth.PERMISSION_READ,
+	"GetPlanetByName": auth.PERMISSION_READ,
+	"ListPlanetsV1": auth.PERMISSION_READ,
+	"SearchByIDV1": auth.PERMISSION_READ,
+	"SearchByNameV1": auth.PERMISSION_READ,
+	"ExportPlanets": auth.PERMISSION_EXPORT,
+
+	"CreatePlanet": auth.PERMISSION_CREATE,
+	"CreatePlanets": auth.PERMISSION_CREATE,
+	"CreateNewPlanetV1": auth.PERMISSION_CREATE,
+	"ReplacePlanet": auth.PERMISSION_UPDATE,
+	"PatchPlanet": auth.PERMISSION_UPDATE,
+	"ReplacePlanetV1": auth.PERMISSION_UPDATE,
+	"PatchPlanetV1": auth.PERMISSION_UPDATE,
+	"DeletePlanet": auth.PERMISSION_DELETE,
+	"DeletePlanetByName": auth.PERMISSION_DELETE,
+	"DeletePlanets": auth.PERMISSION_DELETE,
+	"DeleteByIDV1": auth.PERMISSION_DELETE,
+	"DeleteByNameV1": auth.PERMISSION_DELETE,
+	"ListTrash": auth.PERMISSION_DELETE,
+	"RestorePlanet": auth.PERMISSION_DELETE,
+	"ImportPlanets": auth.PERMISSION_IMPORT,
+	"GetPlanetHistory": auth.PERMISSION_AUDIT,
+	"GetPlanetHistoryV1": auth.PERMISSION_AUDIT,
+	"ListAudit": auth.PERMISSION_AUDIT,
+
+	"ImportSWAPIPlanets": auth.PERMISSION_ADMIN,
+	"PurgeSWAPICache": auth.PERMISSION_ADMIN,
+	"GetLastSync": auth.PERMISSION_ADMIN,
+	"SyncPlanet": auth.PERMISSION_ADMIN,
+	"CreateAPIKey": auth.PERMISSION_ADMIN,
+	"ListAPIKeys": auth.PERMISSION_ADMIN,
+	"RevokeAPIKey": auth.PERMISSION_ADMIN,
+	"ListUsers": auth.PERMISSION_ADMIN,
+	"SaveUser": auth.PERMISSION_ADMIN,
+	"RemoveUser": auth.PERMISSION_ADMIN,
+	"ListRoles": auth.PERMISSION_ADMIN,
+	"SaveRole": auth.PERMISSION_ADMIN,
+	"ListAccessDenials": auth.PERMISSION_ADMIN,
+}
+
+/*Finds who sent each request. nil disables authentication and authorization. Must be set with UseAuth before serving*/
+var authenticator auth.Authenticator
+
+/*Decides what each principal may do. Must be set with UseAuth before serving*/
+var authorizer *auth.Authorizer
+
+/*Where API keys are issued and revoked. Must be set with UseAPIKeyStore before serving*/
+var apiKeyStore model.APIKeyStore
+
+/*Where users, roles and access denials are kept. Must be set with UseAccessStore before serving*/
+var accessStore model.AccessStore
+
+func UseAuth(requestAuthenticator auth.Authenticator, requestAuthorizer *auth.Authorizer) {
+	authenticator = requestAuthenticator
+	authorizer = requestAuthorizer
+}
+
+func UseAPIKeyStore(store model.APIKeyStore) {
+	apiKeyStore = store
+}
+
+func UseAccessStore(store model.AccessStore) {
+	accessStore = store
+}
+
+/*Outcome of authenticating a request, carried by its context from authenticate to enforcePolicy*/
+type authentication struct {
+	principal *auth.Principal
+	err error
+}
+
+type authenticationKey struct{}
+
+/*matchedRoute returns the name and permission of the route matched by request. Unmatched routes are public*/
+func matchedRoute(request *http.Request) (string, string) {
+	if current := mux.CurrentRoute(request); current != nil && current.GetName() != "" {
+		return current.GetName(), ROUTE_PERMISSIONS[current.GetName()]
+	}
+
+	return UNMATCHED_ROUTE, PUBLIC
+}
+
+/*authenticate finds who sent requests to routes needing a permission, leaving the answer to enforcePolicy.
+Meant for router.Use, before limitRates, so requests with bad credentials are limited too, by address*/
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if _, permission := matchedRoute(request); authenticator == nil || permission == PUBLIC {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		principal, err := authenticator.Authenticate(request)
+		ctx := context.WithValue(request.Context(), authenticationKey{}, authentication{principal: principal, err: err})
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+/*authenticatedPrincipal returns the principal found by authenticate. nil for anonymous requests and bad credentials*/
+func authenticatedPrincipal(request *http.Request) *auth.Principal {
+	if authenticated, found := request.Context().Value(authenticationKey{}).(authentication); found && authenticated.err == nil {
+		return authenticated.principal
+	}
+
+	return nil
+}
+
+/*enforcePolicy answers 401 to requests without valid credentials, and 403 to principals lacking the permission of the route matched.
+Every 403 is audited. Meant for router.Use, so the route is known, after authenticate. The principal is carried by the request context*/
+func enforcePolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		route, permission := matchedRoute(request)
+		if authenticator == nil || permission == PUBLIC {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		authenticated, found := request.Context().Value(authenticationKey{}).(authentication)
+		if !found {
+			authenticated.principal, authenticated.err = authenticator.Authenticate(request)
+		}
+		principal, err := authenticated.principal, authenticated.err
+		if err != nil {
+			if model.ErrorCodeOf(err) == model.CodeUnauthenticated {
+				challenge(writer)
+			}
+			formatErrorResponse(writer, err)
+			return
+		}
+
+		err = authorizer.Authorize(request.Context(), principal, permission)
+		if principal == nil {
+			// Anonymous requests are told to authenticate, rather than denied
+			if model.ErrorCodeOf(err) == model.CodeForbidden {
+				challenge(writer)
+				err = auth.Unauthenticated("Send an API key on the X-API-Key header, or a bearer token")
+			}
+		} else if recorder, isRecorder := writer.(*statusRecorder); isRecorder {
+			// Logged along with the request
+			recorder.principal = principal
+		}
+		if err != nil {
+			if principal != nil && model.ErrorCodeOf(err) == model.CodeForbidden {
+				auditDenial(request, principal, route, permission, err)
+			}
+			formatErrorResponse(writer, err)
+			return
+		}
+
+		ctx := auth.WithPrincipal(request.Context(), principal)
+		if principal != nil {
+			// Changes to planets are audited as made by the principal
+			ctx = model.WithActor(ctx, model.Actor{ID: principal.ID, UserID: principal.UserID})
+		}
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+/*challenge tells clients of 401 answers how to authenticate*/
+func challenge(writer http.ResponseWriter) {
+	if challenger, isChallenger := authenticator.(auth.Challenger); isChallenger {
+		for _, value := range challenger.Challenges() {
+			writer.Header().Add("WWW-Authenticate", value)
+		}
+	}
+}
+
+/*auditDenial logs, counts and stores a request denied to principal. Failing to store it doesn't change the answer*/
+func auditDenial(request *http.Request, principal *auth.Principal, route, permission string, err error) {
+	ctx := request.Context()
+	denial := model.AccessDenial{
+		At: time.Now().UTC(),
+		RequestID: logging.RequestID(ctx),
+		PrincipalID: principal.ID,
+		UserID: principal.UserID,
+		Method: request.Method,
+		Path: request.URL.Path,
+		Route: route,
+		Permission: permission,
+		Reason: err.Error(),
+	}
+
+	accessDenialsTotal.Inc(route, permission)
+	logging.Warn(ctx, "Access denied", logging.Fields{
+		"principal": denial.PrincipalID,
+		"user": denial.UserID,
+		"route": route,
+		"permission": permission,
+		"reason": denial.Reason,
+	})
+	if storeErr := accessStore.RecordDenial(ctx, denial); storeErr != nil {
+		logging.Error(ctx, "Could not store access denial", logging.Fields{"error": storeErr})
+	}
+}
+
+/*documentRoutePermissions adds the permission of each route of router to its operation on spec, and lists named routes without one.
+Operations served by several routes take the permission of the last one, so they must share it*/
+func documentRoutePermissions(router *mux.Router, spec OpenAPISpec) error {
+	var missing []string
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetName() == "" {
+			return nil
+		}
+		permission, found := ROUTE_PERMISSIONS[route.GetName()]
+		if !found {
+			missing = append(missing, route.GetName())
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		pathTemplate, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			operation, found := spec.Paths[pathTemplate][strings.ToLower(method)]
+			if !found || permission == PUBLIC {
+				continue
+			}
+
+			operation.RequiredPermission = permission
+			// Either one
+			operation.Security = []map[string][]string{{"apiKey": {}}, {"bearer": {}}}
+			for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+				operation.Responses[fmt.Sprint(status)] = OpenAPIResponse{
+					Description: http.StatusText(status),
+					Content: jsonContent(schemaRef("ErrorResponse"), nil),
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error while walking routes: %w", err)
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("routes missing from ROUTE_PERMISSIONS: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+
+/* API keys */
+
+/*Body of API key creations. ExpiresAt wins over ExpiresIn*/
+type apiKeyRequest struct {
+	Name string `json:"name"`
+	// User the key acts for. Optional
+	UserID string `json:"userId"`
+	Scopes []string `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// Go duration, like 720h
+	ExpiresIn string `json:"expiresIn"`
+}
+
+/*Issues an API key. The key is only answered here, since just its hash is stored*/
+func CreateAPIKey(writer http.ResponseWriter, request *http.Request) {
+	var keyRequest apiKeyRequest
+	body, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &keyRequest)
+	}
+	if err != nil {
+		formatErrorResponse(writer, &model.Error{
+			Code: model.CodeValidation,
+			Message: "Request body is not a valid API key request",
+			Details: map[string]interface{}{"reason": err.Error()},
+			Err: err,
+		})
+		return
+	}
+
+	expiresAt := keyRequest.ExpiresAt
+	if expiresAt == nil && keyRequest.ExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(keyRequest.ExpiresIn)
+		if err != nil {
+			formatErrorResponse(writer, model.NewError(
+				model.CodeValidation,
+				"expiresIn must be a duration like 24h or 720h",
+				map[string]interface{}{"expiresIn": keyRequest.ExpiresIn},
+			))
+			return
+		}
+		expiration := time.Now().UTC().Add(expiresIn)
+		expiresAt = &expiration
+	}
+
+	if keyRequest.UserID != "" {
+		if _, err := accessStore.GetUser(request.Context(), keyRequest.UserID); err != nil {
+			formatErrorResponse(writer, err)
+			return
+		}
+	}
+
+	key, apiKey, err := auth.IssueKey(
+		request.Context(), apiKeyStore, keyRequest.Name, keyRequest.UserID, keyRequest.Scopes, expiresAt,
+	)
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	writer.WriteHeader(http.StatusCreated)
+	formatResponse(&writer, map[string]interface{}{"key": key, "apiKey": apiKey})
+}
+
+/*Lists every API key, revoked and expired ones included. Secrets are never listed*/
+func ListAPIKeys(writer http.ResponseWriter, request *http.Request) {
+	keys, err := apiKeyStore.ListKeys(request.Context())
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	formatResponse(&writer, map[string]interface{}{"items": keys})
+}
+
+/*Revokes the API key addressed by the {id} route variable. Revoking twice is not an error*/
+func RevokeAPIKey(writer http.ResponseWriter, request *http.Request) {
+	err := auth.RevokeKey(request.Context(), apiKeyStore, mux.Vars(request)["id"])
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+
+/* Users and roles */
+
+/*Creates or replaces the user addressed by the {id} route variable*/
+func SaveUser(writer http.ResponseWriter, request *http.Request) {
+	var user model.User
+	body, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &user)
+	}
+	if err != nil {
+		formatErrorResponse(writer, &model.Error{
+			Code: model.CodeValidation,
+			Message: "Request body is not a valid user",
+			Details: map[string]interface{}{"reason": err.Error()},
+			Err: err,
+		})
+		return
+	}
+
+	user.ID = mux.Vars(request)["id"]
+	user, err = auth.SaveUser(request.Context(), accessStore, user)
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	formatResponse(&writer, user)
+}
+
+func ListUsers(writer http.ResponseWriter, request *http.Request) {
+	users, err := accessStore.ListUsers(request.Context())
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	formatResponse(&writer, map[string]interface{}{"items": users})
+}
+
+/*Removes the user addressed by the {id} route variable. Its keys stop working*/
+func RemoveUser(writer http.ResponseWriter, request *http.Request) {
+	err := accessStore.RemoveUser(request.Context(), mux.Vars(request)["id"])
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+/*Creates or replaces the role addressed by the {name} route variable*/
+func SaveRole(writer http.ResponseWriter, request *http.Request) {
+	var role model.Role
+	body, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &role)
+	}
+	if err != nil {
+		formatErrorResponse(writer, &model.Error{
+			Code: model.CodeValidation,
+			Message: "Request body is not a valid role",
+			Details: map[string]interface{}{"reason": err.Error()},
+			Err: err,
+		})
+		return
+	}
+
+	role.Name = mux.Vars(request)["name"]
+	role, err = auth.SaveRole(request.Context(), accessStore, role)
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	formatResponse(&writer, role)
+}
+
+func ListRoles(writer http.ResponseWriter, request *http.Request) {
+	roles, err := accessStore.ListRoles(request.Context())
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	formatResponse(&writer, map[string]interface{}{"items": roles})
+}
+
+/*Most access denials answered at once*/
+const MAX_DENIALS_LIMIT int = 1000
+
+/*Lists the latest access denials, optionally of the ?principal= informed*/
+func ListAccessDenials(writer http.ResponseWriter, request *http.Request) {
+	limit := DEFAULT_PAGE_LIMIT
+	if limitParam := request.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 || parsed > MAX_DENIALS_LIMIT {
+			formatErrorResponse(writer, model.NewError(
+				model.CodeValidation,
+				fmt.Sprintf("limit must be a number from 1 to %d", MAX_DENIALS_LIMIT),
+				map[string]interface{}{"limit": limitParam},
+			))
+			return
+		}
+		limit = parsed
+	}
+
+	denials, err := accessStore.ListDenials(request.Context(), request.URL.Query().Get("principal"), limit)
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	formatResponse(&writer, map[string]interface{}{"items": denials})
+}
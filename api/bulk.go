@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+)
+
+
+/*Most items a single bulk request may carry*/
+const MAX_BULK_ITEMS int = 1000
+
+/*Body of bulk deletes. Either ids or names must be informed*/
+type BulkDeleteRequest struct {
+	IDs []string `json:"ids"`
+	Names []string `json:"names"`
+}
+
+/*Answer of bulk requests, with one result per item, in the order they were sent*/
+type BulkResponse struct {
+	Results []planet.BulkResult `json:"results"`
+	// How many items ended up in each status
+	Summary map[planet.BulkStatus]int `json:"summary"`
+}
+
+func newBulkResponse(results []planet.BulkResult) BulkResponse {
+	response := BulkResponse{Results: results, Summary: map[planet.BulkStatus]int{}}
+	for _, result := range results {
+		response.Summary[result.Status]++
+	}
+
+	return response
+}
+
+/*decodePlanets reads a JSON array of planets, or one planet per line (NDJSON)*/
+func decodePlanets(body []byte) ([]model.Planet, error) {
+	var newPlanets []model.Planet
+
+	body = bytes.TrimSpace(body)
+	if bytes.HasPrefix(body, []byte("[")) {
+		err := json.Unmarshal(body, &newPlanets)
+		return newPlanets, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var newPlanet model.Planet
+		err := decoder.Decode(&newPlanet)
+		if err == io.EOF {
+			return newPlanets, nil
+		}
+		if err != nil {
+			return newPlanets, err
+		}
+		newPlanets = append(newPlanets, newPlanet)
+	}
+}
+
+/*checkBatchSize refuses empty batches and batches over MAX_BULK_ITEMS*/
+func checkBatchSize(size int) error {
+	if size == 0 || size > MAX_BULK_ITEMS {
+		return model.NewError(
+			model.CodeValidation,
+			"Send between 1 and " + strconv.Itoa(MAX_BULK_ITEMS) + " items",
+			map[string]interface{}{"items": size},
+		)
+	}
+
+	return nil
+}
+
+/*writeBulkResponse answers results, or err along with results when the batch failed as a whole.
+Causes of internal errors are only logged, like on single planet routes*/
+func writeBulkResponse(writer http.ResponseWriter, results []planet.BulkResult, err error) {
+	if err != nil {
+		cause := model.AsError(err)
+		details := map[string]interface{}{"results": results}
+		if cause.Code != model.CodeInternal {
+			details["reason"] = cause.Message
+		}
+		formatErrorResponse(writer, &model.Error{
+			Code: cause.Code,
+			Message: "Batch failed before every item was processed",
+			Details: details,
+			Err: err,
+		})
+		return
+	}
+
+	formatResponse(&writer, newBulkResponse(results))
+}
+
+/*Creates a batch of planets, sent as a JSON array or as NDJSON*/
+func CreatePlanets(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	body, err := ioutil.ReadAll(request.Body)
+	var newPlanets []model.Planet
+	if err == nil {
+		newPlanets, err = decodePlanets(body)
+	}
+	if err != nil {
+		formatErrorResponse(writer, invalidBodyError(err))
+		return
+	}
+	if err = checkBatchSize(len(newPlanets)); err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	results, err := planet.AddNewPlanets(request.Context(), swapiClient, newPlanets)
+	writeBulkResponse(writer, results, err)
+}
+
+/*Removes a batch of planets by ids or by names*/
+func DeletePlanets(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	var deleteRequest BulkDeleteRequest
+	body, err := ioutil.ReadAll(request.Body)
+	// Only decoding errors are told to clients. Reading errors are internal
+	if err == nil {
+		if decodeErr := json.Unmarshal(body, &deleteRequest); decodeErr != nil {
+			err = &model.Error{
+				Code: model.CodeValidation,
+				Message: "Request body must be like {\"ids\": [...]} or {\"names\": [...]}",
+				Details: map[string]interface{}{"reason": decodeErr.Error()},
+				Err: decodeErr,
+			}
+		}
+	}
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	paramName, values := "id", deleteRequest.IDs
+	if len(deleteRequest.Names) > 0 {
+		paramName, values = "name", deleteRequest.Names
+	}
+	if len(deleteRequest.IDs) > 0 && len(deleteRequest.Names) > 0 {
+		formatErrorResponse(writer, model.NewError(model.CodeValidation, "Inform either ids or names, not both", nil))
+		return
+	}
+	if err = checkBatchSize(len(values)); err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	results, err := planet.RemovePlanets(request.Context(), paramName, values)
+	writeBulkResponse(writer, results, err)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+)
+
+
+func TestBulkHandlers(t *testing.T) {
+	server, stop := newTestAPI(t)
+	defer stop()
+	if response, body := send(t, server, "POST", planetsRoot, `{"name": "Tatooine"}`); response.StatusCode != http.StatusCreated {
+		t.Fatalf("could not create planet: %d %s", response.StatusCode, body)
+	}
+
+	// Steps run in order. {HOTH} is replaced by the id of Hoth, as created by the first step, in upper case
+	steps := []struct {
+		name string
+		path string
+		body string
+		wantStatus int
+		// Status of each item, in the order they were sent
+		wantStatuses []planet.BulkStatus
+	}{
+		{
+			"create, partially", planetsRoot + "/bulk",
+			`[{"name": "Hoth"}, {"name": "tatooine"}, {"name": " "}, {"name": "Naboo"}, {"name": "hoth"}]`,
+			http.StatusOK,
+			[]planet.BulkStatus{planet.BulkCreated, planet.BulkDuplicate, planet.BulkInvalid, planet.BulkCreated, planet.BulkDuplicate},
+		},
+		{
+			"create as NDJSON", planetsRoot + "/bulk", "{\"name\": \"Dagobah\"}\n{\"name\": \"Naboo\"}\n",
+			http.StatusOK, []planet.BulkStatus{planet.BulkCreated, planet.BulkDuplicate},
+		},
+		{"create nothing", planetsRoot + "/bulk", `[]`, http.StatusBadRequest, nil},
+		{
+			"delete by upper case ids", planetsRoot + "/bulk-delete",
+			`{"ids": ["{HOTH}", "{HOTH}", "5EB2F0A0F1B2C3D4E5F60718"]}`,
+			http.StatusOK, []planet.BulkStatus{planet.BulkDeleted, planet.BulkNotFound, planet.BulkNotFound},
+		},
+		{
+			"delete by names", planetsRoot + "/bulk-delete", `{"names": ["naboo", "Hoth"]}`,
+			http.StatusOK, []planet.BulkStatus{planet.BulkDeleted, planet.BulkNotFound},
+		},
+		{"delete by ids and names", planetsRoot + "/bulk-delete", `{"ids": ["{HOTH}"], "names": ["Dagobah"]}`, http.StatusBadRequest, nil},
+	}
+
+	hothID := ""
+	for _, step := range steps {
+		response, body := send(t, server, "POST", step.path, strings.Replace(step.body, "{HOTH}", hothID, -1))
+		if response.StatusCode != step.wantStatus {
+			t.Fatalf("%s: status = %d, want %d. Body: %s", step.name, response.StatusCode, step.wantStatus, body)
+		}
+		if step.wantStatuses == nil {
+			continue
+		}
+
+		var bulkResponse BulkResponse
+		if err := json.Unmarshal(body, &bulkResponse); err != nil {
+			t.Fatalf("%s: response is not a bulk response: %v", step.name, err)
+		}
+		statuses := []planet.BulkStatus{}
+		for index, result := range bulkResponse.Results {
+			if result.Index != index {
+				t.Errorf("%s: result %d has index %d", step.name, index, result.Index)
+			}
+			statuses = append(statuses, result.Status)
+		}
+		if !reflect.DeepEqual(statuses, step.wantStatuses) {
+			t.Errorf("%s: statuses = %v, want %v. Body: %s", step.name, statuses, step.wantStatuses, body)
+		}
+
+		if hothID == "" {
+			hothID = strings.ToUpper(bulkResponse.Results[0].ID)
+		}
+	}
+
+	// Hoth was deleted once, by its upper case id, and Tatooine is left as it was
+	response, body := send(t, server, "GET", planetsRoot + "/trash", "")
+	var trash struct {
+		Total float64 `json:"total"`
+	}
+	if err := json.Unmarshal(body, &trash); err != nil || response.StatusCode != http.StatusOK || trash.Total != 2 {
+		t.Errorf("trash = %d %s, want Hoth and Naboo", response.StatusCode, body)
+	}
+}
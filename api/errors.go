@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/*Errors only raised by the API layer*/
+const CodeUnsupportedMediaType model.ErrorCode = "unsupported_media_type"
+const CodeNotAcceptable model.ErrorCode = "not_acceptable"
+const CodeServiceUnavailable model.ErrorCode = "service_unavailable"
+const CodeRateLimited model.ErrorCode = "rate_limited"
+const CodeQuotaExceeded model.ErrorCode = "quota_exceeded"
+
+/*HTTP status of each error code. Unknown codes are internal errors*/
+var statusByErrorCode = map[model.ErrorCode]int{
+	model.CodeValidation: http.StatusBadRequest,
+	model.CodeNotFound: http.StatusNotFound,
+	model.CodeConflict: http.StatusConflict,
+	model.CodeUpstreamUnavailable: http.StatusBadGateway,
+	model.CodeInternal: http.StatusInternalServerError,
+	model.CodeUnauthenticated: http.StatusUnauthorized,
+	model.CodeForbidden: http.StatusForbidden,
+	CodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	CodeNotAcceptable: http.StatusNotAcceptable,
+	CodeServiceUnavailable: http.StatusServiceUnavailable,
+	CodeRateLimited: http.StatusTooManyRequests,
+	CodeQuotaExceeded: http.StatusTooManyRequests,
+}
+
+/*Body of every error response*/
+type ErrorResponse struct {
+	Code model.ErrorCode `json:"code"`
+	Message string `json:"message"`
+	Details map[string]interface{} `json:"details"`
+}
+
+func getErrorStatus(code model.ErrorCode) int {
+	status, found := statusByErrorCode[code]
+	if !found {
+		return http.StatusInternalServerError
+	}
+
+	return status
+}
+
+/*Sends err as {code, message, details}, with the HTTP status of its code. Errors other than model.Error are hidden as internal errors*/
+func formatErrorResponse(writer http.ResponseWriter, err error) {
+	// Logged along with the request
+	if recorder, isRecorder := writer.(*statusRecorder); isRecorder {
+		recorder.err = err
+	}
+
+	var modelError *model.Error
+	if !errors.As(err, &modelError) {
+		modelError = model.NewError(model.CodeInternal, "Internal error", nil)
+	}
+
+	response := ErrorResponse{
+		Code: modelError.Code,
+		Message: modelError.Message,
+		Details: modelError.Details,
+	}
+	if response.Details == nil {
+		response.Details = map[string]interface{}{}
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	writer.WriteHeader(getErrorStatus(modelError.Code))
+	formatResponse(&writer, response)
+}
+
+/*Error for request bodies that can't be decoded*/
+func invalidBodyError(err error) error {
+	return &model.Error{
+		Code: model.CodeValidation,
+		Message: "Request body is not a valid planet",
+		Details: map[string]interface{}{"reason": err.Error()},
+		Err: err,
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/*HealthCheck ... Fails while a dependency can't serve requests*/
+type HealthCheck func(ctx context.Context) error
+
+/*DependencyStatus ... Outcome of the check of one dependency*/
+type DependencyStatus struct {
+	Status string `json:"status"`
+	LatencyMs int64 `json:"latencyMs"`
+	Error string `json:"error,omitempty"`
+}
+
+/*Checks run by readiness probes, by dependency name. Must be set with UseReadinessChecks before serving*/
+var readinessChecks map[string]HealthCheck
+
+/*How long readiness probes wait for every check*/
+var readinessTimeout time.Duration = 2 * time.Second
+
+func UseReadinessChecks(timeout time.Duration, checks map[string]HealthCheck) {
+	readinessTimeout = timeout
+	readinessChecks = checks
+}
+
+/*runChecks runs every check at once, giving up after readinessTimeout*/
+func runChecks(ctx context.Context) (map[string]DependencyStatus, bool) {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	statuses := map[string]DependencyStatus{}
+	ready := true
+
+	for name, check := range readinessChecks {
+		waitGroup.Add(1)
+		go func(name string, check HealthCheck) {
+			defer waitGroup.Done()
+
+			startedAt := time.Now()
+			err := check(ctx)
+			status := DependencyStatus{Status: "up", LatencyMs: time.Since(startedAt).Milliseconds()}
+			if err != nil {
+				status.Status = "down"
+				status.Error = err.Error()
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			statuses[name] = status
+			ready = ready && err == nil
+		}(name, check)
+	}
+	waitGroup.Wait()
+
+	return statuses, ready
+}
+
+/*Liveness probe. Answers as long as the process is serving requests*/
+func GetHealth(writer http.ResponseWriter, request *http.Request) {
+	formatResponse(&writer, map[string]interface{}{"status": "ok"})
+}
+
+/*Readiness probe. Answers 503 while any dependency is down*/
+func GetReadiness(writer http.ResponseWriter, request *http.Request) {
+	statuses, ready := runChecks(request.Context())
+	if !ready {
+		formatErrorResponse(writer, model.NewError(
+			CodeServiceUnavailable,
+			"Not ready to serve requests",
+			map[string]interface{}{"status": "not_ready", "checks": statuses},
+		))
+		return
+	}
+
+	formatResponse(&writer, map[string]interface{}{"status": "ready", "checks": statuses})
+}
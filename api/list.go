@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+)
+
+
+/*Envelope of planet listings*/
+type PlanetsPageResponse struct {
+	Items []model.Planet `json:"items"`
+	Total int64 `json:"total"`
+	Next *string `json:"next"`
+	Prev *string `json:"prev"`
+}
+
+const DEFAULT_PAGE_LIMIT int = 20
+const MAX_PAGE_LIMIT int = 100
+
+/*Reads a positive integer query param. Missing params return defaultValue*/
+func getIntQueryParam(query url.Values, name string, defaultValue int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, model.NewError(
+			model.CodeValidation,
+			"Query param " + name + " must be a positive integer",
+			map[string]interface{}{name: value},
+		)
+	}
+
+	return number, nil
+}
+
+func parseListOptions(query url.Values) (model.ListOptions, error) {
+	var err error
+	listOptions := model.ListOptions{
+		Climate: query.Get("climate"),
+		Terrain: query.Get("terrain"),
+		Sort: query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+
+	if listOptions.Limit, err = getIntQueryParam(query, "limit", DEFAULT_PAGE_LIMIT); err != nil {
+		return listOptions, err
+	}
+	if listOptions.Limit < 1 || listOptions.Limit > MAX_PAGE_LIMIT {
+		return listOptions, model.NewError(
+			model.CodeValidation,
+			"Query param limit must be between 1 and " + strconv.Itoa(MAX_PAGE_LIMIT),
+			map[string]interface{}{"limit": listOptions.Limit},
+		)
+	}
+	if listOptions.Page, err = getIntQueryParam(query, "page", 1); err != nil {
+		return listOptions, err
+	}
+	if listOptions.Page < 1 {
+		return listOptions, model.NewError(
+			model.CodeValidation,
+			"Query param page must be at least 1",
+			map[string]interface{}{"page": listOptions.Page},
+		)
+	}
+	if listOptions.MinAppearences, err = getIntQueryParam(query, "minAppearences", 0); err != nil {
+		return listOptions, err
+	}
+
+	return listOptions, nil
+}
+
+/*Link to the same listing with some query params replaced*/
+func makePageLink(request *http.Request, replacements map[string]string) *string {
+	query := request.URL.Query()
+	query.Del("cursor")
+	query.Del("page")
+	for name, value := range replacements {
+		query.Set(name, value)
+	}
+
+	link := request.URL.Path + "?" + query.Encode()
+	return &link
+}
+
+/*Lists planets page by page. Pages are walked by cursor unless a page param is informed*/
+func ListPlanets(writer http.ResponseWriter, request *http.Request) {
+	listPlanets(writer, request, false)
+}
+
+/*listPlanets answers a page of live or trashed planets, with the same filters and pagination*/
+func listPlanets(writer http.ResponseWriter, request *http.Request, trashed bool) {
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	query := request.URL.Query()
+
+	listOptions, err := parseListOptions(query)
+	var page model.PlanetPage
+	if err == nil {
+		listOptions.Trashed = trashed
+		page, err = planet.GetAllPlanets(request.Context(), listOptions)
+	}
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	response := PlanetsPageResponse{Items: page.Planets, Total: page.Total}
+	if response.Items == nil {
+		response.Items = []model.Planet{}
+	}
+
+	if query.Get("page") != "" && listOptions.Cursor == "" {
+		if page.NextCursor != "" {
+			response.Next = makePageLink(request, map[string]string{"page": strconv.Itoa(listOptions.Page + 1)})
+		}
+		if listOptions.Page > 1 {
+			response.Prev = makePageLink(request, map[string]string{"page": strconv.Itoa(listOptions.Page - 1)})
+		}
+	} else {
+		if page.NextCursor != "" {
+			response.Next = makePageLink(request, map[string]string{"cursor": page.NextCursor})
+		}
+		if page.PrevCursor != "" {
+			response.Prev = makePageLink(request, map[string]string{"cursor": page.PrevCursor})
+		}
+	}
+
+	formatResponse(&writer, response)
+}
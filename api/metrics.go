@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/metrics"
+)
+
+
+/*Route label of requests matching no route, so unknown paths don't create new series*/
+const UNMATCHED_ROUTE string = "unmatched"
+
+var requestsTotal = metrics.NewCounterVec(
+	"http_requests_total",
+	"HTTP requests answered, by mux route name, method and status code.",
+	"route", "method", "status",
+)
+
+var requestDuration = metrics.NewHistogramVec(
+	"http_request_duration_seconds",
+	"Latency of HTTP requests, by mux route name, method and status code.",
+	nil,
+	"route", "method", "status",
+)
+
+var accessDenialsTotal = metrics.NewCounterVec(
+	"http_access_denials_total",
+	"Requests answered 403, by mux route name and permission required.",
+	"route", "permission",
+)
+
+var rateLimitedTotal = metrics.NewCounterVec(
+	"http_rate_limited_total",
+	"Requests answered 429, by mux route name and reason: rate or quota.",
+	"route", "reason",
+)
+
+/*Metrics of requests, storage and SWAPI, in the Prometheus text format*/
+func GetMetrics(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=UTF-8")
+	if err := metrics.DefaultRegistry.WriteText(writer); err != nil {
+		logging.Warn(request.Context(), "Could not write metrics", logging.Fields{"error": err})
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+
+/*Lines of the Prometheus text format written by the metrics package*/
+var helpLine = regexp.MustCompile(`^# HELP ([a-zA-Z_:][a-zA-Z0-9_:]*) .+$`)
+var typeLine = regexp.MustCompile(`^# TYPE ([a-zA-Z_:][a-zA-Z0-9_:]*) (counter|gauge|histogram)$`)
+var sampleLine = regexp.MustCompile(
+	`^([a-zA-Z_:][a-zA-Z0-9_:]*)` +
+		`(\{[a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*"(,[a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*")*\})?` +
+		` (-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?|NaN|\+Inf|-Inf)$`,
+)
+
+/*parseMetrics checks text is in the Prometheus text format, returning the samples of each metric family by name*/
+func parseMetrics(t *testing.T, text string) map[string][]string {
+	t.Helper()
+	families := map[string][]string{}
+	types := map[string]string{}
+
+	for number, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if match := helpLine.FindStringSubmatch(line); match != nil {
+			continue
+		}
+		if match := typeLine.FindStringSubmatch(line); match != nil {
+			if _, found := types[match[1]]; found {
+				t.Errorf("line %d: %s typed twice", number + 1, match[1])
+			}
+			types[match[1]] = match[2]
+			families[match[1]] = []string{}
+			continue
+		}
+
+		match := sampleLine.FindStringSubmatch(line)
+		if match == nil {
+			t.Errorf("line %d is not in the Prometheus text format: %q", number + 1, line)
+			continue
+		}
+		family := match[1]
+		if _, found := types[family]; !found {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if types[strings.TrimSuffix(family, suffix)] == "histogram" {
+					family = strings.TrimSuffix(family, suffix)
+				}
+			}
+		}
+		if _, found := types[family]; !found {
+			t.Errorf("line %d: sample of %s comes before its TYPE line", number + 1, match[1])
+			continue
+		}
+		families[family] = append(families[family], line)
+	}
+
+	return families
+}
+
+func TestGetMetrics(t *testing.T) {
+	server, stop := newTestAPI(t)
+	defer stop()
+
+	// Stores a planet, looking it up on SWAPI through the cache, and answers a request on a named route
+	if response, body := send(t, server, "POST", planetsRoot, `{"name": "Hoth"}`); response.StatusCode != http.StatusCreated {
+		t.Fatalf("could not create planet: %d %s", response.StatusCode, body)
+	}
+
+	response, body := send(t, server, "GET", "/metrics", "")
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", response.StatusCode, http.StatusOK)
+	}
+	if contentType := response.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", contentType)
+	}
+	families := parseMetrics(t, string(body))
+
+	wantSamples := map[string]string{
+		"http_requests_total": `http_requests_total{route="CreatePlanet",method="POST",status="201"} `,
+		"planets_db_operations_total": `planets_db_operations_total{operation="InsertPlanet",outcome="ok"} `,
+		"swapi_cache_lookups_total": `swapi_cache_lookups_total{`,
+		"planets_stored": `planets_stored 1`,
+	}
+	for family, wantPrefix := range wantSamples {
+		samples, found := families[family]
+		if !found {
+			t.Errorf("%s is missing from the scrape", family)
+			continue
+		}
+
+		matched := false
+		for _, sample := range samples {
+			matched = matched || strings.HasPrefix(sample, wantPrefix)
+		}
+		if !matched {
+			t.Errorf("no sample of %s starts with %q. Samples: %v", family, wantPrefix, samples)
+		}
+	}
+}
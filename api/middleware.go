@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/HosanaUFRRJ2014/planets-api/auth"
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/*Longest X-Request-ID taken from clients. Longer or unprintable ones are replaced*/
+const MAX_REQUEST_ID_LENGTH int = 128
+
+/*statusRecorder ... ResponseWriter remembering the status code answered, and the error behind it*/
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	// Set by formatErrorResponse
+	err error
+	// Set by authenticate
+	principal *auth.Principal
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(body []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	return recorder.ResponseWriter.Write(body)
+}
+
+/*routeName names the route of router matching request*/
+func routeName(router *mux.Router, request *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(request, &match) || match.Route == nil || match.Route.GetName() == "" {
+		return UNMATCHED_ROUTE
+	}
+
+	return match.Route.GetName()
+}
+
+/*requestID takes the X-Request-ID of request, or makes a new one*/
+func requestID(request *http.Request) string {
+	requestID := request.Header.Get("X-Request-ID")
+	valid := requestID != "" && len(requestID) <= MAX_REQUEST_ID_LENGTH
+	for _, character := range requestID {
+		if character <= ' ' || character > '~' {
+			valid = false
+			break
+		}
+	}
+	if valid {
+		return requestID
+	}
+
+	randomBytes := make([]byte, 16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(randomBytes)
+}
+
+/*observeRequests logs and measures every request served by next, by route name of router.
+The request ID is echoed as X-Request-ID and carried by the request context, so storage and SWAPI logs can be correlated.
+Wraps recoverPanics, so panics are counted as the 500 they answer*/
+func observeRequests(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		startedAt := time.Now()
+		route := routeName(router, request)
+
+		id := requestID(request)
+		writer.Header().Set("X-Request-ID", id)
+		request = request.WithContext(logging.WithRequestID(request.Context(), id))
+		recorder := &statusRecorder{ResponseWriter: writer}
+
+		defer func() {
+			latency := time.Since(startedAt)
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			labels := []string{route, request.Method, strconv.Itoa(status)}
+			requestsTotal.Inc(labels...)
+			requestDuration.Observe(latency.Seconds(), labels...)
+
+			level := logging.LevelInfo
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = logging.LevelError
+			case status >= http.StatusBadRequest:
+				level = logging.LevelWarn
+			}
+			fields := logging.Fields{
+				"route": route,
+				"method": request.Method,
+				"path": request.URL.Path,
+				"status": status,
+				"latencyMs": float64(latency.Microseconds()) / 1000,
+			}
+			if recorder.principal != nil {
+				fields["principal"] = recorder.principal.ID
+			}
+			if recorder.err != nil {
+				fields["error"] = recorder.err
+				fields["errorCode"] = model.ErrorCodeOf(recorder.err)
+			}
+			logging.Log(request.Context(), level, "Request served", fields)
+		}()
+
+		next.ServeHTTP(recorder, request)
+	})
+}
+
+
+/*recoverPanics answers 500 when a handler panics, instead of dropping the connection*/
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// Aborted on purpose, so net/http must see it
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			logging.Error(request.Context(), "Panic serving request", logging.Fields{
+				"panic": fmt.Sprint(recovered),
+				"stack": string(debug.Stack()),
+			})
+			formatErrorResponse(writer, model.NewError(model.CodeInternal, "Internal error", nil))
+		}()
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+/*limitRequestTime cancels the context of requests taking longer than timeout. Zero means no limit*/
+func limitRequestTime(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx, cancel := context.WithTimeout(request.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+/*deprecatedAlias serves a legacy route with handler, pointing clients to the route named successorName.
+Route variables of the legacy route fill the successor link*/
+func deprecatedAlias(router *mux.Router, successorName string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Deprecation", "true")
+
+		var pairs []string
+		for name, value := range mux.Vars(request) {
+			pairs = append(pairs, name, value)
+		}
+		if successor := router.Get(successorName); successor != nil {
+			if successorURL, err := successor.URL(pairs...); err == nil {
+				writer.Header().Set("Link", "<" + successorURL.String() + `>; rel="successor-version"`)
+			}
+		}
+
+		handler(writer, request)
+	}
+}
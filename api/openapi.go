@@ -0,0 +1,1083 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/HosanaUFRRJ2014/planets-api/auth"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/* OpenAPI 3 document */
+
+/*Schema ... JSON Schema object of the OpenAPI document*/
+type Schema map[string]interface{}
+
+type OpenAPIInfo struct {
+	Title string `json:"title"`
+	Description string `json:"description"`
+	Version string `json:"version"`
+}
+
+type OpenAPIParameter struct {
+	Name string `json:"name"`
+	// query or path
+	In string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required bool `json:"required"`
+	Schema Schema `json:"schema"`
+}
+
+type OpenAPIMediaType struct {
+	Schema Schema `json:"schema"`
+	Example interface{} `json:"example,omitempty"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool `json:"required"`
+	Content map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string `json:"description"`
+	Content map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	// Name of the mux route, unless several routes serve the operation
+	OperationID string `json:"operationId"`
+	Summary string `json:"summary"`
+	Description string `json:"description,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	// Kept for older clients only
+	Deprecated bool `json:"deprecated,omitempty"`
+	Parameters []OpenAPIParameter `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody `json:"requestBody,omitempty"`
+	Responses map[string]OpenAPIResponse `json:"responses"`
+	// Set from ROUTE_PERMISSIONS. Empty on public operations
+	Security []map[string][]string `json:"security,omitempty"`
+	RequiredPermission string `json:"x-required-permission,omitempty"`
+}
+
+/*OpenAPIPathItem ... Operations of a path, by lower case HTTP method*/
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+type OpenAPIComponents struct {
+	Schemas map[string]Schema `json:"schemas"`
+	SecuritySchemes map[string]Schema `json:"securitySchemes,omitempty"`
+}
+
+/*OpenAPISpec ... OpenAPI 3 document describing every route of the API*/
+type OpenAPISpec struct {
+	OpenAPI string `json:"openapi"`
+	Info OpenAPIInfo `json:"info"`
+	Paths map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents `json:"components"`
+}
+
+/*apiEndpoint ... One operation of the spec, kept in the order shown on the home page*/
+type apiEndpoint struct {
+	Method string
+	Path string
+	Operation *OpenAPIOperation
+}
+
+
+/* Schema helpers */
+
+func schemaRef(name string) Schema {
+	return Schema{"$ref": "#/components/schemas/" + name}
+}
+
+func typeSchema(schemaType string, description string) Schema {
+	schema := Schema{"type": schemaType}
+	if description != "" {
+		schema["description"] = description
+	}
+	return schema
+}
+
+func jsonContent(schema Schema, example interface{}) map[string]OpenAPIMediaType {
+	return map[string]OpenAPIMediaType{
+		"application/json": {Schema: schema, Example: example},
+	}
+}
+
+func queryParam(name, description string, required bool, schema Schema) OpenAPIParameter {
+	return OpenAPIParameter{Name: name, In: "query", Description: description, Required: required, Schema: schema}
+}
+
+func pathParam(name, description string) OpenAPIParameter {
+	return OpenAPIParameter{Name: name, In: "path", Description: description, Required: true, Schema: typeSchema("string", "")}
+}
+
+/*responses builds the responses of an operation. Each status in errorStatuses answers an ErrorResponse*/
+func responses(status int, description string, schema Schema, errorStatuses ...int) map[string]OpenAPIResponse {
+	operationResponses := map[string]OpenAPIResponse{}
+
+	successResponse := OpenAPIResponse{Description: description}
+	if schema != nil {
+		successResponse.Content = jsonContent(schema, nil)
+	}
+	operationResponses[fmt.Sprint(status)] = successResponse
+
+	errorStatuses = append(errorStatuses, http.StatusInternalServerError)
+	for _, errorStatus := range errorStatuses {
+		operationResponses[fmt.Sprint(errorStatus)] = OpenAPIResponse{
+			Description: http.StatusText(errorStatus),
+			Content: jsonContent(schemaRef("ErrorResponse"), nil),
+		}
+	}
+
+	return operationResponses
+}
+
+
+/* Spec */
+
+/*Schemas of every body read or written by the API*/
+func openAPISchemas() map[string]Schema {
+	stringArray := Schema{"type": "array", "items": typeSchema("string", "")}
+	nullableString := func(description string) Schema {
+		schema := typeSchema("string", description)
+		schema["nullable"] = true
+		return schema
+	}
+
+	return map[string]Schema{
+		"Planet": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"id": typeSchema("string", "Hex encoded ObjectID"),
+				"name": typeSchema("string", ""),
+				"climate": typeSchema("string", ""),
+				"terrain": typeSchema("string", ""),
+				"appearencesCount": typeSchema("integer", "How many films the planet appears in, according to SWAPI"),
+				"swapiStatus": {"type": "string", "enum": []string{"resolved", "unresolved", "not_found"}},
+				"swapiMatchConfidence": {"type": "string", "enum": []string{"exact", "normalized", "none"}},
+				"lastSyncedAt": {"type": "string", "format": "date-time"},
+				"syncStatus": {"type": "string", "enum": []string{"unchanged", "updated", "failed"}},
+				"deletedAt": {"type": "string", "format": "date-time", "readOnly": true, "description": "When the planet was moved to the trash. Only informed on trashed planets"},
+				"deletedBy": {"type": "string", "readOnly": true, "description": "Who moved the planet to the trash"},
+			},
+		},
+		"PlanetInput": {
+			"type": "object",
+			"required": []string{"name"},
+			"properties": map[string]Schema{
+				"name": typeSchema("string", ""),
+				"climate": typeSchema("string", ""),
+				"terrain": typeSchema("string", ""),
+			},
+		},
+		"PlanetsPage": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"items": {"type": "array", "items": schemaRef("Planet")},
+				"total": typeSchema("integer", "How many planets match the filters, in all pages"),
+				"next": nullableString("Link to the next page. Null on the last page"),
+				"prev": nullableString("Link to the previous page. Null on the first page"),
+			},
+		},
+		"Created": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"created": typeSchema("boolean", ""),
+				"id": typeSchema("string", ""),
+			},
+		},
+		"Deleted": {
+			"type": "object",
+			"properties": map[string]Schema{"deleted": typeSchema("boolean", "")},
+		},
+		"Purged": {
+			"type": "object",
+			"properties": map[string]Schema{"purged": typeSchema("boolean", "")},
+		},
+		"ImportReport": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"report": {
+					"type": "object",
+					"properties": map[string]Schema{
+						"pages": typeSchema("integer", ""),
+						"created": typeSchema("integer", ""),
+						"updated": typeSchema("integer", ""),
+						"unchanged": typeSchema("integer", ""),
+						"failed": typeSchema("integer", ""),
+						"errors": stringArray,
+					},
+				},
+			},
+		},
+		"SyncReport": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"startedAt": {"type": "string", "format": "date-time"},
+				"finishedAt": {"type": "string", "format": "date-time"},
+				"checked": typeSchema("integer", ""),
+				"updated": typeSchema("integer", ""),
+				"unchanged": typeSchema("integer", ""),
+				"failed": typeSchema("integer", ""),
+				"errors": stringArray,
+			},
+		},
+		"BulkDeleteRequest": {
+			"type": "object",
+			"description": "Either ids or names must be informed",
+			"properties": map[string]Schema{
+				"ids": stringArray,
+				"names": stringArray,
+			},
+		},
+		"BulkResult": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"index": typeSchema("integer", "Position of the item in the request"),
+				"id": typeSchema("string", ""),
+				"name": typeSchema("string", ""),
+				"status": {"type": "string", "enum": []string{"created", "duplicate", "invalid", "deleted", "not_found", "failed"}},
+				"error": schemaRef("ErrorResponse"),
+			},
+		},
+		"BulkResponse": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"results": {"type": "array", "items": schemaRef("BulkResult")},
+				"summary": {
+					"type": "object",
+					"description": "How many items ended up in each status",
+					"additionalProperties": typeSchema("integer", ""),
+				},
+			},
+		},
+		"PlanetsImportReport": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"dryRun": typeSchema("boolean", ""),
+				"mode": {"type": "string", "enum": []string{"skip", "overwrite", "fail"}},
+				"rows": typeSchema("integer", ""),
+				"created": typeSchema("integer", ""),
+				"overwritten": typeSchema("integer", ""),
+				"skipped": typeSchema("integer", ""),
+				"invalid": typeSchema("integer", ""),
+				"failed": typeSchema("integer", ""),
+				"errors": {
+					"type": "array",
+					"items": Schema{
+						"type": "object",
+						"properties": map[string]Schema{
+							"row": typeSchema("integer", "Counted from 1, not counting CSV headers"),
+							"name": typeSchema("string", ""),
+							"error": schemaRef("ErrorResponse"),
+						},
+					},
+				},
+			},
+		},
+		"Health": {
+			"type": "object",
+			"properties": map[string]Schema{"status": {"type": "string", "enum": []string{"ok"}}},
+		},
+		"Readiness": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"status": {"type": "string", "enum": []string{"ready"}},
+				"checks": {
+					"type": "object",
+					"description": "Status of each dependency, by name",
+					"additionalProperties": Schema{
+						"type": "object",
+						"properties": map[string]Schema{
+							"status": {"type": "string", "enum": []string{"up", "down"}},
+							"latencyMs": typeSchema("integer", ""),
+							"error": typeSchema("string", ""),
+						},
+					},
+				},
+			},
+		},
+		"APIKey": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"id": typeSchema("string", "Public part of the key"),
+				"name": typeSchema("string", ""),
+				"userId": typeSchema("string", "User the key acts for. Missing on keys acting by their scopes alone"),
+				"scopes": {"type": "array", "items": Schema{"type": "string", "enum": auth.SCOPES}},
+				"createdAt": {"type": "string", "format": "date-time"},
+				"expiresAt": {"type": "string", "format": "date-time", "description": "Missing on keys that never expire"},
+				"revokedAt": {"type": "string", "format": "date-time"},
+			},
+		},
+		"APIKeyInput": {
+			"type": "object",
+			"required": []string{"name", "scopes"},
+			"properties": map[string]Schema{
+				"name": typeSchema("string", "Who or what the key is for"),
+				"userId": typeSchema("string", "User the key acts for"),
+				"scopes": {
+					"type": "array",
+					"description": "Required for keys without a user. Keys of users can't go beyond them",
+					"items": Schema{"type": "string", "enum": auth.SCOPES},
+				},
+				"expiresAt": {"type": "string", "format": "date-time"},
+				"expiresIn": typeSchema("string", "Duration, like 720h. Ignored when expiresAt is informed"),
+			},
+		},
+		"IssuedAPIKey": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"key": typeSchema("string", "Send it on the X-API-Key header. Only shown once"),
+				"apiKey": schemaRef("APIKey"),
+			},
+		},
+		"APIKeys": {
+			"type": "object",
+			"properties": map[string]Schema{"items": {"type": "array", "items": schemaRef("APIKey")}},
+		},
+		"User": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"id": typeSchema("string", ""),
+				"name": typeSchema("string", ""),
+				"roles": stringArray,
+				"disabled": typeSchema("boolean", "Keys of disabled users are denied everything"),
+				"createdAt": {"type": "string", "format": "date-time"},
+				"updatedAt": {"type": "string", "format": "date-time"},
+			},
+		},
+		"UserInput": {
+			"type": "object",
+			"required": []string{"roles"},
+			"properties": map[string]Schema{
+				"name": typeSchema("string", ""),
+				"roles": stringArray,
+				"disabled": typeSchema("boolean", ""),
+			},
+		},
+		"Users": {
+			"type": "object",
+			"properties": map[string]Schema{"items": {"type": "array", "items": schemaRef("User")}},
+		},
+		"Role": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"name": typeSchema("string", ""),
+				"description": typeSchema("string", ""),
+				"permissions": {"type": "array", "items": Schema{"type": "string", "enum": auth.PERMISSIONS}},
+			},
+		},
+		"Roles": {
+			"type": "object",
+			"properties": map[string]Schema{"items": {"type": "array", "items": schemaRef("Role")}},
+		},
+		"AuditEntry": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"id": typeSchema("string", ""),
+				"at": {"type": "string", "format": "date-time"},
+				"action": {"type": "string", "enum": model.AUDIT_ACTIONS},
+				"planetId": typeSchema("string", ""),
+				"planetName": typeSchema("string", ""),
+				"actor": typeSchema("string", "API key id, jwt:<subject>, bootstrap, anonymous, scheduler or cli"),
+				"userId": typeSchema("string", "User behind the actor, if any"),
+				"requestId": typeSchema("string", "X-Request-ID of the change, if made by a request"),
+				"before": {"allOf": []Schema{schemaRef("Planet")}, "nullable": true, "description": "Null on creates"},
+				"after": {"allOf": []Schema{schemaRef("Planet")}, "nullable": true, "description": "Null on deletes"},
+			},
+		},
+		"AuditPage": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"items": {"type": "array", "items": schemaRef("AuditEntry")},
+				"next": nullableString("Link to the next page. Null on the last page"),
+			},
+		},
+		"AccessDenials": {
+			"type": "object",
+			"properties": map[string]Schema{
+				"items": {
+					"type": "array",
+					"items": Schema{
+						"type": "object",
+						"properties": map[string]Schema{
+							"id": typeSchema("string", ""),
+							"at": {"type": "string", "format": "date-time"},
+							"requestId": typeSchema("string", ""),
+							"principalId": typeSchema("string", "API key id, or bootstrap"),
+							"userId": typeSchema("string", ""),
+							"method": typeSchema("string", ""),
+							"path": typeSchema("string", ""),
+							"route": typeSchema("string", "Name of the route denied"),
+							"permission": typeSchema("string", "Permission the route requires"),
+							"reason": typeSchema("string", ""),
+						},
+					},
+				},
+			},
+		},
+		"ErrorResponse": {
+			"type": "object",
+			"required": []string{"code", "message", "details"},
+			"properties": map[string]Schema{
+				"code": {
+					"type": "string",
+					"enum": []string{
+						"validation", "not_found", "conflict", "upstream_unavailable",
+						"internal", "unauthenticated", "forbidden", string(CodeUnsupportedMediaType),
+						string(CodeNotAcceptable), string(CodeServiceUnavailable), string(CodeRateLimited),
+						string(CodeQuotaExceeded),
+					},
+				},
+				"message": typeSchema("string", ""),
+				"details": typeSchema("object", "Context of the error. Empty when there is none"),
+			},
+		},
+	}
+}
+
+/*apiEndpoints lists every operation of the API*/
+func apiEndpoints() []apiEndpoint {
+	planetInputExample := map[string]interface{}{"name": "Tatooine", "terrain": "desert", "climate": "arid"}
+	idParam := pathParam("id", "Planet id")
+	searchParams := []OpenAPIParameter{
+		queryParam("id", "Planet id. Either id or name must be informed", false, typeSchema("string", "")),
+		queryParam("name", "Planet name. Either id or name must be informed", false, typeSchema("string", "")),
+	}
+	listFilterParams := []OpenAPIParameter{
+		queryParam("sort", "", false, Schema{"type": "string", "enum": []string{"name", "-name", "appearencesCount", "-appearencesCount"}}),
+		queryParam("climate", "Case insensitive substring of the climate", false, typeSchema("string", "")),
+		queryParam("terrain", "Case insensitive substring of the terrain", false, typeSchema("string", "")),
+		queryParam("minAppearences", "Minimum count of film appearences", false, Schema{"type": "integer", "minimum": 0}),
+	}
+	listParams := append([]OpenAPIParameter{
+		queryParam("limit", "Planets per page", false, Schema{"type": "integer", "minimum": 1, "maximum": MAX_PAGE_LIMIT, "default": DEFAULT_PAGE_LIMIT}),
+		queryParam("page", "1-based page number. Ignored when cursor is informed", false, Schema{"type": "integer", "minimum": 1}),
+		queryParam("cursor", "Cursor taken from the next or prev link of a previous page", false, typeSchema("string", "")),
+	}, listFilterParams...)
+	planetBody := &OpenAPIRequestBody{Required: true, Content: jsonContent(schemaRef("PlanetInput"), planetInputExample)}
+	patchBody := &OpenAPIRequestBody{
+		Required: true,
+		Content: map[string]OpenAPIMediaType{
+			"application/merge-patch+json": {
+				Schema: schemaRef("PlanetInput"),
+				Example: map[string]interface{}{"climate": "temperate"},
+			},
+		},
+	}
+	htmlPage := map[string]OpenAPIResponse{
+		"200": {Description: "HTML page", Content: map[string]OpenAPIMediaType{"text/html": {Schema: typeSchema("string", "")}}},
+	}
+
+	auditParams := []OpenAPIParameter{
+		queryParam("from", "Entries from this RFC 3339 time on", false, Schema{"type": "string", "format": "date-time"}),
+		queryParam("to", "Entries before this RFC 3339 time", false, Schema{"type": "string", "format": "date-time"}),
+		queryParam("actor", "Only changes made by this actor", false, typeSchema("string", "")),
+		queryParam("action", "", false, Schema{"type": "string", "enum": model.AUDIT_ACTIONS}),
+		queryParam("limit", "Entries per page", false, Schema{"type": "integer", "minimum": 1, "maximum": MAX_PAGE_LIMIT, "default": DEFAULT_PAGE_LIMIT}),
+		queryParam("cursor", "Cursor taken from the next link of a previous page", false, typeSchema("string", "")),
+	}
+
+	const listDescription = "Sort by name or appearencesCount, prefixed by - for descending order. " +
+		"Follow the next and prev links of the response to walk pages by cursor, forward and back."
+	const historyDescription = "Deleted planets keep their history. Changes are recorded with who made them, " +
+		"and the planet before and after them."
+	const replaceDescription = "SWAPI fields are only looked up again when the planet is renamed."
+	const deleteDescription = "Removed planets go to the trash, where they can be restored from until purged."
+
+	return []apiEndpoint{
+		{"GET", "/", &OpenAPIOperation{
+			OperationID: "Home",
+			Summary: "Show this page",
+			Tags: []string{"docs"},
+			Responses: htmlPage,
+		}},
+		{"GET", apiRoot, &OpenAPIOperation{
+			OperationID: "APIHome",
+			Summary: "Show this page",
+			Tags: []string{"docs"},
+			Responses: htmlPage,
+		}},
+		{"GET", apiRoot + "/openapi.json", &OpenAPIOperation{
+			OperationID: "GetOpenAPISpec",
+			Summary: "Get the OpenAPI 3 document of the API",
+			Tags: []string{"docs"},
+			Responses: map[string]OpenAPIResponse{
+				"200": {Description: "OpenAPI document", Content: jsonContent(typeSchema("object", ""), nil)},
+			},
+		}},
+		{"GET", "/healthz", &OpenAPIOperation{
+			OperationID: "GetHealth",
+			Summary: "Liveness probe. Answers as long as the API is running",
+			Tags: []string{"health"},
+			Responses: responses(http.StatusOK, "Alive", schemaRef("Health")),
+		}},
+		{"GET", "/readyz", &OpenAPIOperation{
+			OperationID: "GetReadiness",
+			Summary: "Readiness probe. Checks the database, and SWAPI if configured",
+			Description: "Answers 503, with the status of each dependency in details, while any of them is down " +
+				"or the unique name index is missing.",
+			Tags: []string{"health"},
+			Responses: responses(http.StatusOK, "Ready", schemaRef("Readiness"), http.StatusServiceUnavailable),
+		}},
+		{"GET", "/metrics", &OpenAPIOperation{
+			OperationID: "GetMetrics",
+			Summary: "Metrics of requests, storage operations and SWAPI lookups, in the Prometheus text format",
+			Description: "Requests are labeled by route name, method and status. Storage operations and SWAPI lookups " +
+				"by operation and outcome, which is ok or an error code. Also counts SWAPI cache hits and misses, " +
+				"and gauges how many planets are stored.",
+			Tags: []string{"health"},
+			Responses: map[string]OpenAPIResponse{
+				"200": {Description: "Prometheus text exposition format, version 0.0.4", Content: map[string]OpenAPIMediaType{
+					"text/plain": {Schema: typeSchema("string", "")},
+				}},
+			},
+		}},
+
+		// Planets resource
+		{"GET", planetsRoot, &OpenAPIOperation{
+			OperationID: "ListPlanets",
+			Summary: "List registered planets, page by page",
+			Description: listDescription,
+			Tags: []string{"planets"},
+			Parameters: listParams,
+			Responses: responses(http.StatusOK, "A page of planets", schemaRef("PlanetsPage"), http.StatusBadRequest),
+		}},
+		{"POST", planetsRoot, &OpenAPIOperation{
+			OperationID: "CreatePlanet",
+			Summary: "Create a planet",
+			Description: "Film appearences are looked up on SWAPI by name. The Location header points to the new planet.",
+			Tags: []string{"planets"},
+			RequestBody: planetBody,
+			Responses: responses(
+				http.StatusCreated, "The created planet", schemaRef("Planet"),
+				http.StatusBadRequest, http.StatusConflict, http.StatusBadGateway,
+			),
+		}},
+		{"POST", planetsRoot + "/bulk", &OpenAPIOperation{
+			OperationID: "CreatePlanets",
+			Summary: "Create a batch of planets",
+			Description: "Send a JSON array of planets, or one planet per line (NDJSON), up to " +
+				strconv.Itoa(MAX_BULK_ITEMS) + " planets. Each planet gets its own result: created, duplicate, invalid or failed.",
+			Tags: []string{"planets"},
+			RequestBody: &OpenAPIRequestBody{
+				Required: true,
+				Content: map[string]OpenAPIMediaType{
+					"application/json": {
+						Schema: Schema{"type": "array", "items": schemaRef("PlanetInput")},
+						Example: []map[string]interface{}{planetInputExample, {"name": "Hoth", "climate": "frozen"}},
+					},
+					"application/x-ndjson": {Schema: typeSchema("string", "One PlanetInput per line")},
+				},
+			},
+			Responses: responses(http.StatusOK, "One result per planet", schemaRef("BulkResponse"), http.StatusBadRequest),
+		}},
+		{"POST", planetsRoot + "/bulk-delete", &OpenAPIOperation{
+			OperationID: "DeletePlanets",
+			Summary: "Remove a batch of planets by ids or by names",
+			Description: deleteDescription + " Each id or name gets its own result: deleted, not_found or invalid.",
+			Tags: []string{"planets"},
+			RequestBody: &OpenAPIRequestBody{
+				Required: true,
+				Content: jsonContent(schemaRef("BulkDeleteRequest"), map[string]interface{}{"names": []string{"Tatooine", "Hoth"}}),
+			},
+			Responses: responses(http.StatusOK, "One result per id or name", schemaRef("BulkResponse"), http.StatusBadRequest),
+		}},
+		{"GET", planetsRoot + "/export", &OpenAPIOperation{
+			OperationID: "ExportPlanets",
+			Summary: "Download every planet as CSV, NDJSON or a JSON array",
+			Description: "The format comes from ?format=csv|ndjson|json, or else from the Accept header. " +
+				"Takes the same filters and sort of the planets listing.",
+			Tags: []string{"planets"},
+			Parameters: append([]OpenAPIParameter{
+				queryParam("format", "", false, Schema{"type": "string", "enum": []string{"csv", "ndjson", "json"}}),
+			}, listFilterParams...),
+			Responses: map[string]OpenAPIResponse{
+				"200": {
+					Description: "Every matching planet",
+					Content: map[string]OpenAPIMediaType{
+						"application/json": {Schema: Schema{"type": "array", "items": schemaRef("Planet")}},
+						"application/x-ndjson": {Schema: typeSchema("string", "One Planet per line")},
+						"text/csv": {Schema: typeSchema("string", "Header followed by one planet per row")},
+					},
+				},
+				"400": {Description: http.StatusText(http.StatusBadRequest), Content: jsonContent(schemaRef("ErrorResponse"), nil)},
+				"406": {Description: http.StatusText(http.StatusNotAcceptable), Content: jsonContent(schemaRef("ErrorResponse"), nil)},
+			},
+		}},
+		{"POST", planetsRoot + "/import", &OpenAPIOperation{
+			OperationID: "ImportPlanets",
+			Summary: "Upload planets as CSV, NDJSON or a JSON array",
+			Description: "Every row is checked before anything is saved. Rows named like stored planets are skipped, " +
+				"overwrite the stored planet, or make the whole import fail, as chosen by mode. Ids are not imported.",
+			Tags: []string{"planets"},
+			Parameters: []OpenAPIParameter{
+				queryParam("mode", "What to do with rows named like stored planets", false, Schema{"type": "string", "enum": []string{"skip", "overwrite", "fail"}, "default": "fail"}),
+				queryParam("dryRun", "Only report what would be imported", false, Schema{"type": "boolean", "default": false}),
+				queryParam("format", "Overrides the Content-Type header", false, Schema{"type": "string", "enum": []string{"csv", "ndjson", "json"}}),
+			},
+			RequestBody: &OpenAPIRequestBody{
+				Required: true,
+				Content: map[string]OpenAPIMediaType{
+					"application/json": {
+						Schema: Schema{"type": "array", "items": schemaRef("PlanetInput")},
+						Example: []map[string]interface{}{planetInputExample},
+					},
+					"application/x-ndjson": {Schema: typeSchema("string", "One PlanetInput per line")},
+					"text/csv": {Schema: typeSchema("string", "Header with a name column, followed by one planet per row")},
+				},
+			},
+			Responses: responses(
+				http.StatusOK, "Import report", schemaRef("PlanetsImportReport"),
+				http.StatusBadRequest, http.StatusConflict, http.StatusUnsupportedMediaType,
+			),
+		}},
+		{"GET", planetsRoot + "/trash", &OpenAPIOperation{
+			OperationID: "ListTrash",
+			Summary: "List removed planets not purged yet, page by page",
+			Description: "Takes the same params of the planets listing.",
+			Tags: []string{"trash"},
+			Parameters: listParams,
+			Responses: responses(http.StatusOK, "A page of trashed planets", schemaRef("PlanetsPage"), http.StatusBadRequest),
+		}},
+		{"POST", planetsRoot + "/trash/{id}/restore", &OpenAPIOperation{
+			OperationID: "RestorePlanet",
+			Summary: "Take a removed planet out of the trash",
+			Description: "Fails when another planet took its name meanwhile. Rename or remove that planet first.",
+			Tags: []string{"trash"},
+			Parameters: []OpenAPIParameter{idParam},
+			Responses: responses(http.StatusOK, "The restored planet", schemaRef("Planet"), http.StatusNotFound, http.StatusConflict),
+		}},
+		{"GET", planetsRoot + "/{id}", &OpenAPIOperation{
+			OperationID: "GetPlanet",
+			Summary: "Get a planet by id",
+			Tags: []string{"planets"},
+			Parameters: []OpenAPIParameter{idParam},
+			Responses: responses(http.StatusOK, "The planet", schemaRef("Planet"), http.StatusNotFound),
+		}},
+		{"GET", planetsRoot + "/by-name/{name}", &OpenAPIOperation{
+			OperationID: "GetPlanetByName",
+			Summary: "Get a planet by name",
+			Tags: []string{"planets"},
+			Parameters: []OpenAPIParameter{pathParam("name", "Planet name")},
+			Responses: responses(http.StatusOK, "The planet", schemaRef("Planet"), http.StatusBadRequest, http.StatusNotFound),
+		}},
+		{"DELETE", planetsRoot + "/by-name/{name}", &OpenAPIOperation{
+			OperationID: "DeletePlanetByName",
+			Summary: "Remove a planet by name",
+			Description: deleteDescription,
+			Tags: []string{"planets"},
+			Parameters: []OpenAPIParameter{pathParam("name", "Planet name")},
+			Responses: responses(http.StatusNoContent, "Planet removed", nil, http.StatusBadRequest, http.StatusNotFound),
+		}},
+		{"PUT", planetsRoot + "/{id}", &OpenAPIOperation{
+			OperationID: "ReplacePlanet",
+			Summary: "Replace a planet",
+			Description: replaceDescription,
+			Tags: []string{"planets"},
+			Parameters: []OpenAPIParameter{idParam},
+			RequestBody: planetBody,
+			Responses: responses(
+				http.StatusOK, "The updated planet", schemaRef("Planet"),
+				http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway,
+			),
+		}},
+		{"PATCH", planetsRoot + "/{id}", &OpenAPIOperation{
+			OperationID: "PatchPlanet",
+			Summary: "Partially update a planet (JSON Merge Patch)",
+			Tags: []string{"planets"},
+			Parameters: []OpenAPIParameter{idParam},
+			RequestBody: patchBody,
+			Responses: responses(
+				http.StatusOK, "The updated planet", schemaRef("Planet"),
+				http.StatusBadRequest, http.StatusNotFound, http.StatusConflict,
+				http.StatusUnsupportedMediaType, http.StatusBadGateway,
+			),
+		}},
+		{"DELETE", planetsRoot + "/{id}", &OpenAPIOperation{
+			OperationID: "DeletePlanet",
+			Summary: "Remove a planet",
+			Description: deleteDescription,
+			Tags: []string{"planets"},
+			Parameters: []OpenAPIParameter{idParam},
+			Responses: responses(http.StatusNoContent, "Planet removed", nil, http.StatusNotFound),
+		}},
+		{"GET", planetsRoot + "/{id}/history", &OpenAPIOperation{
+			OperationID: "GetPlanetHistory",
+			Summary: "List changes to a planet, newest first",
+			Description: historyDescription,
+			Tags: []string{"planets"},
+			Parameters: append([]OpenAPIParameter{idParam}, auditParams...),
+			Responses: responses(http.StatusOK, "A page of changes", schemaRef("AuditPage"), http.StatusBadRequest, http.StatusNotFound),
+		}},
+		{"GET", apiRoot + "/planets/{id}/history", &OpenAPIOperation{
+			OperationID: "GetPlanetHistoryV1",
+			Summary: "List changes to a planet, newest first",
+			Description: historyDescription + " Same as GetPlanetHistory.",
+			Tags: []string{"planets"},
+			Parameters: append([]OpenAPIParameter{idParam}, auditParams...),
+			Responses: responses(http.StatusOK, "A page of changes", schemaRef("AuditPage"), http.StatusBadRequest, http.StatusNotFound),
+		}},
+
+		// Deprecated v1 aliases
+		{"GET", apiRoot + "/planets", &OpenAPIOperation{
+			OperationID: "ListPlanetsV1",
+			Summary: "List registered planets, page by page",
+			Description: listDescription,
+			Tags: []string{"planets v1"},
+			Deprecated: true,
+			Parameters: listParams,
+			Responses: responses(http.StatusOK, "A page of planets", schemaRef("PlanetsPage"), http.StatusBadRequest),
+		}},
+		{"POST", apiRoot + "/create", &OpenAPIOperation{
+			OperationID: "CreateNewPlanetV1",
+			Summary: "Create a planet",
+			Description: "Film appearences are looked up on SWAPI by name.",
+			Tags: []string{"planets v1"},
+			Deprecated: true,
+			RequestBody: planetBody,
+			Responses: responses(
+				http.StatusCreated, "Planet created", schemaRef("Created"),
+				http.StatusBadRequest, http.StatusConflict, http.StatusBadGateway,
+			),
+		}},
+		{"GET", apiRoot + "/search", &OpenAPIOperation{
+			// Served by the SearchByIDV1 and SearchByNameV1 routes
+			OperationID: "SearchV1",
+			Summary: "Search a planet by id or by name",
+			Tags: []string{"planets v1"},
+			Deprecated: true,
+			Parameters: searchParams,
+			Responses: responses(http.StatusOK, "The planet", schemaRef("Planet"), http.StatusBadRequest, http.StatusNotFound),
+		}},
+		{"DELETE", apiRoot + "/delete", &OpenAPIOperation{
+			// Served by the DeleteByIDV1 and DeleteByNameV1 routes
+			OperationID: "DeleteV1",
+			Summary: "Remove a planet by id or by name",
+			Description: deleteDescription,
+			Tags: []string{"planets v1"},
+			Deprecated: true,
+			Parameters: searchParams,
+			Responses: responses(http.StatusOK, "Planet removed", schemaRef("Deleted"), http.StatusBadRequest, http.StatusNotFound),
+		}},
+		{"PUT", apiRoot + "/planets/{id}", &OpenAPIOperation{
+			OperationID: "ReplacePlanetV1",
+			Summary: "Replace a planet",
+			Description: replaceDescription,
+			Tags: []string{"planets v1"},
+			Deprecated: true,
+			Parameters: []OpenAPIParameter{idParam},
+			RequestBody: planetBody,
+			Responses: responses(
+				http.StatusOK, "The updated planet", schemaRef("Planet"),
+				http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway,
+			),
+		}},
+		{"PATCH", apiRoot + "/planets/{id}", &OpenAPIOperation{
+			OperationID: "PatchPlanetV1",
+			Summary: "Partially update a planet (JSON Merge Patch)",
+			Tags: []string{"planets v1"},
+			Deprecated: true,
+			Parameters: []OpenAPIParameter{idParam},
+			RequestBody: patchBody,
+			Responses: responses(
+				http.StatusOK, "The updated planet", schemaRef("Planet"),
+				http.StatusBadRequest, http.StatusNotFound, http.StatusConflict,
+				http.StatusUnsupportedMediaType, http.StatusBadGateway,
+			),
+		}},
+		{"POST", apiRoot + "/admin/import", &OpenAPIOperation{
+			OperationID: "ImportSWAPIPlanets",
+			Summary: "Import every SWAPI planet, creating or updating planets by name",
+			Tags: []string{"admin"},
+			Responses: responses(http.StatusOK, "Import report", schemaRef("ImportReport"), http.StatusBadGateway),
+		}},
+		{"DELETE", apiRoot + "/admin/swapi-cache", &OpenAPIOperation{
+			OperationID: "PurgeSWAPICache",
+			Summary: "Purge cached SWAPI searches of a name, or of every name when no name is informed",
+			Tags: []string{"admin"},
+			Parameters: []OpenAPIParameter{
+				queryParam("name", "Planet name whose searches are purged", false, typeSchema("string", "")),
+			},
+			Responses: responses(http.StatusOK, "Cache purged", schemaRef("Purged"), http.StatusNotFound),
+		}},
+		{"GET", apiRoot + "/admin/sync", &OpenAPIOperation{
+			OperationID: "GetLastSync",
+			Summary: "Show the report of the last refresh of SWAPI fields",
+			Tags: []string{"admin"},
+			Responses: responses(http.StatusOK, "Report of the last sync", schemaRef("SyncReport"), http.StatusNotFound),
+		}},
+		{"POST", apiRoot + "/admin/sync/{id}", &OpenAPIOperation{
+			OperationID: "SyncPlanet",
+			Summary: "Refresh SWAPI fields of a planet right away",
+			Tags: []string{"admin"},
+			Parameters: []OpenAPIParameter{idParam},
+			Responses: responses(
+				http.StatusOK, "The synced planet", schemaRef("Planet"),
+				http.StatusNotFound, http.StatusBadGateway,
+			),
+		}},
+		{"POST", apiRoot + "/admin/api-keys", &OpenAPIOperation{
+			OperationID: "CreateAPIKey",
+			Summary: "Issue an API key",
+			Description: "Keys of users act by the roles of their user, never beyond their scopes. " +
+				"Keys without a user act as the role of their scope: planets:read as viewer, " +
+				"planets:write as editor and planets:admin as admin. " +
+				"The key is only answered here, since just its hash is stored.",
+			Tags: []string{"admin"},
+			RequestBody: &OpenAPIRequestBody{
+				Required: true,
+				Content: jsonContent(schemaRef("APIKeyInput"), map[string]interface{}{
+					"name": "ci", "scopes": []string{auth.SCOPE_READ}, "expiresIn": "720h",
+				}),
+			},
+			Responses: responses(http.StatusCreated, "The issued key", schemaRef("IssuedAPIKey"), http.StatusBadRequest, http.StatusNotFound),
+		}},
+		{"GET", apiRoot + "/admin/api-keys", &OpenAPIOperation{
+			OperationID: "ListAPIKeys",
+			Summary: "List API keys, revoked and expired ones included",
+			Tags: []string{"admin"},
+			Responses: responses(http.StatusOK, "Every API key", schemaRef("APIKeys")),
+		}},
+		{"DELETE", apiRoot + "/admin/api-keys/{id}", &OpenAPIOperation{
+			OperationID: "RevokeAPIKey",
+			Summary: "Revoke an API key right away",
+			Tags: []string{"admin"},
+			Parameters: []OpenAPIParameter{pathParam("id", "API key id, the part after pk_ and before the next _")},
+			Responses: responses(http.StatusNoContent, "API key revoked", nil, http.StatusNotFound),
+		}},
+		{"GET", apiRoot + "/admin/users", &OpenAPIOperation{
+			OperationID: "ListUsers",
+			Summary: "List users and their roles",
+			Tags: []string{"admin"},
+			Responses: responses(http.StatusOK, "Every user", schemaRef("Users")),
+		}},
+		{"PUT", apiRoot + "/admin/users/{id}", &OpenAPIOperation{
+			OperationID: "SaveUser",
+			Summary: "Create or replace a user",
+			Description: "Ids have lower case letters, digits, dots, dashes or underscores. Every role must exist.",
+			Tags: []string{"admin"},
+			Parameters: []OpenAPIParameter{pathParam("id", "User id")},
+			RequestBody: &OpenAPIRequestBody{
+				Required: true,
+				Content: jsonContent(schemaRef("UserInput"), map[string]interface{}{"name": "Leia Organa", "roles": []string{auth.ROLE_EDITOR}}),
+			},
+			Responses: responses(http.StatusOK, "The saved user", schemaRef("User"), http.StatusBadRequest),
+		}},
+		{"DELETE", apiRoot + "/admin/users/{id}", &OpenAPIOperation{
+			OperationID: "RemoveUser",
+			Summary: "Remove a user. Its keys are denied everything from then on",
+			Tags: []string{"admin"},
+			Parameters: []OpenAPIParameter{pathParam("id", "User id")},
+			Responses: responses(http.StatusNoContent, "User removed", nil, http.StatusNotFound),
+		}},
+		{"GET", apiRoot + "/admin/roles", &OpenAPIOperation{
+			OperationID: "ListRoles",
+			Summary: "List roles and their permissions",
+			Tags: []string{"admin"},
+			Responses: responses(http.StatusOK, "Every role", schemaRef("Roles")),
+		}},
+		{"PUT", apiRoot + "/admin/roles/{name}", &OpenAPIOperation{
+			OperationID: "SaveRole",
+			Summary: "Create or replace a role",
+			Description: "The admin role can't be changed. * grants every permission.",
+			Tags: []string{"admin"},
+			Parameters: []OpenAPIParameter{pathParam("name", "Role name")},
+			RequestBody: &OpenAPIRequestBody{
+				Required: true,
+				Content: jsonContent(schemaRef("Role"), map[string]interface{}{
+					"description": "Reads and exports planets",
+					"permissions": []string{auth.PERMISSION_READ, auth.PERMISSION_EXPORT},
+				}),
+			},
+			Responses: responses(http.StatusOK, "The saved role", schemaRef("Role"), http.StatusBadRequest),
+		}},
+		{"GET", apiRoot + "/admin/access-denials", &OpenAPIOperation{
+			OperationID: "ListAccessDenials",
+			Summary: "List the latest requests denied for lack of permission",
+			Tags: []string{"admin"},
+			Parameters: []OpenAPIParameter{
+				queryParam("principal", "Only denials of this API key id", false, typeSchema("string", "")),
+				queryParam("limit", "", false, Schema{"type": "integer", "minimum": 1, "maximum": MAX_DENIALS_LIMIT, "default": DEFAULT_PAGE_LIMIT}),
+			},
+			Responses: responses(http.StatusOK, "Newest denials first", schemaRef("AccessDenials"), http.StatusBadRequest),
+		}},
+		{"GET", apiRoot + "/admin/audit", &OpenAPIOperation{
+			OperationID: "ListAudit",
+			Summary: "List changes to every planet, newest first",
+			Description: "Every create, update and delete of planets, made through the API, the command line or SWAPI syncs.",
+			Tags: []string{"admin"},
+			Parameters: append([]OpenAPIParameter{
+				queryParam("planetId", "Only changes to this planet", false, typeSchema("string", "")),
+			}, auditParams...),
+			Responses: responses(http.StatusOK, "A page of changes", schemaRef("AuditPage"), http.StatusBadRequest),
+		}},
+	}
+}
+
+/*NewOpenAPISpec builds the OpenAPI document of every route served by HandleRequests*/
+func NewOpenAPISpec() OpenAPISpec {
+	spec := OpenAPISpec{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title: "Star Wars Planets API",
+			Description: "Register planets, enriched with film appearences from SWAPI",
+			Version: "1.0.0",
+		},
+		Paths: map[string]OpenAPIPathItem{},
+		Components: OpenAPIComponents{
+			Schemas: openAPISchemas(),
+			SecuritySchemes: map[string]Schema{
+				"apiKey": {"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": {
+					"type": "http",
+					"scheme": "bearer",
+					"bearerFormat": "JWT",
+					"description": "RS256 or ES256 tokens of the identity provider. Only taken when the API is configured with a JWKS",
+				},
+			},
+		},
+	}
+
+	for _, endpoint := range apiEndpoints() {
+		pathItem, found := spec.Paths[endpoint.Path]
+		if !found {
+			pathItem = OpenAPIPathItem{}
+			spec.Paths[endpoint.Path] = pathItem
+		}
+		pathItem[strings.ToLower(endpoint.Method)] = endpoint.Operation
+	}
+
+	return spec
+}
+
+/*checkSpecCoverage lists every method and path handled by router but missing from spec.
+Routes without methods, like static files, are not part of the API*/
+func checkSpecCoverage(router *mux.Router, spec OpenAPISpec) error {
+	var missing []string
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		pathTemplate, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+
+		for _, method := range methods {
+			if _, found := spec.Paths[pathTemplate][strings.ToLower(method)]; !found {
+				missing = append(missing, method + " " + pathTemplate)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error while walking routes: %w", err)
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("routes missing from the OpenAPI spec: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+
+/* Handlers */
+
+/*Described API. Set by newHandler*/
+var openAPISpec OpenAPISpec
+
+func GetOpenAPISpec(writer http.ResponseWriter, request *http.Request) {
+	formatResponse(&writer, openAPISpec)
+}
+
+
+/* Home page */
+
+/*Order of methods of a path on the home page*/
+var HOME_METHODS = []string{"get", "post", "put", "patch", "delete"}
+
+/*Order of sections of the home page, by operation tag*/
+var HOME_SECTIONS = []string{"planets", "admin", "health", "docs", "planets v1"}
+
+/*homeEndpoint ... Operation of the spec as shown on the home page*/
+type homeEndpoint struct {
+	Method string
+	Path string
+	Summary string
+	Deprecated bool
+	// Permission required. Empty on public operations
+	Permission string
+	Description string
+	Parameters []OpenAPIParameter
+	// Indented request body example. Empty when the operation has none
+	Example string
+}
+
+type homeSection struct {
+	Name string
+	Endpoints []homeEndpoint
+}
+
+/*homeSections groups the operations of spec by tag, for the home page template*/
+func homeSections(spec OpenAPISpec) []homeSection {
+	paths := make([]string, 0, len(spec.Paths))
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	endpointsByTag := map[string][]homeEndpoint{}
+	for _, path := range paths {
+		for _, method := range HOME_METHODS {
+			operation, found := spec.Paths[path][method]
+			if !found {
+				continue
+			}
+
+			endpoint := homeEndpoint{
+				Method: strings.ToUpper(method),
+				Path: path,
+				Summary: operation.Summary,
+				Deprecated: operation.Deprecated,
+				Permission: operation.RequiredPermission,
+				Description: operation.Description,
+				Parameters: operation.Parameters,
+			}
+			if operation.RequestBody != nil {
+				for _, mediaType := range operation.RequestBody.Content {
+					if mediaType.Example != nil {
+						example, _ := json.MarshalIndent(mediaType.Example, "", "    ")
+						endpoint.Example = string(example)
+					}
+				}
+			}
+
+			tag := ""
+			if len(operation.Tags) > 0 {
+				tag = operation.Tags[0]
+			}
+			endpointsByTag[tag] = append(endpointsByTag[tag], endpoint)
+		}
+	}
+
+	var sections []homeSection
+	for _, tag := range HOME_SECTIONS {
+		if endpoints, found := endpointsByTag[tag]; found {
+			sections = append(sections, homeSection{Name: tag, Endpoints: endpoints})
+		}
+	}
+
+	return sections
+}
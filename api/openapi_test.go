@@ -0,0 +1,12 @@
+package api
+
+import (
+	"testing"
+)
+
+
+func TestSpecCoversEveryRoute(t *testing.T) {
+	if err := checkSpecCoverage(newRouter(), NewOpenAPISpec()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+)
+
+
+/*Applies a JSON Merge Patch (RFC 7396) over the original document*/
+func mergePatch(original, patch []byte) ([]byte, error) {
+	var originalDocument, patchDocument interface{}
+
+	if err := json.Unmarshal(original, &originalDocument); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &patchDocument); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergeValues(originalDocument, patchDocument))
+}
+
+/*Null members remove keys, objects are merged recursively and anything else replaces the target*/
+func mergeValues(target, patch interface{}) interface{} {
+	patchObject, isObject := patch.(map[string]interface{})
+	if !isObject {
+		return patch
+	}
+
+	targetObject, isObject := target.(map[string]interface{})
+	if !isObject {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergeValues(targetObject[key], value)
+		}
+	}
+
+	return targetObject
+}
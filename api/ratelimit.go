@@ -0,0 +1,209 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/ratelimit"
+)
+
+
+/*Takes requests from the bucket of each client. nil disables rate limiting. Set with UseRateLimits*/
+var limiter ratelimit.Limiter
+
+/*Limit of each route, by mux route name. Routes missing use ratelimit.DEFAULT_ROUTE, if informed, or have no limit*/
+var routeLimits map[string]ratelimit.Limit
+
+/*Takes clients from the X-Forwarded-For header, for APIs behind a proxy. Otherwise spoofable*/
+var trustForwardedFor bool
+
+/*Counts requests of each client per day. nil, or a zero dailyQuota, disables quotas. Set with UseDailyQuota*/
+var quotaStore ratelimit.QuotaStore
+var dailyQuota int64
+
+func UseRateLimits(requestLimiter ratelimit.Limiter, limits map[string]ratelimit.Limit, forwardedFor bool) {
+	limiter = requestLimiter
+	routeLimits = limits
+	trustForwardedFor = forwardedFor
+}
+
+func UseDailyQuota(store ratelimit.QuotaStore, quota int64) {
+	quotaStore = store
+	dailyQuota = quota
+}
+
+/*limitRates answers 429 to clients past the limit of the route matched, or past their daily quota.
+Public routes are never limited, so probes and scrapes keep working. Meant for router.Use, after authenticate and before enforcePolicy,
+so 401 and 403 answers count too. Clients are principals, or addresses of anonymous requests and requests with bad credentials.
+Failing limiters and quota stores let requests through*/
+func limitRates(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		route := UNMATCHED_ROUTE
+		if current := mux.CurrentRoute(request); current != nil && current.GetName() != "" {
+			route = current.GetName()
+		}
+		if permission, found := ROUTE_PERMISSIONS[route]; !found || permission == PUBLIC {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		ctx := request.Context()
+		client := clientKey(request)
+		if limiter != nil {
+			// Routes with a limit of their own get a bucket of their own
+			limit, found := routeLimits[route]
+			bucket := client + " " + route
+			if !found {
+				limit, found = routeLimits[ratelimit.DEFAULT_ROUTE]
+				bucket = client
+			}
+
+			if found {
+				decision, err := limiter.Allow(ctx, bucket, limit)
+				if err != nil {
+					logging.Error(ctx, "Could not apply rate limit", logging.Fields{"error": err, "client": client})
+				} else {
+					writeRateLimitHeaders(writer, limit, decision)
+					if !decision.Allowed {
+						rateLimitedTotal.Inc(route, "rate")
+						writer.Header().Set("Retry-After", retryAfter(decision.RetryAfter))
+						formatErrorResponse(writer, model.NewError(
+							CodeRateLimited,
+							"Too many requests. Retry in " + retryAfter(decision.RetryAfter) + " seconds",
+							map[string]interface{}{"limit": limit.String(), "retryAfterSeconds": seconds(decision.RetryAfter)},
+						))
+						return
+					}
+				}
+			}
+		}
+
+		if quotaStore != nil && dailyQuota > 0 {
+			now := time.Now()
+			day := ratelimit.Day(now)
+			count, err := quotaStore.Increment(ctx, client, day)
+			if err != nil {
+				logging.Error(ctx, "Could not count daily quota", logging.Fields{"error": err, "client": client})
+			} else if count > dailyQuota {
+				resetsAt := day.Add(24 * time.Hour)
+				rateLimitedTotal.Inc(route, "quota")
+				writer.Header().Set("Retry-After", retryAfter(resetsAt.Sub(now)))
+				formatErrorResponse(writer, model.NewError(
+					CodeQuotaExceeded,
+					fmt.Sprintf("Daily quota of %d requests exceeded", dailyQuota),
+					map[string]interface{}{"quota": dailyQuota, "resetsAt": resetsAt},
+				))
+				return
+			}
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+/*clientKey names whoever sent request: its authenticated principal, or else its address*/
+func clientKey(request *http.Request) string {
+	if principal := authenticatedPrincipal(request); principal != nil {
+		return "principal:" + principal.ID
+	}
+
+	return "ip:" + clientIP(request)
+}
+
+/*clientIP is the address the request came from. Behind a trusted proxy, it's the last one the proxy added to X-Forwarded-For,
+since the ones before it come from clients*/
+func clientIP(request *http.Request) string {
+	if trustForwardedFor {
+		if forwarded := request.Header.Get("X-Forwarded-For"); forwarded != "" {
+			addresses := strings.Split(forwarded, ",")
+			if address := strings.TrimSpace(addresses[len(addresses) - 1]); address != "" {
+				return address
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+/*writeRateLimitHeaders follows the IETF RateLimit header fields draft. Limit is the size of the bucket, and Reset how long until it's full*/
+func writeRateLimitHeaders(writer http.ResponseWriter, limit ratelimit.Limit, decision ratelimit.Decision) {
+	header := writer.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	header.Set("RateLimit-Reset", strconv.FormatInt(seconds(decision.Reset), 10))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", limit.Requests, seconds(limit.Per), limit.Burst))
+}
+
+/*seconds rounds duration up, so clients never retry too early*/
+func seconds(duration time.Duration) int64 {
+	return int64(math.Ceil(duration.Seconds()))
+}
+
+/*retryAfter is the Retry-After value of duration, at least a second*/
+func retryAfter(duration time.Duration) string {
+	value := seconds(duration)
+	if value < 1 {
+		value = 1
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+/*checkRouteLimits lists limits of routes router doesn't have, or that are public and never limited, which are likely typos*/
+func checkRouteLimits(router *mux.Router) error {
+	known := map[string]bool{ratelimit.DEFAULT_ROUTE: true}
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if name := route.GetName(); name != "" && ROUTE_PERMISSIONS[name] != PUBLIC {
+			known[name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error while walking routes: %w", err)
+	}
+
+	var unknown []string
+	for route := range routeLimits {
+		if !known[route] {
+			unknown = append(unknown, route)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("rate limits of unknown or public routes: %s", strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+/*documentRateLimits adds 429 answers to operations that may be limited. Must run after documentRoutePermissions*/
+func documentRateLimits(spec OpenAPISpec) {
+	if limiter == nil && (quotaStore == nil || dailyQuota <= 0) {
+		return
+	}
+
+	for _, pathItem := range spec.Paths {
+		for _, operation := range pathItem {
+			if operation.RequiredPermission == "" {
+				continue
+			}
+			operation.Responses[fmt.Sprint(http.StatusTooManyRequests)] = OpenAPIResponse{
+				Description: "Rate limit or daily quota exceeded. Retry-After tells when to retry",
+				Content: jsonContent(schemaRef("ErrorResponse"), nil),
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/auth"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/ratelimit"
+)
+
+
+var TEST_BOOTSTRAP_KEY = strings.Repeat("k", auth.MIN_BOOTSTRAP_KEY_LENGTH)
+
+/*sendWithKey makes a GET request to server with apiKey on X-API-Key, unless empty. Returns the error code answered, if any*/
+func sendWithKey(t *testing.T, server string, apiKey, path string) (*http.Response, model.ErrorCode) {
+	t.Helper()
+	request, err := http.NewRequest("GET", server + path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apiKey != "" {
+		request.Header.Set("X-API-Key", apiKey)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errorResponse ErrorResponse
+	if response.StatusCode >= 400 {
+		json.Unmarshal(body, &errorResponse)
+	}
+	return response, errorResponse.Code
+}
+
+func TestRateLimits(t *testing.T) {
+	// 2 requests at once, refilled every 30s
+	limits := map[string]ratelimit.Limit{ratelimit.DEFAULT_ROUTE: {Requests: 2, Per: time.Minute, Burst: 2}}
+
+	type limitedRequest struct {
+		apiKey string
+		path string
+		wantStatus int
+		wantCode model.ErrorCode
+	}
+	tests := []struct {
+		name string
+		limits map[string]ratelimit.Limit
+		dailyQuota int64
+		requests []limitedRequest
+	}{
+		{"past the limit", limits, 0, []limitedRequest{
+			{TEST_BOOTSTRAP_KEY, planetsRoot, http.StatusOK, ""},
+			{TEST_BOOTSTRAP_KEY, planetsRoot + "/trash", http.StatusOK, ""},
+			{TEST_BOOTSTRAP_KEY, planetsRoot, http.StatusTooManyRequests, CodeRateLimited},
+		}},
+		{"bad credentials are limited by address", limits, 0, []limitedRequest{
+			{"pk_guessed_secret", planetsRoot, http.StatusUnauthorized, model.CodeUnauthenticated},
+			{"", planetsRoot, http.StatusUnauthorized, model.CodeUnauthenticated},
+			{"pk_guessed_again", planetsRoot, http.StatusTooManyRequests, CodeRateLimited},
+			// Authenticated clients have buckets of their own
+			{TEST_BOOTSTRAP_KEY, planetsRoot, http.StatusOK, ""},
+		}},
+		{"public routes", limits, 0, []limitedRequest{
+			{"", "/metrics", http.StatusOK, ""},
+			{"", "/metrics", http.StatusOK, ""},
+			{"", "/metrics", http.StatusOK, ""},
+		}},
+		{"past the daily quota", nil, 2, []limitedRequest{
+			{TEST_BOOTSTRAP_KEY, planetsRoot, http.StatusOK, ""},
+			{TEST_BOOTSTRAP_KEY, planetsRoot, http.StatusOK, ""},
+			{TEST_BOOTSTRAP_KEY, planetsRoot, http.StatusTooManyRequests, CodeQuotaExceeded},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, stop := newTestAPI(t)
+			defer stop()
+			accessStore := model.NewMemoryAccessStore()
+			if err := accessStore.SeedRoles(context.Background(), auth.DEFAULT_ROLES); err != nil {
+				t.Fatal(err)
+			}
+			UseAccessStore(accessStore)
+			UseAuth(auth.NewAPIKeyAuthenticator(model.NewMemoryAPIKeyStore(), TEST_BOOTSTRAP_KEY), auth.NewAuthorizer(accessStore, ""))
+			if test.limits != nil {
+				UseRateLimits(ratelimit.NewMemoryLimiter(), test.limits, false)
+			}
+			if test.dailyQuota > 0 {
+				UseDailyQuota(ratelimit.NewMemoryQuotaStore(), test.dailyQuota)
+			}
+
+			for index, limited := range test.requests {
+				response, code := sendWithKey(t, server.URL, limited.apiKey, limited.path)
+				if response.StatusCode != limited.wantStatus || code != limited.wantCode {
+					t.Fatalf("request %d: answered %d %q, want %d %q", index + 1, response.StatusCode, code, limited.wantStatus, limited.wantCode)
+				}
+
+				// Buckets get a token back every 30s. Quotas reset at UTC midnight
+				retryAfter := response.Header.Get("Retry-After")
+				if (code == CodeRateLimited && retryAfter != "30") || (code == CodeQuotaExceeded && retryAfter == "") {
+					t.Errorf("request %d: Retry-After = %q", index + 1, retryAfter)
+				}
+			}
+		})
+	}
+}
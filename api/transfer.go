@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/transfer"
+)
+
+
+/*negotiateFormat picks the export format from ?format=, or else from the Accept header*/
+func negotiateFormat(request *http.Request) (transfer.Format, error) {
+	if name := request.URL.Query().Get("format"); name != "" {
+		return transfer.ParseFormat(name)
+	}
+
+	accept := request.Header.Get("Accept")
+	if accept == "" {
+		return transfer.FormatJSON, nil
+	}
+
+	var chosen transfer.Format
+	chosenQuality := 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		parts := strings.Split(mediaRange, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(parts[0]))
+
+		quality := 1.0
+		for _, parameter := range parts[1:] {
+			parameter = strings.TrimSpace(parameter)
+			if strings.HasPrefix(parameter, "q=") {
+				if value, err := strconv.ParseFloat(strings.TrimPrefix(parameter, "q="), 64); err == nil {
+					quality = value
+				}
+			}
+		}
+		if quality <= chosenQuality {
+			continue
+		}
+
+		format, err := transfer.ParseFormat(mediaType)
+		if mediaType == "*/*" || mediaType == "application/*" {
+			format, err = transfer.FormatJSON, nil
+		}
+		if mediaType == "text/*" {
+			format, err = transfer.FormatCSV, nil
+		}
+		if err == nil {
+			chosen, chosenQuality = format, quality
+		}
+	}
+
+	if chosen == "" {
+		return chosen, model.NewError(
+			CodeNotAcceptable,
+			"Cannot export as " + accept + ". Accept text/csv, application/x-ndjson or application/json",
+			map[string]interface{}{"accept": accept},
+		)
+	}
+
+	return chosen, nil
+}
+
+/*Streams every planet as CSV, NDJSON or a JSON array. Takes the same filters and sort of ListPlanets*/
+func ExportPlanets(writer http.ResponseWriter, request *http.Request) {
+	format, err := negotiateFormat(request)
+	var listOptions model.ListOptions
+	if err == nil {
+		listOptions, err = parseListOptions(request.URL.Query())
+	}
+	if err == nil {
+		err = listOptions.Validate()
+	}
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", format.ContentType() + "; charset=UTF-8")
+	writer.Header().Set("Content-Disposition", "attachment; filename=planets." + string(format))
+	writer.Header().Set("Vary", "Accept")
+
+	exported, err := transfer.Export(request.Context(), writer, format, listOptions)
+	if err != nil {
+		// Too late to answer an error, part of the body is gone
+		logging.Error(request.Context(), "Export stopped", logging.Fields{"exported": exported, "error": err})
+	}
+}
+
+/*Imports planets sent as CSV, NDJSON or a JSON array. Takes ?mode=skip|overwrite|fail and ?dryRun=true*/
+func ImportPlanets(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	query := request.URL.Query()
+
+	var format transfer.Format
+	var err error
+	if name := query.Get("format"); name != "" {
+		format, err = transfer.ParseFormat(name)
+	} else if contentType := request.Header.Get("Content-Type"); contentType != "" {
+		format, err = transfer.ParseFormat(contentType)
+		if err != nil {
+			err = model.NewError(
+				CodeUnsupportedMediaType,
+				"Send text/csv, application/x-ndjson or application/json",
+				map[string]interface{}{"contentType": contentType},
+			)
+		}
+	} else {
+		format = transfer.FormatJSON
+	}
+
+	options := transfer.ImportOptions{Mode: transfer.ModeFail}
+	if err == nil && query.Get("mode") != "" {
+		options.Mode, err = transfer.ParseConflictMode(query.Get("mode"))
+	}
+	if err == nil && query.Get("dryRun") != "" {
+		options.DryRun, err = strconv.ParseBool(query.Get("dryRun"))
+		if err != nil {
+			err = model.NewError(
+				model.CodeValidation,
+				"Query param dryRun must be true or false",
+				map[string]interface{}{"dryRun": query.Get("dryRun")},
+			)
+		}
+	}
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	report, err := transfer.Import(request.Context(), request.Body, format, options)
+	if err != nil {
+		modelError := model.AsError(err)
+		details := map[string]interface{}{"report": report}
+		for name, value := range modelError.Details {
+			details[name] = value
+		}
+		formatErrorResponse(writer, &model.Error{Code: modelError.Code, Message: modelError.Message, Details: details, Err: err})
+		return
+	}
+
+	formatResponse(&writer, report)
+}
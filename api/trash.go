@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+)
+
+
+/*Lists deleted planets not purged yet, with the same filters and pagination of ListPlanets*/
+func ListTrash(writer http.ResponseWriter, request *http.Request) {
+	listPlanets(writer, request, true)
+}
+
+/*Takes a deleted planet out of the trash, unless another planet took its name meanwhile*/
+func RestorePlanet(writer http.ResponseWriter, request *http.Request) {
+	restoredPlanet, err := planet.RestorePlanet(request.Context(), mux.Vars(request)["id"])
+	if err != nil {
+		formatErrorResponse(writer, err)
+		return
+	}
+
+	formatResponse(&writer, restoredPlanet)
+}
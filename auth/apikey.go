@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/*Prefix of every API key. Keys look like pk_<id>_<secret>*/
+const KEY_PREFIX string = "pk_"
+
+/*Shortest bootstrap key taken, so it can't be guessed*/
+const MIN_BOOTSTRAP_KEY_LENGTH int = 32
+
+/*Principal ID of requests authenticated by the bootstrap key*/
+const BOOTSTRAP_PRINCIPAL string = "bootstrap"
+
+/*APIKeyAuthenticator ... Authenticates requests sending an API key on X-API-Key, or on Authorization: ApiKey <key>*/
+type APIKeyAuthenticator struct {
+	store model.APIKeyStore
+	// Grants admin without being stored. Empty disables it
+	bootstrapKey string
+	now func() time.Time
+}
+
+func NewAPIKeyAuthenticator(store model.APIKeyStore, bootstrapKey string) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{store: store, bootstrapKey: bootstrapKey, now: time.Now}
+}
+
+/*keyFromRequest takes the API key sent on request. Empty when none is sent*/
+func keyFromRequest(request *http.Request) string {
+	if key := request.Header.Get("X-API-Key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+
+	scheme, credentials, found := cut(request.Header.Get("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "ApiKey") {
+		return strings.TrimSpace(credentials)
+	}
+	return ""
+}
+
+func (authenticator *APIKeyAuthenticator) Challenges() []string {
+	return []string{`ApiKey realm="planets-api"`}
+}
+
+func (authenticator *APIKeyAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	key := keyFromRequest(request)
+	if key == "" {
+		return nil, nil
+	}
+
+	if authenticator.bootstrapKey != "" &&
+		subtle.ConstantTimeCompare([]byte(key), []byte(authenticator.bootstrapKey)) == 1 {
+		return &Principal{
+			ID: BOOTSTRAP_PRINCIPAL,
+			Name: BOOTSTRAP_PRINCIPAL,
+			Method: "bootstrap_key",
+			Scopes: []string{SCOPE_ADMIN},
+		}, nil
+	}
+
+	id, secret, valid := parseKey(key)
+	if !valid {
+		return nil, Unauthenticated("Invalid API key")
+	}
+	storedKey, err := authenticator.store.GetKey(request.Context(), id)
+	if errors.Is(err, model.ErrAPIKeyNotFound) {
+		return nil, Unauthenticated("Invalid API key")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(storedKey.SecretHash)) != 1 {
+		return nil, Unauthenticated("Invalid API key")
+	}
+	if storedKey.RevokedAt != nil {
+		return nil, Unauthenticated("API key was revoked")
+	}
+	if storedKey.ExpiresAt != nil && !authenticator.now().Before(*storedKey.ExpiresAt) {
+		return nil, Unauthenticated("API key expired")
+	}
+
+	return &Principal{
+		ID: storedKey.ID,
+		Name: storedKey.Name,
+		Method: "api_key",
+		UserID: storedKey.UserID,
+		Scopes: storedKey.Scopes,
+	}, nil
+}
+
+
+/* Issuing */
+
+/*IssueKey creates and stores a key named name, acting for userID by scopes until expiresAt, or forever when nil.
+Keys of users may have no scopes, acting by their user roles alone. userID must be checked beforehand.
+Returns the key to hand to its client. Only its hash is stored, so it can't be shown again*/
+func IssueKey(ctx context.Context, store model.APIKeyStore, name, userID string, scopes []string, expiresAt *time.Time) (string, model.APIKey, error) {
+	var apiKey model.APIKey
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", apiKey, model.NewError(model.CodeValidation, "API key name is required", nil)
+	}
+	if len(scopes) == 0 && userID == "" {
+		return "", apiKey, model.NewError(
+			model.CodeValidation,
+			"At least one scope is required for keys without a user",
+			map[string]interface{}{"validScopes": SCOPES},
+		)
+	}
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return "", apiKey, model.NewError(
+				model.CodeValidation,
+				"Unknown scope " + scope,
+				map[string]interface{}{"validScopes": SCOPES},
+			)
+		}
+	}
+	now := time.Now().UTC()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return "", apiKey, model.NewError(model.CodeValidation, "API key expiration must be in the future", nil)
+	}
+
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", apiKey, err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", apiKey, err
+	}
+	id := hex.EncodeToString(idBytes)
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	apiKey = model.APIKey{
+		ID: id,
+		Name: name,
+		UserID: userID,
+		SecretHash: hashSecret(secret),
+		Scopes: uniqueStrings(scopes),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	if err := store.InsertKey(ctx, apiKey); err != nil {
+		return "", apiKey, err
+	}
+
+	return KEY_PREFIX + id + "_" + secret, apiKey, nil
+}
+
+/*RevokeKey stops the key with id from authenticating, from now on*/
+func RevokeKey(ctx context.Context, store model.APIKeyStore, id string) error {
+	return store.RevokeKey(ctx, id, time.Now().UTC())
+}
+
+
+/* Helpers */
+
+/*parseKey splits a key into its id and secret*/
+func parseKey(key string) (string, string, bool) {
+	if !strings.HasPrefix(key, KEY_PREFIX) {
+		return "", "", false
+	}
+
+	// Ids are hex, so the first underscore ends them. Secrets may hold underscores
+	id, secret, found := cut(strings.TrimPrefix(key, KEY_PREFIX), "_")
+	return id, secret, found && id != "" && secret != ""
+}
+
+/*hashSecret hashes key secrets for storage. Secrets are random, so a fast hash is enough*/
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func cut(text, separator string) (string, string, bool) {
+	if index := strings.Index(text, separator); index >= 0 {
+		return text[:index], text[index+len(separator):], true
+	}
+
+	return text, "", false
+}
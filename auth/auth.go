@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/*Scopes granted to credentials. Each one acts as a role, listed in SCOPE_ROLES*/
+const SCOPE_READ string = "planets:read"
+const SCOPE_WRITE string = "planets:write"
+const SCOPE_ADMIN string = "planets:admin"
+
+var SCOPES = []string{SCOPE_READ, SCOPE_WRITE, SCOPE_ADMIN}
+
+func ValidScope(scope string) bool {
+	_, found := SCOPE_ROLES[scope]
+	return found
+}
+
+/*Principal ... Who a request was authenticated as*/
+type Principal struct {
+	// API key id, or another identifier given by the authenticator
+	ID string `json:"id"`
+	Name string `json:"name"`
+	// How the principal was authenticated, like api_key
+	Method string `json:"method"`
+	// User acted for, if any
+	UserID string `json:"userId,omitempty"`
+	Scopes []string `json:"scopes"`
+}
+
+type principalKey struct{}
+
+/*WithPrincipal returns a copy of ctx carrying principal*/
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+/*PrincipalFrom returns the principal carried by ctx. nil for anonymous requests*/
+func PrincipalFrom(ctx context.Context) *Principal {
+	if ctx == nil {
+		return nil
+	}
+
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+
+/* Authenticators */
+
+/*Authenticator ... Finds who sent a request.
+Answers nil, nil when the request has no credentials it understands, and an Error coded unauthenticated when they are invalid*/
+type Authenticator interface {
+	Authenticate(request *http.Request) (*Principal, error)
+}
+
+/*Challenger ... Authenticator telling clients how to authenticate, as WWW-Authenticate values of 401 answers*/
+type Challenger interface {
+	Challenges() []string
+}
+
+/*Chain ... Authenticator trying each of its authenticators in turn, until one finds credentials*/
+type Chain []Authenticator
+
+func (chain Chain) Challenges() []string {
+	var challenges []string
+	for _, authenticator := range chain {
+		if challenger, isChallenger := authenticator.(Challenger); isChallenger {
+			challenges = append(challenges, challenger.Challenges()...)
+		}
+	}
+
+	return challenges
+}
+
+func (chain Chain) Authenticate(request *http.Request) (*Principal, error) {
+	for _, authenticator := range chain {
+		principal, err := authenticator.Authenticate(request)
+		if err != nil || principal != nil {
+			return principal, err
+		}
+	}
+
+	return nil, nil
+}
+
+/*Unauthenticated builds the error answered for invalid credentials*/
+func Unauthenticated(message string) *model.Error {
+	return model.NewError(model.CodeUnauthenticated, message, nil)
+}
@@ -0,0 +1,449 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+)
+
+
+/*Largest JWKS document read*/
+const MAX_JWKS_SIZE int64 = 1 << 20
+
+/*Shortest time between refreshes made for tokens of unknown key ids, so made up ones can't flood the identity provider*/
+const MIN_JWKS_REFRESH_INTERVAL time.Duration = 30 * time.Second
+
+/*JWTSettings ... What bearer tokens must look like to be accepted*/
+type JWTSettings struct {
+	// File path or http(s) URL of the JWKS
+	JWKS string
+	Issuer string
+	Audience string
+	// Claim holding scopes: a space separated string, like scope, or an array, like scp
+	ScopesClaim string
+	// Scopes of the identity provider, translated to scopes of this API. Scopes of this API are always taken as they are
+	ScopeMap map[string]string
+	// Clock skew tolerated on exp and nbf
+	Leeway time.Duration
+	// How long fetching the JWKS may take
+	FetchTimeout time.Duration
+}
+
+/*JWTAuthenticator ... Authenticates requests sending a signed JWT on Authorization: Bearer <token>, checked against the keys of a JWKS*/
+type JWTAuthenticator struct {
+	settings JWTSettings
+	client *http.Client
+	now func() time.Time
+
+	mutex sync.RWMutex
+	// By key id
+	keys map[string]crypto.PublicKey
+
+	// Held while refreshing, so a single refresh runs at a time
+	refreshMutex sync.Mutex
+	refreshedAt time.Time
+}
+
+/*NewJWTAuthenticator loads the JWKS right away, so bad settings fail on startup*/
+func NewJWTAuthenticator(ctx context.Context, settings JWTSettings) (*JWTAuthenticator, error) {
+	authenticator := &JWTAuthenticator{
+		settings: settings,
+		client: &http.Client{Timeout: settings.FetchTimeout},
+		now: time.Now,
+	}
+
+	return authenticator, authenticator.Refresh(ctx)
+}
+
+/*keyOf finds the key of keyID. Tokens without key ids are taken when there is a single key*/
+func (authenticator *JWTAuthenticator) keyOf(keyID string) (crypto.PublicKey, bool) {
+	authenticator.mutex.RLock()
+	defer authenticator.mutex.RUnlock()
+
+	key, found := authenticator.keys[keyID]
+	if keyID == "" && len(authenticator.keys) == 1 {
+		for _, onlyKey := range authenticator.keys {
+			key, found = onlyKey, true
+		}
+	}
+	return key, found
+}
+
+/*refreshForKey refreshes the JWKS when keyID is unknown, so keys rotated since the last refresh are taken right away.
+Refreshes at most once per MIN_JWKS_REFRESH_INTERVAL. Tells whether keyID is known afterwards*/
+func (authenticator *JWTAuthenticator) refreshForKey(ctx context.Context, keyID string) bool {
+	authenticator.refreshMutex.Lock()
+	defer authenticator.refreshMutex.Unlock()
+
+	// Another request may have refreshed while this one waited
+	if _, found := authenticator.keyOf(keyID); found {
+		return true
+	}
+	if authenticator.now().Sub(authenticator.refreshedAt) < MIN_JWKS_REFRESH_INTERVAL {
+		return false
+	}
+	if err := authenticator.refresh(ctx); err != nil {
+		logging.Warn(ctx, "Could not refresh JWKS for an unknown key id", logging.Fields{"error": err, "kid": keyID})
+		return false
+	}
+
+	_, found := authenticator.keyOf(keyID)
+	return found
+}
+
+/*Refresh loads the JWKS again. Keys in use are kept when it fails*/
+func (authenticator *JWTAuthenticator) Refresh(ctx context.Context) error {
+	authenticator.refreshMutex.Lock()
+	defer authenticator.refreshMutex.Unlock()
+
+	return authenticator.refresh(ctx)
+}
+
+/*refresh does Refresh. refreshMutex must be held*/
+func (authenticator *JWTAuthenticator) refresh(ctx context.Context) error {
+	authenticator.refreshedAt = authenticator.now()
+	document, err := authenticator.readJWKS(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read JWKS %s: %w", authenticator.settings.JWKS, err)
+	}
+	keys, err := parseJWKS(document)
+	if err != nil {
+		return fmt.Errorf("invalid JWKS %s: %w", authenticator.settings.JWKS, err)
+	}
+
+	authenticator.mutex.Lock()
+	defer authenticator.mutex.Unlock()
+	authenticator.keys = keys
+	return nil
+}
+
+/*RefreshEvery refreshes the JWKS on every interval until ctx is done, so rotated keys are picked up*/
+func (authenticator *JWTAuthenticator) RefreshEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := authenticator.Refresh(ctx); err != nil {
+				logging.Warn(ctx, "Could not refresh JWKS. Keeping the keys loaded before", logging.Fields{"error": err})
+				continue
+			}
+			logging.Debug(ctx, "JWKS refreshed", logging.Fields{"jwks": authenticator.settings.JWKS})
+		}
+	}
+}
+
+func (authenticator *JWTAuthenticator) readJWKS(ctx context.Context) ([]byte, error) {
+	source := authenticator.settings.JWKS
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := authenticator.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("answered %d", response.StatusCode)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(response.Body, MAX_JWKS_SIZE))
+}
+
+func (authenticator *JWTAuthenticator) Challenges() []string {
+	return []string{`Bearer realm="planets-api"`}
+}
+
+func (authenticator *JWTAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	scheme, token, found := cut(request.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+
+	claims, err := authenticator.verify(request.Context(), strings.TrimSpace(token))
+	if err != nil {
+		logging.Debug(request.Context(), "Bearer token refused", logging.Fields{"error": err})
+		return nil, Unauthenticated("Invalid bearer token")
+	}
+	if message := authenticator.checkClaims(claims); message != "" {
+		return nil, Unauthenticated(message)
+	}
+
+	// Tokens of services may only name their client
+	var subject string
+	for _, claim := range []string{"sub", "azp", "client_id"} {
+		if subject, _ = claims[claim].(string); subject != "" {
+			break
+		}
+	}
+	if subject == "" {
+		return nil, Unauthenticated("Bearer token has no subject")
+	}
+
+	return &Principal{
+		ID: "jwt:" + subject,
+		Name: subject,
+		Method: "jwt",
+		Scopes: authenticator.scopesOf(claims),
+	}, nil
+}
+
+
+/* Tokens */
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID string `json:"kid"`
+}
+
+/*verify checks the signature of token, returning its claims. Unknown key ids refresh the JWKS first.
+Only RS256 on RSA keys and ES256 on P-256 keys are taken. Anything else, none and HS256 included, is refused*/
+func (authenticator *JWTAuthenticator) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected 3 parts, got %d", len(parts))
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	key, found := authenticator.keyOf(header.KeyID)
+	if !found && authenticator.refreshForKey(ctx, header.KeyID) {
+		key, found = authenticator.keyOf(header.KeyID)
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown key id %q", header.KeyID)
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		if header.Algorithm != "RS256" {
+			return nil, fmt.Errorf("algorithm %q doesn't match the RSA key %q", header.Algorithm, header.KeyID)
+		}
+		if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, fmt.Errorf("bad signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Algorithm != "ES256" {
+			return nil, fmt.Errorf("algorithm %q doesn't match the EC key %q", header.Algorithm, header.KeyID)
+		}
+		// r and s, 32 bytes each
+		if len(signature) != 64 {
+			return nil, fmt.Errorf("bad signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(publicKey, digest[:], r, s) {
+			return nil, fmt.Errorf("bad signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key %q", header.KeyID)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	return claims, nil
+}
+
+/*checkClaims tells what is wrong with the registered claims of a verified token. Empty when nothing is*/
+func (authenticator *JWTAuthenticator) checkClaims(claims map[string]interface{}) string {
+	now := authenticator.now()
+	leeway := authenticator.settings.Leeway
+
+	if issuer, _ := claims["iss"].(string); issuer != authenticator.settings.Issuer {
+		return "Bearer token has an unexpected issuer"
+	}
+	if !hasAudience(claims["aud"], authenticator.settings.Audience) {
+		return "Bearer token is not meant for this API"
+	}
+	expiresAt, isNumber := claims["exp"].(float64)
+	if !isNumber {
+		return "Bearer token has no expiration"
+	}
+	if !now.Before(time.Unix(int64(expiresAt), 0).Add(leeway)) {
+		return "Bearer token expired"
+	}
+	if notBefore, isNumber := claims["nbf"].(float64); isNumber && now.Add(leeway).Before(time.Unix(int64(notBefore), 0)) {
+		return "Bearer token is not valid yet"
+	}
+
+	return ""
+}
+
+/*scopesOf translates the scopes claimed into scopes of this API. Unknown ones are dropped*/
+func (authenticator *JWTAuthenticator) scopesOf(claims map[string]interface{}) []string {
+	var claimed []string
+	switch value := claims[authenticator.settings.ScopesClaim].(type) {
+	case string:
+		claimed = strings.Fields(value)
+	case []interface{}:
+		for _, item := range value {
+			if scope, isString := item.(string); isString {
+				claimed = append(claimed, scope)
+			}
+		}
+	}
+
+	scopes := []string{}
+	for _, scope := range claimed {
+		if mapped, found := authenticator.settings.ScopeMap[scope]; found {
+			scope = mapped
+		}
+		if ValidScope(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return uniqueStrings(scopes)
+}
+
+/*hasAudience tells whether aud, a string or an array of strings, holds audience*/
+func hasAudience(aud interface{}, audience string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, item := range value {
+			if item == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(decoded, target)
+}
+
+
+/* JWKS */
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Curve string `json:"crv"`
+	X string `json:"x"`
+	Y string `json:"y"`
+}
+
+/*parseJWKS reads the RSA and P-256 signing keys of a JWKS document, by key id. Other keys are skipped*/
+func parseJWKS(document []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(document, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, key := range jwks.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := key.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key.KeyID, err)
+		}
+		if publicKey != nil {
+			keys[key.KeyID] = publicKey
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no RSA or P-256 signing keys")
+	}
+
+	return keys, nil
+}
+
+/*publicKey decodes key. nil for key types not supported*/
+func (key jwk) publicKey() (crypto.PublicKey, error) {
+	switch key.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31 {
+			return nil, fmt.Errorf("invalid e")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must have at least 2048 bits")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if key.Curve != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on P-256")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+
+	return nil, nil
+}
+
+func decodeBigInt(text string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) == 0 {
+		return nil, fmt.Errorf("empty")
+	}
+
+	return new(big.Int).SetBytes(decoded), nil
+}
@@ -0,0 +1,405 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/*Keys signing tokens of tests, generated once since RSA keys are slow to generate*/
+var testRSAKey, testOtherRSAKey *rsa.PrivateKey
+var testECKey *ecdsa.PrivateKey
+
+func init() {
+	var err error
+	if testRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+	if testOtherRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+	if testECKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		panic(err)
+	}
+}
+
+/*Time tokens of tests are checked at*/
+var TEST_NOW = time.Unix(1700000000, 0)
+
+var TEST_JWT_SETTINGS = JWTSettings{
+	Issuer: "https://idp.example.com",
+	Audience: "planets-api",
+	ScopesClaim: "scope",
+	ScopeMap: map[string]string{"planets.viewer": SCOPE_READ},
+	Leeway: 30 * time.Second,
+	FetchTimeout: time.Second,
+}
+
+func encodeBigInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+/*jwksOf builds a JWKS document holding the public part of keys, by key id*/
+func jwksOf(keys map[string]crypto.Signer) []byte {
+	jwks := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	for keyID, key := range keys {
+		switch publicKey := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, jwk{
+				KeyType: "RSA", KeyID: keyID, Use: "sig",
+				N: encodeBigInt(publicKey.N), E: encodeBigInt(big.NewInt(int64(publicKey.E))),
+			})
+		case *ecdsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, jwk{
+				KeyType: "EC", KeyID: keyID, Use: "sig", Curve: "P-256",
+				X: encodeBigInt(publicKey.X), Y: encodeBigInt(publicKey.Y),
+			})
+		}
+	}
+
+	document, _ := json.Marshal(jwks)
+	return document
+}
+
+/*signToken builds a token of claims, signed by key as RS256 or ES256 would, whatever algorithm the header names*/
+func signToken(t *testing.T, algorithm, keyID string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(jwtHeader{Algorithm: algorithm, KeyID: keyID})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch privateKey := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, privateKey, digest[:])
+		// r and s, left padded to 32 bytes each
+		signature = make([]byte, 64)
+		if err == nil {
+			copy(signature[32 - len(r.Bytes()):32], r.Bytes())
+			copy(signature[64 - len(s.Bytes()):], s.Bytes())
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+/*validClaims are claims accepted at TEST_NOW. Overrides replace them, and nil values remove them*/
+func validClaims(overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss": TEST_JWT_SETTINGS.Issuer,
+		"aud": TEST_JWT_SETTINGS.Audience,
+		"sub": "reports",
+		"exp": TEST_NOW.Add(time.Hour).Unix(),
+		"scope": "planets.viewer openid",
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+
+	return claims
+}
+
+/*jwksServer serves a JWKS that can be rotated, counting how many times it was fetched*/
+type jwksServer struct {
+	*httptest.Server
+	mutex sync.Mutex
+	document []byte
+	fetches int
+}
+
+func newJWKSServer(keys map[string]crypto.Signer) *jwksServer {
+	server := &jwksServer{document: jwksOf(keys)}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		server.fetches++
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(server.document)
+	}))
+
+	return server
+}
+
+func (server *jwksServer) rotate(keys map[string]crypto.Signer) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.document = jwksOf(keys)
+}
+
+func (server *jwksServer) fetchCount() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.fetches
+}
+
+/*newTestJWTAuthenticator loads the JWKS of server, checking tokens at TEST_NOW*/
+func newTestJWTAuthenticator(t *testing.T, server *jwksServer) *JWTAuthenticator {
+	t.Helper()
+	settings := TEST_JWT_SETTINGS
+	settings.JWKS = server.URL
+
+	authenticator, err := NewJWTAuthenticator(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("NewJWTAuthenticator() error = %v", err)
+	}
+	authenticator.now = func() time.Time { return TEST_NOW }
+	authenticator.refreshedAt = TEST_NOW
+	return authenticator
+}
+
+func bearerRequest(token string) *http.Request {
+	request := httptest.NewRequest("GET", "/planets/api/v2/planets", nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer " + token)
+	}
+	return request
+}
+
+/*checkAuthentication fails unless principal is the one of validClaims, or err has wantMessage when not empty*/
+func checkAuthentication(t *testing.T, principal *Principal, err error, wantMessage string) {
+	t.Helper()
+	if wantMessage != "" {
+		if principal != nil || err == nil {
+			t.Fatalf("Authenticate() = %+v, %v, want error %q", principal, err, wantMessage)
+		}
+		if cause := model.AsError(err); cause.Code != model.CodeUnauthenticated || cause.Message != wantMessage {
+			t.Errorf("Authenticate() error = %s %q, want %s %q", cause.Code, cause.Message, model.CodeUnauthenticated, wantMessage)
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	want := &Principal{ID: "jwt:reports", Name: "reports", Method: "jwt", Scopes: []string{SCOPE_READ}}
+	if !reflect.DeepEqual(principal, want) {
+		t.Errorf("Authenticate() = %+v, want %+v", principal, want)
+	}
+}
+
+func TestJWTAuthenticatorSignatures(t *testing.T) {
+	server := newJWKSServer(map[string]crypto.Signer{"rsa": testRSAKey, "ec": testECKey})
+	defer server.Close()
+	authenticator := newTestJWTAuthenticator(t, server)
+
+	tamperedToken := signToken(t, "RS256", "rsa", testRSAKey, validClaims(nil))
+	tamperedToken = tamperedToken[:strings.LastIndex(tamperedToken, ".")] + "." +
+		strings.Split(signToken(t, "RS256", "rsa", testOtherRSAKey, validClaims(nil)), ".")[2]
+
+	tests := []struct {
+		name string
+		token string
+		wantMessage string
+	}{
+		{"RS256 by the RSA key", signToken(t, "RS256", "rsa", testRSAKey, validClaims(nil)), ""},
+		{"ES256 by the EC key", signToken(t, "ES256", "ec", testECKey, validClaims(nil)), ""},
+		{"ES256 named on the RSA key", signToken(t, "ES256", "rsa", testRSAKey, validClaims(nil)), "Invalid bearer token"},
+		{"RS256 named on the EC key", signToken(t, "RS256", "ec", testECKey, validClaims(nil)), "Invalid bearer token"},
+		{"HS256", signToken(t, "HS256", "rsa", testRSAKey, validClaims(nil)), "Invalid bearer token"},
+		{"none", signToken(t, "none", "rsa", testRSAKey, validClaims(nil)), "Invalid bearer token"},
+		{"signed by another key", signToken(t, "RS256", "rsa", testOtherRSAKey, validClaims(nil)), "Invalid bearer token"},
+		{"signature of other claims", tamperedToken, "Invalid bearer token"},
+		{"no key id with many keys", signToken(t, "RS256", "", testRSAKey, validClaims(nil)), "Invalid bearer token"},
+		{"not a JWT", "planets", "Invalid bearer token"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(bearerRequest(test.token))
+			checkAuthentication(t, principal, err, test.wantMessage)
+		})
+	}
+}
+
+func TestJWTAuthenticatorClaims(t *testing.T) {
+	server := newJWKSServer(map[string]crypto.Signer{"rsa": testRSAKey})
+	defer server.Close()
+	authenticator := newTestJWTAuthenticator(t, server)
+
+	// Leeway is 30s
+	tests := []struct {
+		name string
+		overrides map[string]interface{}
+		wantMessage string
+	}{
+		{"valid", nil, ""},
+		{"other issuer", map[string]interface{}{"iss": "https://other.example.com"}, "Bearer token has an unexpected issuer"},
+		{"no issuer", map[string]interface{}{"iss": nil}, "Bearer token has an unexpected issuer"},
+		{"audience among others", map[string]interface{}{"aud": []string{"billing", "planets-api"}}, ""},
+		{"other audience", map[string]interface{}{"aud": "billing"}, "Bearer token is not meant for this API"},
+		{"other audiences", map[string]interface{}{"aud": []string{"billing"}}, "Bearer token is not meant for this API"},
+		{"no expiration", map[string]interface{}{"exp": nil}, "Bearer token has no expiration"},
+		{"expired within leeway", map[string]interface{}{"exp": TEST_NOW.Add(-10 * time.Second).Unix()}, ""},
+		{"expired", map[string]interface{}{"exp": TEST_NOW.Add(-time.Minute).Unix()}, "Bearer token expired"},
+		{"not valid yet within leeway", map[string]interface{}{"nbf": TEST_NOW.Add(10 * time.Second).Unix()}, ""},
+		{"not valid yet", map[string]interface{}{"nbf": TEST_NOW.Add(time.Minute).Unix()}, "Bearer token is not valid yet"},
+		{"no subject", map[string]interface{}{"sub": nil}, "Bearer token has no subject"},
+		{"client instead of subject", map[string]interface{}{"sub": nil, "azp": "reports"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := signToken(t, "RS256", "rsa", testRSAKey, validClaims(test.overrides))
+			principal, err := authenticator.Authenticate(bearerRequest(token))
+			checkAuthentication(t, principal, err, test.wantMessage)
+		})
+	}
+}
+
+func TestJWTAuthenticatorRefreshesOnUnknownKeyID(t *testing.T) {
+	server := newJWKSServer(map[string]crypto.Signer{"2023": testRSAKey})
+	defer server.Close()
+	authenticator := newTestJWTAuthenticator(t, server)
+	server.rotate(map[string]crypto.Signer{"2024": testECKey})
+	rotatedToken := signToken(t, "ES256", "2024", testECKey, validClaims(nil))
+
+	// Right after a refresh, unknown key ids are refused without fetching the JWKS again
+	principal, err := authenticator.Authenticate(bearerRequest(rotatedToken))
+	checkAuthentication(t, principal, err, "Invalid bearer token")
+	if fetches := server.fetchCount(); fetches != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", fetches)
+	}
+
+	now := TEST_NOW.Add(MIN_JWKS_REFRESH_INTERVAL)
+	authenticator.now = func() time.Time { return now }
+	principal, err = authenticator.Authenticate(bearerRequest(rotatedToken))
+	checkAuthentication(t, principal, err, "")
+	if fetches := server.fetchCount(); fetches != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", fetches)
+	}
+
+	// Keys rotated out are dropped, and don't refresh again so soon
+	principal, err = authenticator.Authenticate(bearerRequest(signToken(t, "RS256", "2023", testRSAKey, validClaims(nil))))
+	checkAuthentication(t, principal, err, "Invalid bearer token")
+	if fetches := server.fetchCount(); fetches != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", fetches)
+	}
+}
+
+func TestNewJWTAuthenticatorReadsFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		document []byte
+		wantErr bool
+	}{
+		{"JWKS", jwksOf(map[string]crypto.Signer{"rsa": testRSAKey}), false},
+		{"not JSON", []byte("keys"), true},
+		{"no signing keys", []byte(`{"keys": [{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"}]}`), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := ioutil.TempFile("", "jwks-*.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+			file.Write(test.document)
+			file.Close()
+
+			settings := TEST_JWT_SETTINGS
+			settings.JWKS = file.Name()
+			authenticator, err := NewJWTAuthenticator(context.Background(), settings)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewJWTAuthenticator() error = %v, want one: %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// The only key is taken for tokens without key ids
+			authenticator.now = func() time.Time { return TEST_NOW }
+			principal, err := authenticator.Authenticate(bearerRequest(signToken(t, "RS256", "", testRSAKey, validClaims(nil))))
+			checkAuthentication(t, principal, err, "")
+		})
+	}
+}
+
+func TestChainFallsBackToJWT(t *testing.T) {
+	server := newJWKSServer(map[string]crypto.Signer{"rsa": testRSAKey})
+	defer server.Close()
+	bootstrapKey := strings.Repeat("b", MIN_BOOTSTRAP_KEY_LENGTH)
+	chain := Chain{NewAPIKeyAuthenticator(model.NewMemoryAPIKeyStore(), bootstrapKey), newTestJWTAuthenticator(t, server)}
+	token := signToken(t, "RS256", "rsa", testRSAKey, validClaims(nil))
+
+	tests := []struct {
+		name string
+		apiKey string
+		token string
+		// Empty for anonymous requests
+		wantID string
+		wantErr bool
+	}{
+		{"bearer token", "", token, "jwt:reports", false},
+		{"API key", bootstrapKey, "", BOOTSTRAP_PRINCIPAL, false},
+		{"API key first", bootstrapKey, token, BOOTSTRAP_PRINCIPAL, false},
+		// Invalid credentials are refused, instead of trying the next authenticator
+		{"invalid API key", "pk_unknown_secret", token, "", true},
+		{"invalid bearer token", "", token + "x", "", true},
+		{"no credentials", "", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := bearerRequest(test.token)
+			if test.apiKey != "" {
+				request.Header.Set("X-API-Key", test.apiKey)
+			}
+
+			principal, err := chain.Authenticate(request)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Authenticate() error = %v, want one: %v", err, test.wantErr)
+			}
+			if err != nil && model.AsError(err).Code != model.CodeUnauthenticated {
+				t.Errorf("Authenticate() error code = %s, want %s", model.AsError(err).Code, model.CodeUnauthenticated)
+			}
+			gotID := ""
+			if principal != nil {
+				gotID = principal.ID
+			}
+			if gotID != test.wantID {
+				t.Errorf("Authenticate() principal = %q, want %q", gotID, test.wantID)
+			}
+		})
+	}
+
+	wantChallenges := []string{`ApiKey realm="planets-api"`, `Bearer realm="planets-api"`}
+	if challenges := chain.Challenges(); !reflect.DeepEqual(challenges, wantChallenges) {
+		t.Errorf("Challenges() = %v, want %v", challenges, wantChallenges)
+	}
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/*Permissions required by routes. Roles grant them*/
+const PERMISSION_READ string = "planets.read"
+const PERMISSION_EXPORT string = "planets.export"
+const PERMISSION_CREATE string = "planets.create"
+const PERMISSION_UPDATE string = "planets.update"
+const PERMISSION_DELETE string = "planets.delete"
+const PERMISSION_IMPORT string = "planets.import"
+const PERMISSION_AUDIT string = "planets.audit"
+const PERMISSION_ADMIN string = "admin"
+
+/*Grants every permission, including ones added later*/
+const PERMISSION_ALL string = "*"
+
+var PERMISSIONS = []string{
+	PERMISSION_READ, PERMISSION_EXPORT, PERMISSION_CREATE, PERMISSION_UPDATE,
+	PERMISSION_DELETE, PERMISSION_IMPORT, PERMISSION_AUDIT, PERMISSION_ADMIN, PERMISSION_ALL,
+}
+
+const ROLE_VIEWER string = "viewer"
+const ROLE_EDITOR string = "editor"
+const ROLE_ADMIN string = "admin"
+
+/*Roles seeded on startup. Viewer and editor may be changed later, admin can't*/
+var DEFAULT_ROLES = []model.Role{
+	{
+		Name: ROLE_VIEWER,
+		Description: "Lists and gets planets",
+		Permissions: []string{PERMISSION_READ},
+	},
+	{
+		Name: ROLE_EDITOR,
+		Description: "Also creates, updates and exports planets",
+		Permissions: []string{PERMISSION_READ, PERMISSION_EXPORT, PERMISSION_CREATE, PERMISSION_UPDATE},
+	},
+	{
+		Name: ROLE_ADMIN,
+		Description: "Does everything, including deletes, imports, audits and admin routes",
+		Permissions: []string{PERMISSION_ALL},
+	},
+}
+
+/*Role acted as by credentials without a user, by scope. Credentials of users can't go beyond these roles either*/
+var SCOPE_ROLES = map[string]string{
+	SCOPE_READ: ROLE_VIEWER,
+	SCOPE_WRITE: ROLE_EDITOR,
+	SCOPE_ADMIN: ROLE_ADMIN,
+}
+
+func ValidPermission(permission string) bool {
+	for _, known := range PERMISSIONS {
+		if permission == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*permissionSet ... Permissions granted by a set of roles*/
+type permissionSet map[string]bool
+
+func (permissions permissionSet) has(permission string) bool {
+	return permissions[PERMISSION_ALL] || permissions[permission]
+}
+
+
+/* Authorization */
+
+/*Authorizer ... Decides whether principals have the permission a route requires, from the roles stored in an AccessStore*/
+type Authorizer struct {
+	store model.AccessStore
+	// Role of requests without credentials. Empty makes them need credentials
+	anonymousRole string
+}
+
+func NewAuthorizer(store model.AccessStore, anonymousRole string) *Authorizer {
+	return &Authorizer{store: store, anonymousRole: anonymousRole}
+}
+
+/*Authorize fails with an Error coded forbidden when principal lacks permission. nil principals are anonymous.
+Principals of users act by the roles of their user, limited by their scopes. Other principals act by their scopes*/
+func (authorizer *Authorizer) Authorize(ctx context.Context, principal *Principal, permission string) error {
+	var roleNames []string
+	switch {
+	case principal == nil:
+		if authorizer.anonymousRole != "" {
+			roleNames = []string{authorizer.anonymousRole}
+		}
+	case principal.UserID != "":
+		user, err := authorizer.store.GetUser(ctx, principal.UserID)
+		if errors.Is(err, model.ErrUserNotFound) {
+			return forbidden("User " + principal.UserID + " no longer exists", permission, nil)
+		}
+		if err != nil {
+			return err
+		}
+		if user.Disabled {
+			return forbidden("User " + user.ID + " is disabled", permission, user.Roles)
+		}
+		roleNames = user.Roles
+	default:
+		roleNames = scopeRoles(principal.Scopes)
+	}
+
+	granted, err := authorizer.permissionsOf(ctx, roleNames)
+	if err != nil {
+		return err
+	}
+	if !granted.has(permission) {
+		return forbidden("Missing permission " + permission, permission, roleNames)
+	}
+
+	if principal != nil && principal.UserID != "" && len(principal.Scopes) > 0 {
+		ceiling, err := authorizer.permissionsOf(ctx, scopeRoles(principal.Scopes))
+		if err != nil {
+			return err
+		}
+		if !ceiling.has(permission) {
+			return forbidden("Scopes of the credentials don't allow " + permission, permission, roleNames)
+		}
+	}
+
+	return nil
+}
+
+func (authorizer *Authorizer) permissionsOf(ctx context.Context, roleNames []string) (permissionSet, error) {
+	permissions := permissionSet{}
+	roles, err := authorizer.store.GetRoles(ctx, roleNames)
+	if err != nil {
+		return permissions, err
+	}
+
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			permissions[permission] = true
+		}
+	}
+	return permissions, nil
+}
+
+func scopeRoles(scopes []string) []string {
+	var roleNames []string
+	for _, scope := range scopes {
+		if roleName, found := SCOPE_ROLES[scope]; found {
+			roleNames = append(roleNames, roleName)
+		}
+	}
+
+	return roleNames
+}
+
+func forbidden(message, permission string, roleNames []string) *model.Error {
+	if roleNames == nil {
+		roleNames = []string{}
+	}
+
+	return model.NewError(
+		model.CodeForbidden,
+		message,
+		map[string]interface{}{"requiredPermission": permission, "roles": roleNames},
+	)
+}
+
+
+/* Users and roles */
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+/*SaveUser creates or replaces user, once its roles are known. Returns the user saved*/
+func SaveUser(ctx context.Context, store model.AccessStore, user model.User) (model.User, error) {
+	if !validName.MatchString(user.ID) {
+		return user, model.NewError(
+			model.CodeValidation,
+			"User id must have up to 64 lower case letters, digits, dots, dashes or underscores",
+			map[string]interface{}{"id": user.ID},
+		)
+	}
+	if len(user.Roles) == 0 {
+		return user, model.NewError(model.CodeValidation, "At least one role is required", nil)
+	}
+	roles, err := store.GetRoles(ctx, user.Roles)
+	if err != nil {
+		return user, err
+	}
+	if len(roles) != len(uniqueStrings(user.Roles)) {
+		return user, model.NewError(
+			model.CodeValidation,
+			"Unknown role in " + strings.Join(user.Roles, ", "),
+			map[string]interface{}{"roles": user.Roles},
+		)
+	}
+
+	now := time.Now().UTC()
+	user.Name = strings.TrimSpace(user.Name)
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	if current, err := store.GetUser(ctx, user.ID); err == nil {
+		user.CreatedAt = current.CreatedAt
+	} else if !errors.Is(err, model.ErrUserNotFound) {
+		return user, err
+	}
+
+	return user, store.SaveUser(ctx, user)
+}
+
+/*SaveRole creates or replaces role, once its permissions are known. The admin role can't be changed, so admins can't be locked out*/
+func SaveRole(ctx context.Context, store model.AccessStore, role model.Role) (model.Role, error) {
+	if role.Name == ROLE_ADMIN {
+		return role, model.NewError(model.CodeValidation, "The admin role can't be changed", nil)
+	}
+	if !validName.MatchString(role.Name) {
+		return role, model.NewError(
+			model.CodeValidation,
+			"Role name must have up to 64 lower case letters, digits, dots, dashes or underscores",
+			map[string]interface{}{"name": role.Name},
+		)
+	}
+	for _, permission := range role.Permissions {
+		if !ValidPermission(permission) {
+			return role, model.NewError(
+				model.CodeValidation,
+				"Unknown permission " + permission,
+				map[string]interface{}{"validPermissions": PERMISSIONS},
+			)
+		}
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+
+	return role, store.SaveRole(ctx, role)
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,412 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/auth"
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/ratelimit"
+)
+
+
+/*Config ... Every setting of the API. Built by Load, from defaults, a config file, environment variables and flags*/
+type Config struct {
+	Server ServerConfig
+	Database DatabaseConfig
+	SWAPI SWAPIConfig
+	Health HealthConfig
+	Log LogConfig
+	Auth AuthConfig
+	RateLimit RateLimitConfig
+	Trash TrashConfig
+}
+
+type ServerConfig struct {
+	Host string
+	Port string
+	// Served under /static/. Must hold home.html
+	StaticDir string
+	RequestTimeout time.Duration
+	ShutdownTimeout time.Duration
+}
+
+type DatabaseConfig struct {
+	// mongo or memory. Other database settings only matter for mongo
+	Storage string
+	// Replaces Host, Port, User and Password when informed
+	URI string
+	Host string
+	Port string
+	User string
+	Password string
+	// Read into Password, for secrets mounted as files
+	PasswordFile string
+	Name string
+	Collection string
+	ConnectTimeout time.Duration
+	TLS TLSConfig
+}
+
+type TLSConfig struct {
+	Enabled bool
+	// PEM bundle of authorities trusted besides the system ones
+	CAFile string
+	// PEM client certificate and key, for x509 authentication
+	CertFile string
+	KeyFile string
+	// Skips verification of the server certificate. Only for development
+	Insecure bool
+}
+
+type SWAPIConfig struct {
+	URL string
+	Timeout time.Duration
+	Retries int
+	CacheSize int
+	CacheTTL time.Duration
+	NegativeCacheTTL time.Duration
+	CachePersistent bool
+	SyncInterval time.Duration
+}
+
+type HealthConfig struct {
+	ReadinessTimeout time.Duration
+	ReadinessChecksSWAPI bool
+}
+
+type LogConfig struct {
+	Level string
+}
+
+type AuthConfig struct {
+	// Disabling it leaves every route open. Only for development
+	Enabled bool
+	// Lets requests without credentials read planets
+	AnonymousReads bool
+	// Admin key that needs no database, for issuing the first keys
+	BootstrapKey string
+	JWT JWTConfig
+}
+
+type JWTConfig struct {
+	// File path or http(s) URL. Empty refuses bearer tokens
+	JWKS string
+	RefreshInterval time.Duration
+	Issuer string
+	Audience string
+	ScopesClaim string
+	// Comma separated provider_scope=api_scope pairs
+	ScopeMap string
+	Leeway time.Duration
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	// Comma separated route=limit pairs, like default=300/m,CreatePlanet=30/m:10
+	Limits string
+	// Requests each client may send per UTC day. 0 disables quotas
+	DailyQuota int
+	// Only behind a proxy that sets X-Forwarded-For
+	TrustForwardedFor bool
+}
+
+type TrashConfig struct {
+	// How long deleted planets stay restorable. 0 keeps them forever
+	Retention time.Duration
+	PurgeInterval time.Duration
+}
+
+var STORAGES = []string{"mongo", "memory"}
+
+/*ProblemsError ... Every problem found while loading a config, so they can all be fixed at once*/
+type ProblemsError struct {
+	Problems []string
+}
+
+func (problemsError *ProblemsError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(problemsError.Problems, "\n  - ")
+}
+
+
+/* Validation */
+
+/*Validate lists every setting that can't work, besides reading the password file*/
+func (config *Config) Validate() []string {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Server
+	if !validPort(config.Server.Port) {
+		problem("port must be a number from 1 to 65535, got %q", config.Server.Port)
+	}
+	if info, err := os.Stat(config.Server.StaticDir); err != nil || !info.IsDir() {
+		problem("static_dir %q is not a directory", config.Server.StaticDir)
+	} else if _, err := os.Stat(filepath.Join(config.Server.StaticDir, "home.html")); err != nil {
+		problem("static_dir %q has no home.html", config.Server.StaticDir)
+	}
+	if config.Server.RequestTimeout < 0 {
+		problem("request_timeout can't be negative")
+	}
+	if config.Server.ShutdownTimeout <= 0 {
+		problem("shutdown_timeout must be positive")
+	}
+
+	// Database
+	database := &config.Database
+	switch database.Storage {
+	case "mongo":
+		problems = append(problems, database.validate()...)
+	case "memory":
+		if config.SWAPI.CachePersistent {
+			problem("swapi_cache_persistent needs mongo storage")
+		}
+	default:
+		problem("storage must be one of %s, got %q", strings.Join(STORAGES, ", "), database.Storage)
+	}
+
+	// SWAPI
+	if swapiURL, err := url.Parse(config.SWAPI.URL); err != nil || (swapiURL.Scheme != "http" && swapiURL.Scheme != "https") || swapiURL.Host == "" {
+		problem("swapi_url must be an http or https URL, got %q", config.SWAPI.URL)
+	}
+	if config.SWAPI.Timeout <= 0 {
+		problem("swapi_timeout must be positive")
+	}
+	if config.SWAPI.Retries < 0 {
+		problem("swapi_retries can't be negative")
+	}
+	if config.SWAPI.CacheSize < 0 {
+		problem("swapi_cache_size can't be negative")
+	}
+	if config.SWAPI.CacheTTL <= 0 || config.SWAPI.NegativeCacheTTL <= 0 {
+		problem("swapi_cache_ttl and swapi_negative_cache_ttl must be positive")
+	}
+	if config.SWAPI.SyncInterval < 0 {
+		problem("sync_interval can't be negative")
+	}
+
+	// Health and logs
+	if config.Health.ReadinessTimeout <= 0 {
+		problem("readiness_timeout must be positive")
+	}
+	if _, err := logging.ParseLevel(config.Log.Level); err != nil {
+		problem("log_level must be one of %s, got %q", strings.Join(logging.LEVEL_NAMES, ", "), config.Log.Level)
+	}
+
+	// Auth
+	if config.Auth.BootstrapKey != "" && len(config.Auth.BootstrapKey) < auth.MIN_BOOTSTRAP_KEY_LENGTH {
+		problem("auth_bootstrap_key must have at least %d characters", auth.MIN_BOOTSTRAP_KEY_LENGTH)
+	}
+	if strings.HasPrefix(config.Auth.BootstrapKey, auth.KEY_PREFIX) {
+		problem("auth_bootstrap_key can't start with %s, which is kept for issued keys", auth.KEY_PREFIX)
+	}
+	if config.Auth.JWT.JWKS != "" {
+		problems = append(problems, config.Auth.JWT.validate()...)
+	}
+
+	// Rate limits
+	if _, err := ratelimit.ParseLimits(config.RateLimit.Limits); err != nil {
+		problem("rate_limits: %v", err)
+	}
+	if config.RateLimit.DailyQuota < 0 {
+		problem("rate_limit_daily_quota can't be negative")
+	}
+
+	// Trash
+	if config.Trash.Retention < 0 {
+		problem("trash_retention can't be negative")
+	}
+	if config.Trash.Retention > 0 && config.Trash.PurgeInterval <= 0 {
+		problem("trash_purge_interval must be positive when trash_retention is set")
+	}
+
+	return problems
+}
+
+func (database *DatabaseConfig) validate() []string {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if database.URI != "" {
+		if !strings.HasPrefix(database.URI, "mongodb://") && !strings.HasPrefix(database.URI, "mongodb+srv://") {
+			problem("db_uri must start with mongodb:// or mongodb+srv://")
+		}
+	} else {
+		if database.Host == "" {
+			problem("db_host is required, unless db_uri is informed")
+		}
+		if !validPort(database.Port) {
+			problem("db_port must be a number from 1 to 65535, got %q", database.Port)
+		}
+		if database.Password != "" && database.PasswordFile != "" {
+			problem("inform either db_password or db_password_file, not both")
+		}
+		if database.User != "" && database.Password == "" && database.PasswordFile == "" {
+			problem("db_user %q needs db_password or db_password_file", database.User)
+		}
+	}
+	if database.Name == "" || database.Collection == "" {
+		problem("database_name and collection_name are required")
+	}
+	if database.ConnectTimeout <= 0 {
+		problem("db_connect_timeout must be positive")
+	}
+
+	tlsConfig := database.TLS
+	if !tlsConfig.Enabled && (tlsConfig.CAFile != "" || tlsConfig.CertFile != "" || tlsConfig.KeyFile != "" || tlsConfig.Insecure) {
+		problem("db_tls_* settings need db_tls = true")
+	}
+	if (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+		problem("db_tls_cert_file and db_tls_key_file must be informed together")
+	}
+	if tlsConfig.Enabled {
+		if _, err := tlsConfig.Build(); err != nil {
+			problem("%v", err)
+		}
+	}
+
+	return problems
+}
+
+func (jwtConfig *JWTConfig) validate() []string {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if strings.HasPrefix(jwtConfig.JWKS, "http://") || strings.HasPrefix(jwtConfig.JWKS, "https://") {
+		if jwksURL, err := url.Parse(jwtConfig.JWKS); err != nil || jwksURL.Host == "" {
+			problem("auth_jwt_jwks is not a valid URL: %q", jwtConfig.JWKS)
+		}
+	} else if _, err := os.Stat(jwtConfig.JWKS); err != nil {
+		problem("auth_jwt_jwks must be an http or https URL, or an existing file: %v", err)
+	}
+	if jwtConfig.Issuer == "" || jwtConfig.Audience == "" {
+		problem("auth_jwt_issuer and auth_jwt_audience are required along with auth_jwt_jwks")
+	}
+	if jwtConfig.ScopesClaim == "" {
+		problem("auth_jwt_scopes_claim can't be empty")
+	}
+	if _, err := jwtConfig.scopeMap(); err != nil {
+		problem("%v", err)
+	}
+	if jwtConfig.RefreshInterval <= 0 {
+		problem("auth_jwt_jwks_refresh must be positive")
+	}
+	if jwtConfig.Leeway < 0 {
+		problem("auth_jwt_leeway can't be negative")
+	}
+
+	return problems
+}
+
+func (jwtConfig JWTConfig) scopeMap() (map[string]string, error) {
+	scopeMap := map[string]string{}
+	for _, pair := range strings.Split(jwtConfig.ScopeMap, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("auth_jwt_scope_map must look like provider_scope=planets:read, got %q", pair)
+		}
+		scope := strings.TrimSpace(parts[1])
+		if !auth.ValidScope(scope) {
+			return nil, fmt.Errorf("auth_jwt_scope_map maps to unknown scope %q. Options: %s", scope, strings.Join(auth.SCOPES, ", "))
+		}
+		scopeMap[strings.TrimSpace(parts[0])] = scope
+	}
+
+	return scopeMap, nil
+}
+
+func validPort(port string) bool {
+	number, err := strconv.Atoi(port)
+	return err == nil && number > 0 && number < 65536
+}
+
+
+/* Conversions */
+
+/*Build loads the certificates of tlsConfig. nil when TLS is disabled*/
+func (tlsConfig TLSConfig) Build() (*tls.Config, error) {
+	if !tlsConfig.Enabled {
+		return nil, nil
+	}
+
+	built := &tls.Config{InsecureSkipVerify: tlsConfig.Insecure}
+	if tlsConfig.CAFile != "" {
+		pem, err := ioutil.ReadFile(tlsConfig.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read db_tls_ca_file: %w", err)
+		}
+		built.RootCAs, err = x509.SystemCertPool()
+		if err != nil || built.RootCAs == nil {
+			built.RootCAs = x509.NewCertPool()
+		}
+		if !built.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("db_tls_ca_file %s has no PEM certificates", tlsConfig.CAFile)
+		}
+	}
+	if tlsConfig.CertFile != "" && tlsConfig.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load db_tls_cert_file and db_tls_key_file: %w", err)
+		}
+		built.Certificates = []tls.Certificate{certificate}
+	}
+
+	return built, nil
+}
+
+/*MongoSettings converts database into what model.MongoDBConnect takes. Must be called on validated configs*/
+func (database DatabaseConfig) MongoSettings() (model.MongoSettings, error) {
+	tlsConfig, err := database.TLS.Build()
+
+	return model.MongoSettings{
+		URI: database.URI,
+		Host: database.Host,
+		Port: database.Port,
+		User: database.User,
+		Password: database.Password,
+		DatabaseName: database.Name,
+		CollectionName: database.Collection,
+		ConnectTimeout: database.ConnectTimeout,
+		TLS: tlsConfig,
+	}, err
+}
+
+/*Settings converts jwtConfig into what auth.NewJWTAuthenticator takes. Must be called on validated configs*/
+func (jwtConfig JWTConfig) Settings() auth.JWTSettings {
+	scopeMap, _ := jwtConfig.scopeMap()
+
+	return auth.JWTSettings{
+		JWKS: jwtConfig.JWKS,
+		Issuer: jwtConfig.Issuer,
+		Audience: jwtConfig.Audience,
+		ScopesClaim: jwtConfig.ScopesClaim,
+		ScopeMap: scopeMap,
+		Leeway: jwtConfig.Leeway,
+		FetchTimeout: 10 * time.Second,
+	}
+}
+
+/*RouteLimits parses the limits of rateLimit, by route name. Must be called on validated configs*/
+func (rateLimit RateLimitConfig) RouteLimits() map[string]ratelimit.Limit {
+	limits, _ := ratelimit.ParseLimits(rateLimit.Limits)
+	return limits
+}
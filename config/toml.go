@@ -0,0 +1,133 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+
+/*entry ... key = value line of a config file. Keys are prefixed by their table, like database.host*/
+type entry struct {
+	key string
+	// Strings unquoted. Numbers and booleans as written
+	text string
+	line int
+}
+
+var tomlKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+var tomlBare = regexp.MustCompile(`^(true|false|[+-]?[0-9][0-9_]*)$`)
+
+/*parseTOML reads the TOML subset used by config files: [tables], key = value lines and # comments.
+Values are strings, integers or booleans. Returns the entries read, and one problem per bad line*/
+func parseTOML(reader io.Reader, fileName string) ([]entry, []string) {
+	var entries []entry
+	var problems []string
+	problem := func(line int, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s:%d: ", fileName, line) + fmt.Sprintf(format, args...))
+	}
+
+	table := ""
+	seen := map[string]int{}
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			closing := strings.Index(text, "]")
+			if closing < 0 || strings.TrimSpace(stripComment(text[closing+1:])) != "" {
+				problem(line, "expected [table]")
+				continue
+			}
+			table = strings.TrimSpace(text[1:closing])
+			if !tomlKey.MatchString(table) {
+				problem(line, "invalid table name %q", table)
+			}
+			continue
+		}
+
+		equals := strings.Index(text, "=")
+		if equals < 0 {
+			problem(line, "expected key = value")
+			continue
+		}
+		key := strings.TrimSpace(text[:equals])
+		if !tomlKey.MatchString(key) {
+			problem(line, "invalid key %q", key)
+			continue
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+
+		value, err := parseTOMLValue(strings.TrimSpace(text[equals+1:]))
+		if err != nil {
+			problem(line, "%s: %v", key, err)
+			continue
+		}
+		if firstLine, found := seen[key]; found {
+			problem(line, "%s is already set on line %d", key, firstLine)
+			continue
+		}
+		seen[key] = line
+
+		entries = append(entries, entry{key: key, text: value, line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, fmt.Sprintf("%s: %v", fileName, err))
+	}
+
+	return entries, problems
+}
+
+/*parseTOMLValue reads a "basic string", a 'literal string', an integer or a boolean, followed by an optional comment*/
+func parseTOMLValue(text string) (string, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		for end := 1; end < len(text); end++ {
+			if text[end] == '\\' {
+				end++
+				continue
+			}
+			if text[end] == '"' {
+				if strings.TrimSpace(stripComment(text[end+1:])) != "" {
+					return "", fmt.Errorf("unexpected text after string")
+				}
+				unquoted, err := strconv.Unquote(text[:end+1])
+				if err != nil {
+					return "", fmt.Errorf("invalid string %s", text[:end+1])
+				}
+				return unquoted, nil
+			}
+		}
+		return "", fmt.Errorf("unterminated string")
+	case strings.HasPrefix(text, "'"):
+		end := strings.Index(text[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if strings.TrimSpace(stripComment(text[end+2:])) != "" {
+			return "", fmt.Errorf("unexpected text after string")
+		}
+		return text[1 : end+1], nil
+	}
+
+	bare := strings.TrimSpace(stripComment(text))
+	if !tomlBare.MatchString(bare) {
+		return "", fmt.Errorf("expected a quoted string, an integer or true/false, got %q", bare)
+	}
+	return strings.Replace(bare, "_", "", -1), nil
+}
+
+func stripComment(text string) string {
+	if comment := strings.Index(text, "#"); comment >= 0 {
+		return text[:comment]
+	}
+	return text
+}
@@ -0,0 +1,90 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+	"github.com/HosanaUFRRJ2014/planets-api/swapi"
+)
+
+
+/*Guards against SWAPI pages pointing back to each other*/
+const MAX_PAGES int = 1000
+
+/*Report ... Summary of an import*/
+type Report struct {
+	Pages int `json:"pages"`
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Failed int `json:"failed"`
+	Errors []string `json:"errors"`
+}
+
+/*Maps a SWAPI planet onto our planet. Names are prepared by planet.UpsertPlanet*/
+func toPlanet(swapiPlanet swapi.SWAPIPlanet) model.Planet {
+	return model.Planet{
+		Name: swapiPlanet.Name,
+		Climate: swapiPlanet.Climate,
+		Terrain: swapiPlanet.Terrain,
+		AppearencesCount: len(swapiPlanet.Films),
+		PlanetSwapiURL: swapiPlanet.URL,
+		SwapiStatus: string(swapi.Resolved),
+		SwapiMatchConfidence: string(swapi.MatchExact),
+	}
+}
+
+/*ImportSWAPIPlanets walks every SWAPI planets page and upserts each planet by name.
+A failing page aborts the import. Failing planets are reported and skipped*/
+func ImportSWAPIPlanets(ctx context.Context, swapiClient swapi.SWAPIClient) (Report, error) {
+	report := Report{Errors: []string{}}
+	visited := map[string]bool{}
+
+	// The first page is asked with an empty URL
+	pageURL := ""
+	for {
+		if visited[pageURL] || report.Pages >= MAX_PAGES {
+			return report, fmt.Errorf("SWAPI pagination loops at %s", pageURL)
+		}
+		visited[pageURL] = true
+
+		response, err := swapiClient.GetPlanetsPage(ctx, pageURL)
+		if err != nil {
+			return report, err
+		}
+		report.Pages++
+
+		for _, swapiPlanet := range response.Planets {
+			result, err := planet.UpsertPlanet(ctx, toPlanet(swapiPlanet))
+
+			switch result {
+			case model.UpsertCreated:
+				report.Created++
+			case model.UpsertUpdated:
+				report.Updated++
+			case model.UpsertUnchanged:
+				report.Unchanged++
+			default:
+				report.Failed++
+				report.Errors = append(report.Errors, swapiPlanet.Name + ": " + err.Error())
+			}
+		}
+
+		pageURL = response.Next
+		if pageURL == "" {
+			break
+		}
+	}
+
+	logging.Info(ctx, "Imported SWAPI planets", logging.Fields{
+		"created": report.Created,
+		"updated": report.Updated,
+		"unchanged": report.Unchanged,
+		"failed": report.Failed,
+	})
+
+	return report, nil
+}
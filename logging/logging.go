@@ -0,0 +1,183 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+
+/*Level ... How severe a log line is. Lines below the configured level are dropped*/
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var LEVEL_NAMES = []string{"debug", "info", "warn", "error"}
+
+var ErrUnknownLevel = errors.New("unknown log level. Valid options: " + strings.Join(LEVEL_NAMES, ", "))
+
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range LEVEL_NAMES {
+		if strings.EqualFold(name, levelName) {
+			return Level(level), nil
+		}
+	}
+
+	return LevelInfo, ErrUnknownLevel
+}
+
+func (level Level) String() string {
+	if level < LevelDebug || level > LevelError {
+		return "unknown"
+	}
+
+	return LEVEL_NAMES[level]
+}
+
+/*Fields ... Extra keys of a log line. Errors are logged by their message*/
+type Fields map[string]interface{}
+
+var mutex sync.Mutex
+
+/*Where log lines are written. Must be set with UseOutput, if not stderr*/
+var output io.Writer = os.Stderr
+
+/*Lowest level logged. Must be set with UseLevel, if not info*/
+var minLevel Level = LevelInfo
+
+func UseOutput(writer io.Writer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	output = writer
+}
+
+func UseLevel(level Level) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	minLevel = level
+}
+
+func Enabled(level Level) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return level >= minLevel
+}
+
+
+/* Request IDs */
+
+type requestIDKey struct{}
+
+/*WithRequestID returns a copy of ctx carrying requestID, added to every line logged with it*/
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+/*RequestID returns the request ID carried by ctx. Empty outside requests*/
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+
+/* Logging */
+
+func Debug(ctx context.Context, message string, fields Fields) {
+	Log(ctx, LevelDebug, message, fields)
+}
+
+func Info(ctx context.Context, message string, fields Fields) {
+	Log(ctx, LevelInfo, message, fields)
+}
+
+func Warn(ctx context.Context, message string, fields Fields) {
+	Log(ctx, LevelWarn, message, fields)
+}
+
+func Error(ctx context.Context, message string, fields Fields) {
+	Log(ctx, LevelError, message, fields)
+}
+
+/*Log writes a JSON line with time, level, msg, the request ID of ctx, if any, and fields sorted by key*/
+func Log(ctx context.Context, level Level, message string, fields Fields) {
+	if !Enabled(level) {
+		return
+	}
+
+	var line bytes.Buffer
+	line.WriteString(`{"time":`)
+	writeValue(&line, time.Now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"level":`)
+	writeValue(&line, level.String())
+	line.WriteString(`,"msg":`)
+	writeValue(&line, message)
+	if requestID := RequestID(ctx); requestID != "" {
+		line.WriteString(`,"requestId":`)
+		writeValue(&line, requestID)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		line.WriteString(",")
+		writeValue(&line, key)
+		line.WriteString(":")
+		writeValue(&line, fields[key])
+	}
+	line.WriteString("}\n")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	output.Write(line.Bytes())
+}
+
+/*writeValue writes value as JSON. Values that can't be encoded are written as strings*/
+func writeValue(line *bytes.Buffer, value interface{}) {
+	if err, isError := value.(error); isError {
+		value = err.Error()
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	line.Write(encoded)
+}
+
+
+/* Standard logger */
+
+/*stdWriter ... Turns lines of the standard log package into log lines of level*/
+type stdWriter struct {
+	level Level
+}
+
+/*StdWriter is meant for log.SetOutput, so code still logging with the standard log package writes JSON lines too*/
+func StdWriter(level Level) io.Writer {
+	return stdWriter{level: level}
+}
+
+func (writer stdWriter) Write(line []byte) (int, error) {
+	Log(context.Background(), writer.level, strings.TrimSpace(string(line)), nil)
+	return len(line), nil
+}
@@ -1,90 +1,446 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/HosanaUFRRJ2014/planets-api/config"
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
 	"github.com/HosanaUFRRJ2014/planets-api/model"
 	"github.com/HosanaUFRRJ2014/planets-api/api"
+	"github.com/HosanaUFRRJ2014/planets-api/auth"
+	"github.com/HosanaUFRRJ2014/planets-api/importer"
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+	"github.com/HosanaUFRRJ2014/planets-api/ratelimit"
+	"github.com/HosanaUFRRJ2014/planets-api/scheduler"
+	"github.com/HosanaUFRRJ2014/planets-api/swapi"
+	"github.com/HosanaUFRRJ2014/planets-api/transfer"
 )
 
-type Config struct {
-	name string
-	defaultValue string
-	usage string
-	valuePtr *string
+/*How long shutdowns wait for the database to disconnect*/
+const DISCONNECT_TIMEOUT time.Duration = 10 * time.Second
+
+/*Actor of changes to planets made by commands, on the audit log*/
+var CLI_ACTOR = model.Actor{ID: "cli"}
+
+/*Creates the uncached SWAPI client*/
+func makeSWAPIClient(swapiConfig config.SWAPIConfig) *swapi.HTTPClient {
+	return swapi.NewHTTPClient(swapiConfig.URL, swapiConfig.Timeout, swapiConfig.Retries)
 }
 
+/*Wraps httpClient with the configured cache. cacheStore may be nil*/
+func cacheSWAPIClient(swapiConfig config.SWAPIConfig, httpClient *swapi.HTTPClient, cacheStore swapi.CacheStore) swapi.SWAPIClient {
+	var swapiClient swapi.SWAPIClient = httpClient
 
-func parseArgs(configs map[string]*Config) {
-	for name, mapping := range configs {
-		var valuePtr = flag.String(
-			name,
-			mapping.defaultValue,
-			mapping.usage,
+	if swapiConfig.CacheSize > 0 {
+		swapiClient = swapi.NewCachedClient(
+			httpClient,
+			swapiConfig.CacheSize,
+			swapiConfig.CacheTTL,
+			swapiConfig.NegativeCacheTTL,
+			cacheStore,
 		)
+	}
 
-		mapping.valuePtr = valuePtr
+	return swapiClient
+}
+
+/*Imports every SWAPI planet into the configured storage and prints the report*/
+func seed(ctx context.Context, swapiClient swapi.SWAPIClient) error {
+	report, err := importer.ImportSWAPIPlanets(ctx, swapiClient)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "\t")
+	encoder.Encode(report)
+
+	if err != nil {
+		return fmt.Errorf("import stopped before the last SWAPI page: %w", err)
 	}
+	return nil
 }
 
 
 func main() {
-	var configs map[string]*Config
-	configs = map[string]*Config{
-		"host": &Config{
-			name:"host",
-			defaultValue:"127.0.0.1",
-			usage:"Host which this API will be running.",
-		},
-		"port": &Config{
-			name:"port",
-			defaultValue:"5555",
-			usage:"Port which this API will be running.",
-		},
-		"db_host": &Config{
-			name:"db_host",
-			defaultValue:"localhost",
-			usage:"Host where this API's database will be running.",
-		},
-		"db_port": &Config{
-			name:"db_port",
-			defaultValue:"27017",
-			usage:"Port where this API's database will be running.",
-		},
-		"db_user": &Config{
-			name:"db_user",
-			defaultValue:"planetsapi",
-			usage:"User of this API's database.",
-		},
-		"database_name": &Config{
-			name:"database_name",
-			defaultValue:"planets",
-			usage:"Database's name of this API's database.",
-		},
-		"db_password": &Config{
-			name:"db_password",
-			defaultValue:"e5e66467-8b00-421a-af8c-00a08e038f04",
-			usage:"Password of this API's database.",
-		},
-		"collection_name": &Config{
-			name:"collection_name",
-			defaultValue:"planets",
-			usage:"Collections's name of this API's database.",
-		},
-	}
-
-	parseArgs(configs)
-	flag.Parse()
-
-
-	client := model.MongoDBConnect(
-		*configs["db_host"].valuePtr,
-		*configs["db_port"].valuePtr,
-		*configs["db_user"].valuePtr,
-		*configs["db_password"].valuePtr,
-		*configs["database_name"].valuePtr,
-		*configs["collection_name"].valuePtr,
-	)
-	defer model.MongoDBDisconnect(client)
-
-	api.HandleRequests(*configs["host"].valuePtr, *configs["port"].valuePtr)
+	os.Exit(run())
+}
+
+/*contextUntilSignal is done on the first interrupt or termination signal, or once cancelled. A second signal exits right away*/
+func contextUntilSignal() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		received := <-signals
+		logging.Info(ctx, "Stopping", logging.Fields{"signal": received.String()})
+		cancel()
+
+		received = <-signals
+		logging.Warn(ctx, "Stopping right away", logging.Fields{"signal": received.String()})
+		os.Exit(1)
+	}()
+
+	return ctx, cancel
+}
+
+/*run starts the API, or runs the command informed, returning the exit code. Resources are released before returning*/
+func run() int {
+	configs, args, err := config.Load(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	logLevel, _ := logging.ParseLevel(configs.Log.Level)
+	logging.UseLevel(logLevel)
+	// Lines still logged with the log package become JSON lines too
+	log.SetFlags(0)
+	log.SetOutput(logging.StdWriter(logging.LevelInfo))
+
+	ctx, stop := contextUntilSignal()
+	defer stop()
+
+
+	var cacheStore swapi.CacheStore
+	var apiKeyStore model.APIKeyStore
+	var accessStore model.AccessStore
+	var quotaStore ratelimit.QuotaStore
+	var auditStore model.AuditStore
+
+	switch configs.Database.Storage {
+	case "memory":
+		log.Println("Storing planets in memory. They will be lost on exit")
+		auditStore = model.NewMemoryAuditStore()
+		planet.UseRepository(model.NewAuditedRepository(model.NewInstrumentedRepository(model.NewMemoryRepository()), auditStore))
+		apiKeyStore = model.NewMemoryAPIKeyStore()
+		accessStore = model.NewMemoryAccessStore()
+		quotaStore = ratelimit.NewMemoryQuotaStore()
+	case "mongo":
+		settings, err := configs.Database.MongoSettings()
+		var client *mongo.Client
+		var collection *mongo.Collection
+		if err == nil {
+			client, collection, err = model.MongoDBConnect(ctx, settings)
+		}
+		if err != nil {
+			logging.Error(ctx, "Could not start", logging.Fields{"error": err})
+			return 1
+		}
+		// Runs after the server drained, so requests in flight can still write
+		defer func() {
+			disconnectCtx, cancel := context.WithTimeout(context.Background(), DISCONNECT_TIMEOUT)
+			defer cancel()
+			if err := model.MongoDBDisconnect(disconnectCtx, client); err != nil {
+				log.Println(err)
+			}
+		}()
+		auditStore = model.NewMongoAuditStore(ctx, collection.Database().Collection("planet_audit"))
+		planet.UseRepository(model.NewAuditedRepository(model.NewInstrumentedRepository(model.NewMongoRepository(collection)), auditStore))
+		apiKeyStore = model.NewMongoAPIKeyStore(collection.Database().Collection("api_keys"))
+		accessStore = model.NewMongoAccessStore(ctx, collection.Database())
+		quotaStore = model.NewMongoQuotaStore(ctx, collection.Database().Collection("quotas"))
+		if configs.SWAPI.CachePersistent {
+			cacheStore = model.NewMongoCacheStore(ctx, collection.Database().Collection("swapi_cache"))
+		}
+	}
+
+	// Stored roles are kept, so admins can change them
+	if err := accessStore.SeedRoles(ctx, auth.DEFAULT_ROLES); err != nil {
+		logging.Error(ctx, "Could not seed roles", logging.Fields{"error": err})
+		return 1
+	}
+
+	httpClient := makeSWAPIClient(configs.SWAPI)
+	swapiClient := cacheSWAPIClient(configs.SWAPI, httpClient, cacheStore)
+
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "":
+		api.UseSWAPIClient(swapiClient)
+
+		api.UseAPIKeyStore(apiKeyStore)
+		api.UseAccessStore(accessStore)
+		api.UseAuditStore(auditStore)
+		if configs.Auth.Enabled {
+			anonymousRole := ""
+			if configs.Auth.AnonymousReads {
+				anonymousRole = auth.ROLE_VIEWER
+			}
+			authenticators := auth.Chain{auth.NewAPIKeyAuthenticator(apiKeyStore, configs.Auth.BootstrapKey)}
+			if configs.Auth.JWT.JWKS != "" {
+				jwtAuthenticator, err := auth.NewJWTAuthenticator(ctx, configs.Auth.JWT.Settings())
+				if err != nil {
+					logging.Error(ctx, "Could not start", logging.Fields{"error": err})
+					return 1
+				}
+				go jwtAuthenticator.RefreshEvery(ctx, configs.Auth.JWT.RefreshInterval)
+				authenticators = append(authenticators, jwtAuthenticator)
+			}
+			api.UseAuth(authenticators, auth.NewAuthorizer(accessStore, anonymousRole))
+		} else {
+			logging.Warn(ctx, "Authentication is disabled. Every route is open", nil)
+		}
+		if configs.RateLimit.Enabled {
+			// Buckets are kept per instance. Quotas are shared through the database
+			api.UseRateLimits(ratelimit.NewMemoryLimiter(), configs.RateLimit.RouteLimits(), configs.RateLimit.TrustForwardedFor)
+			api.UseDailyQuota(quotaStore, int64(configs.RateLimit.DailyQuota))
+		}
+
+		// Syncs skip the cache to see SWAPI changes
+		swapiScheduler := scheduler.NewScheduler(httpClient, configs.SWAPI.SyncInterval)
+		swapiScheduler.Start(ctx)
+		api.UseScheduler(swapiScheduler)
+
+		var purger sync.WaitGroup
+		if configs.Trash.Retention > 0 {
+			purger.Add(1)
+			go func() {
+				defer purger.Done()
+				planet.PurgeTrashEvery(ctx, configs.Trash.Retention, configs.Trash.PurgeInterval)
+			}()
+		}
+
+		readinessChecks := map[string]api.HealthCheck{configs.Database.Storage: planet.CheckStorage}
+		if configs.Health.ReadinessChecksSWAPI {
+			readinessChecks["swapi"] = httpClient.Ping
+		}
+		api.UseReadinessChecks(configs.Health.ReadinessTimeout, readinessChecks)
+
+		planet.UseCountTimeout(configs.Health.ReadinessTimeout)
+
+		api.UseStaticDir(configs.Server.StaticDir)
+		api.UseTimeouts(configs.Server.RequestTimeout, configs.Server.ShutdownTimeout)
+		err = api.HandleRequests(ctx, configs.Server.Host, configs.Server.Port)
+		// Syncs and purges stop with ctx, even if the server failed. Wait for them before disconnecting
+		stop()
+		swapiScheduler.Wait()
+		purger.Wait()
+	case "seed":
+		err = seed(model.WithActor(ctx, CLI_ACTOR), swapiClient)
+	case "export":
+		err = exportPlanets(ctx, args[1:])
+	case "import":
+		err = importPlanets(model.WithActor(ctx, CLI_ACTOR), args[1:])
+	case "keys", "users":
+		if configs.Database.Storage == "memory" {
+			err = fmt.Errorf("%s are lost on exit with memory storage. Use the bootstrap key instead", command)
+		} else if command == "keys" {
+			err = manageKeys(ctx, apiKeyStore, accessStore, args[1:])
+		} else {
+			err = manageUsers(ctx, accessStore, args[1:])
+		}
+	default:
+		err = fmt.Errorf("unknown command %s. Options: seed, export, import, keys, users", command)
+	}
+
+	if err != nil {
+		logging.Error(ctx, "Stopped with error", logging.Fields{"error": err})
+		return 1
+	}
+	return 0
+}
+
+/*Guesses the format of fileName when none is informed. Standard streams default to json*/
+func getFormat(formatName, fileName string) (transfer.Format, error) {
+	switch {
+	case formatName != "":
+		return transfer.ParseFormat(formatName)
+	case fileName != "":
+		return transfer.FormatFromFileName(fileName)
+	}
+
+	return transfer.FormatJSON, nil
+}
+
+func exportPlanets(ctx context.Context, args []string) error {
+	commandFlags := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := commandFlags.String("format", "", "csv, ndjson or json. Guessed from the output file extension when not informed.")
+	output := commandFlags.String("output", "", "File to write planets to. Defaults to the standard output.")
+	commandFlags.Parse(args)
+
+	format, err := getFormat(*formatName, *output)
+	if err != nil {
+		return err
+	}
+	writer := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	exported, err := transfer.Export(ctx, writer, format, model.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("export stopped after %d planets: %w", exported, err)
+	}
+	log.Println("Exported", exported, "planets")
+	return nil
+}
+
+func importPlanets(ctx context.Context, args []string) error {
+	commandFlags := flag.NewFlagSet("import", flag.ExitOnError)
+	formatName := commandFlags.String("format", "", "csv, ndjson or json. Guessed from the file extension when not informed.")
+	modeName := commandFlags.String("mode", string(transfer.ModeFail), "What to do with planets already stored. Options: skip, overwrite, fail.")
+	dryRun := commandFlags.Bool("dry_run", false, "Only report what would be imported.")
+	commandFlags.Parse(args)
+
+	mode, err := transfer.ParseConflictMode(*modeName)
+	if err != nil {
+		return err
+	}
+
+	// Reads the file informed after the flags, or the standard input
+	fileName := commandFlags.Arg(0)
+	format, err := getFormat(*formatName, fileName)
+	if err != nil {
+		return err
+	}
+	reader := os.Stdin
+	if fileName != "" {
+		file, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	report, err := transfer.Import(ctx, reader, format, transfer.ImportOptions{Mode: mode, DryRun: *dryRun})
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "\t")
+	encoder.Encode(report)
+
+	if err != nil {
+		return fmt.Errorf("nothing was imported: %w", err)
+	}
+	return nil
+}
+
+/*manageKeys issues, lists or revokes API keys, as told by the subcommand in args*/
+func manageKeys(ctx context.Context, store model.APIKeyStore, accessStore model.AccessStore, args []string) error {
+	subcommand := ""
+	if len(args) > 0 {
+		subcommand = args[0]
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "\t")
+
+	switch subcommand {
+	case "issue":
+		commandFlags := flag.NewFlagSet("keys issue", flag.ExitOnError)
+		name := commandFlags.String("name", "", "Who or what the key is for.")
+		userID := commandFlags.String("user", "", "User the key acts for. Its roles decide what the key can do.")
+		scopes := commandFlags.String("scopes", "", "Comma separated scopes, required without -user. Options: " + strings.Join(auth.SCOPES, ", ") + ".")
+		expiresIn := commandFlags.Duration("expires_in", 0, "How long the key is valid, like 720h. 0 never expires.")
+		commandFlags.Parse(args[1:])
+
+		var expiresAt *time.Time
+		if *expiresIn > 0 {
+			expiration := time.Now().UTC().Add(*expiresIn)
+			expiresAt = &expiration
+		}
+		if *userID != "" {
+			if _, err := accessStore.GetUser(ctx, *userID); err != nil {
+				return fmt.Errorf("user %s: %w", *userID, err)
+			}
+		}
+		key, apiKey, err := auth.IssueKey(ctx, store, *name, *userID, splitList(*scopes), expiresAt)
+		if err != nil {
+			return err
+		}
+		// The key can't be shown again
+		return encoder.Encode(map[string]interface{}{"key": key, "apiKey": apiKey})
+	case "list":
+		keys, err := store.ListKeys(ctx)
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(keys)
+	case "revoke":
+		if len(args) < 2 {
+			return fmt.Errorf("inform the id of the key to revoke")
+		}
+		if err := auth.RevokeKey(ctx, store, args[1]); err != nil {
+			return err
+		}
+		log.Println("Revoked API key", args[1])
+		return nil
+	}
+
+	return fmt.Errorf("unknown keys command %q. Options: issue, list, revoke", subcommand)
+}
+
+/*manageUsers saves, lists or removes users, as told by the subcommand in args*/
+func manageUsers(ctx context.Context, store model.AccessStore, args []string) error {
+	subcommand := ""
+	if len(args) > 0 {
+		subcommand = args[0]
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "\t")
+
+	switch subcommand {
+	case "save":
+		commandFlags := flag.NewFlagSet("users save", flag.ExitOnError)
+		name := commandFlags.String("name", "", "Full name of the user.")
+		roles := commandFlags.String("roles", auth.ROLE_VIEWER, "Comma separated roles, like viewer, editor or admin.")
+		disabled := commandFlags.Bool("disabled", false, "Deny everything to keys of the user.")
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return fmt.Errorf("inform the id of the user to save, before the flags")
+		}
+		commandFlags.Parse(args[2:])
+
+		user, err := auth.SaveUser(ctx, store, model.User{ID: args[1], Name: *name, Roles: splitList(*roles), Disabled: *disabled})
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(user)
+	case "list":
+		users, err := store.ListUsers(ctx)
+		if err != nil {
+			return err
+		}
+		return encoder.Encode(users)
+	case "remove":
+		if len(args) < 2 {
+			return fmt.Errorf("inform the id of the user to remove")
+		}
+		if err := store.RemoveUser(ctx, args[1]); err != nil {
+			return err
+		}
+		log.Println("Removed user", args[1])
+		return nil
+	}
+
+	return fmt.Errorf("unknown users command %q. Options: save, list, remove", subcommand)
+}
+
+/*splitList splits comma separated values, skipping empty ones*/
+func splitList(text string) []string {
+	var values []string
+	for _, value := range strings.Split(text, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
 }
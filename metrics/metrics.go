@@ -0,0 +1,333 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+
+/*Upper bounds of latency histograms, in seconds*/
+var DEFAULT_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+/*Collector ... Metric family written to scrapes in the Prometheus text format*/
+type Collector interface {
+	Name() string
+	Write(writer io.Writer) error
+}
+
+/*Registry ... Collectors written on every scrape, sorted by name*/
+type Registry struct {
+	mutex sync.Mutex
+	collectors map[string]Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: map[string]Collector{}}
+}
+
+/*Register adds collector. Panics on repeated names, which are programming errors*/
+func (registry *Registry) Register(collector Collector) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if _, found := registry.collectors[collector.Name()]; found {
+		panic("metric " + collector.Name() + " registered twice")
+	}
+	registry.collectors[collector.Name()] = collector
+}
+
+/*WriteText writes every metric in the Prometheus text exposition format*/
+func (registry *Registry) WriteText(writer io.Writer) error {
+	registry.mutex.Lock()
+	names := make([]string, 0, len(registry.collectors))
+	for name := range registry.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]Collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, registry.collectors[name])
+	}
+	registry.mutex.Unlock()
+
+	for _, collector := range collectors {
+		if err := collector.Write(writer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*Registry served on /metrics. Metrics created by the New functions of this package are registered on it*/
+var DefaultRegistry = NewRegistry()
+
+
+/* Helpers */
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+/*formatLabels renders {name="value",...}. Empty when there are no labels*/
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for index, name := range names {
+		pairs[index] = name + `="` + labelEscaper.Replace(values[index]) + `"`
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func writeHeader(writer io.Writer, name, help, metricType string) error {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	_, err := fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	return err
+}
+
+/*series ... Values of a metric family, by label values*/
+type series struct {
+	mutex sync.Mutex
+	labelNames []string
+	// Joined label values, to their position in labelValues
+	keys map[string]int
+	labelValues [][]string
+}
+
+func newSeries(labelNames []string) series {
+	return series{labelNames: labelNames, keys: map[string]int{}}
+}
+
+/*index returns the position of labelValues, adding them when new. Must be called with mutex locked*/
+func (metricSeries *series) index(labelValues []string) int {
+	if len(labelValues) != len(metricSeries.labelNames) {
+		panic(fmt.Sprintf("expected labels %v, got values %v", metricSeries.labelNames, labelValues))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	position, found := metricSeries.keys[key]
+	if !found {
+		position = len(metricSeries.labelValues)
+		metricSeries.keys[key] = position
+		metricSeries.labelValues = append(metricSeries.labelValues, append([]string{}, labelValues...))
+	}
+
+	return position
+}
+
+/*sortedPositions lists positions ordered by label values, so scrapes are stable. Must be called with mutex locked*/
+func (metricSeries *series) sortedPositions() []int {
+	positions := make([]int, len(metricSeries.labelValues))
+	for position := range positions {
+		positions[position] = position
+	}
+	sort.Slice(positions, func(first, second int) bool {
+		return strings.Join(metricSeries.labelValues[positions[first]], "\xff") <
+			strings.Join(metricSeries.labelValues[positions[second]], "\xff")
+	})
+
+	return positions
+}
+
+
+/* Counters */
+
+/*CounterVec ... Counters partitioned by labels*/
+type CounterVec struct {
+	name string
+	help string
+	series
+	values []float64
+}
+
+/*NewCounterVec creates a counter family on DefaultRegistry*/
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	counter := &CounterVec{name: name, help: help, series: newSeries(labelNames)}
+	DefaultRegistry.Register(counter)
+	return counter
+}
+
+func (counter *CounterVec) Name() string {
+	return counter.name
+}
+
+/*Add increases the counter of labelValues. Negative values are ignored, counters only go up*/
+func (counter *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	position := counter.index(labelValues)
+	if position == len(counter.values) {
+		counter.values = append(counter.values, 0)
+	}
+	counter.values[position] += value
+}
+
+func (counter *CounterVec) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+func (counter *CounterVec) Write(writer io.Writer) error {
+	if err := writeHeader(writer, counter.name, counter.help, "counter"); err != nil {
+		return err
+	}
+
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	for _, position := range counter.sortedPositions() {
+		labels := formatLabels(counter.labelNames, counter.labelValues[position])
+		if _, err := fmt.Fprintf(writer, "%s%s %s\n", counter.name, labels, formatValue(counter.values[position])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+
+/* Histograms */
+
+type histogramValue struct {
+	// Observations up to each bucket bound, not cumulative
+	bucketCounts []uint64
+	count uint64
+	sum float64
+}
+
+/*HistogramVec ... Histograms partitioned by labels*/
+type HistogramVec struct {
+	name string
+	help string
+	buckets []float64
+	series
+	values []*histogramValue
+}
+
+/*NewHistogramVec creates a histogram family on DefaultRegistry. nil buckets means DEFAULT_BUCKETS*/
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DEFAULT_BUCKETS
+	}
+	sortedBuckets := append([]float64{}, buckets...)
+	sort.Float64s(sortedBuckets)
+
+	histogram := &HistogramVec{name: name, help: help, buckets: sortedBuckets, series: newSeries(labelNames)}
+	DefaultRegistry.Register(histogram)
+	return histogram
+}
+
+func (histogram *HistogramVec) Name() string {
+	return histogram.name
+}
+
+func (histogram *HistogramVec) Observe(value float64, labelValues ...string) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	position := histogram.index(labelValues)
+	if position == len(histogram.values) {
+		histogram.values = append(histogram.values, &histogramValue{bucketCounts: make([]uint64, len(histogram.buckets))})
+	}
+
+	observed := histogram.values[position]
+	observed.count++
+	observed.sum += value
+	if bucket := sort.SearchFloat64s(histogram.buckets, value); bucket < len(histogram.buckets) {
+		observed.bucketCounts[bucket]++
+	}
+}
+
+func (histogram *HistogramVec) Write(writer io.Writer) error {
+	if err := writeHeader(writer, histogram.name, histogram.help, "histogram"); err != nil {
+		return err
+	}
+
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+
+	labelNames := append(append([]string{}, histogram.labelNames...), "le")
+	for _, position := range histogram.sortedPositions() {
+		labelValues := histogram.labelValues[position]
+		observed := histogram.values[position]
+
+		var cumulativeCount uint64
+		for bucket, bound := range histogram.buckets {
+			cumulativeCount += observed.bucketCounts[bucket]
+			labels := formatLabels(labelNames, append(append([]string{}, labelValues...), formatValue(bound)))
+			if _, err := fmt.Fprintf(writer, "%s_bucket%s %d\n", histogram.name, labels, cumulativeCount); err != nil {
+				return err
+			}
+		}
+
+		infLabels := formatLabels(labelNames, append(append([]string{}, labelValues...), "+Inf"))
+		labels := formatLabels(histogram.labelNames, labelValues)
+		_, err := fmt.Fprintf(
+			writer, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			histogram.name, infLabels, observed.count,
+			histogram.name, labels, formatValue(observed.sum),
+			histogram.name, labels, observed.count,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+
+/* Gauges */
+
+/*GaugeFunc ... Gauge read from a function on every scrape*/
+type GaugeFunc struct {
+	name string
+	help string
+	read func() (float64, error)
+}
+
+/*NewGaugeFunc creates a gauge on DefaultRegistry. Scrapes skip the gauge while read fails*/
+func NewGaugeFunc(name, help string, read func() (float64, error)) *GaugeFunc {
+	gauge := &GaugeFunc{name: name, help: help, read: read}
+	DefaultRegistry.Register(gauge)
+	return gauge
+}
+
+func (gauge *GaugeFunc) Name() string {
+	return gauge.name
+}
+
+func (gauge *GaugeFunc) Write(writer io.Writer) error {
+	value, err := gauge.read()
+	if err != nil {
+		return nil
+	}
+
+	if err = writeHeader(writer, gauge.name, gauge.help, "gauge"); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "%s %s\n", gauge.name, formatValue(value))
+	return err
+}
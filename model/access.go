@@ -0,0 +1,343 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+)
+
+
+/*User ... Someone API keys can be issued to. What they can do comes from their roles*/
+type User struct {
+	// Chosen by admins, like a login name
+	ID string `bson:"_id" json:"id"`
+	Name string `bson:"name" json:"name"`
+	Roles []string `bson:"roles" json:"roles"`
+	// Disabled users keep their keys, but can't do anything with them
+	Disabled bool `bson:"disabled" json:"disabled"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+/*Role ... Named set of permissions*/
+type Role struct {
+	Name string `bson:"_id" json:"name"`
+	Description string `bson:"description" json:"description"`
+	Permissions []string `bson:"permissions" json:"permissions"`
+}
+
+/*AccessDenial ... Request answered 403, kept for audits*/
+type AccessDenial struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	At time.Time `bson:"at" json:"at"`
+	RequestID string `bson:"requestId" json:"requestId"`
+	// Principal the request was authenticated as, and the user behind it, if any
+	PrincipalID string `bson:"principalId" json:"principalId"`
+	UserID string `bson:"userId,omitempty" json:"userId,omitempty"`
+	Method string `bson:"method" json:"method"`
+	Path string `bson:"path" json:"path"`
+	Route string `bson:"route" json:"route"`
+	Permission string `bson:"permission" json:"permission"`
+	Reason string `bson:"reason" json:"reason"`
+}
+
+var ErrUserNotFound = NewError(CodeNotFound, "User not found", nil)
+var ErrRoleNotFound = NewError(CodeNotFound, "Role not found", nil)
+
+/*AccessStore ... Where users, roles and access denials are kept*/
+type AccessStore interface {
+	// Fails with ErrUserNotFound
+	GetUser(ctx context.Context, id string) (User, error)
+	// Sorted by id
+	ListUsers(ctx context.Context) ([]User, error)
+	// Creates or replaces the user with the same id
+	SaveUser(ctx context.Context, user User) error
+	// Fails with ErrUserNotFound
+	RemoveUser(ctx context.Context, id string) error
+
+	// Roles named names. Unknown names are skipped
+	GetRoles(ctx context.Context, names []string) ([]Role, error)
+	// Sorted by name
+	ListRoles(ctx context.Context) ([]Role, error)
+	// Creates or replaces the role with the same name
+	SaveRole(ctx context.Context, role Role) error
+	// Saves the roles not stored yet, leaving stored ones as they are
+	SeedRoles(ctx context.Context, roles []Role) error
+
+	RecordDenial(ctx context.Context, denial AccessDenial) error
+	// Newest first. principalID filters when informed
+	ListDenials(ctx context.Context, principalID string, limit int) ([]AccessDenial, error)
+}
+
+
+/* Memory store */
+
+/*Most denials kept by MemoryAccessStore. Older ones are dropped*/
+const MAX_MEMORY_DENIALS int = 10000
+
+/*MemoryAccessStore ... Thread-safe AccessStore kept in memory. Nothing survives a restart*/
+type MemoryAccessStore struct {
+	mutex sync.RWMutex
+	users map[string]User
+	roles map[string]Role
+	// Oldest first
+	denials []AccessDenial
+}
+
+func NewMemoryAccessStore() *MemoryAccessStore {
+	return &MemoryAccessStore{users: map[string]User{}, roles: map[string]Role{}}
+}
+
+func (store *MemoryAccessStore) GetUser(ctx context.Context, id string) (User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	user, found := store.users[id]
+	if !found {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (store *MemoryAccessStore) ListUsers(ctx context.Context) ([]User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	users := make([]User, 0, len(store.users))
+	for _, user := range store.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(first, second int) bool {
+		return users[first].ID < users[second].ID
+	})
+	return users, nil
+}
+
+func (store *MemoryAccessStore) SaveUser(ctx context.Context, user User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.users[user.ID] = user
+	return nil
+}
+
+func (store *MemoryAccessStore) RemoveUser(ctx context.Context, id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, found := store.users[id]; !found {
+		return ErrUserNotFound
+	}
+	delete(store.users, id)
+	return nil
+}
+
+func (store *MemoryAccessStore) GetRoles(ctx context.Context, names []string) ([]Role, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var roles []Role
+	for _, name := range names {
+		if role, found := store.roles[name]; found {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (store *MemoryAccessStore) ListRoles(ctx context.Context) ([]Role, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	roles := make([]Role, 0, len(store.roles))
+	for _, role := range store.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(first, second int) bool {
+		return roles[first].Name < roles[second].Name
+	})
+	return roles, nil
+}
+
+func (store *MemoryAccessStore) SaveRole(ctx context.Context, role Role) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.roles[role.Name] = role
+	return nil
+}
+
+func (store *MemoryAccessStore) SeedRoles(ctx context.Context, roles []Role) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, role := range roles {
+		if _, found := store.roles[role.Name]; !found {
+			store.roles[role.Name] = role
+		}
+	}
+	return nil
+}
+
+func (store *MemoryAccessStore) RecordDenial(ctx context.Context, denial AccessDenial) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	denial.ID = primitive.NewObjectID()
+	store.denials = append(store.denials, denial)
+	if len(store.denials) > MAX_MEMORY_DENIALS {
+		store.denials = store.denials[len(store.denials) - MAX_MEMORY_DENIALS:]
+	}
+	return nil
+}
+
+func (store *MemoryAccessStore) ListDenials(ctx context.Context, principalID string, limit int) ([]AccessDenial, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	denials := []AccessDenial{}
+	for index := len(store.denials) - 1; index >= 0 && len(denials) < limit; index-- {
+		if principalID == "" || store.denials[index].PrincipalID == principalID {
+			denials = append(denials, store.denials[index])
+		}
+	}
+	return denials, nil
+}
+
+
+/* Mongo store */
+
+/*MongoAccessStore ... AccessStore backed by the users, roles and access_denials collections of a database*/
+type MongoAccessStore struct {
+	users *mongo.Collection
+	roles *mongo.Collection
+	denials *mongo.Collection
+}
+
+/*NewMongoAccessStore also indexes denials by time, for audits*/
+func NewMongoAccessStore(ctx context.Context, database *mongo.Database) *MongoAccessStore {
+	store := &MongoAccessStore{
+		users: database.Collection("users"),
+		roles: database.Collection("roles"),
+		denials: database.Collection("access_denials"),
+	}
+
+	timeIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{"at", -1}}},
+		{Keys: bson.D{{"principalId", 1}, {"at", -1}}},
+	}
+	if _, err := store.denials.Indexes().CreateMany(ctx, timeIndexes); err != nil {
+		logging.Warn(ctx, "Could not create index of access denials", logging.Fields{"error": err})
+	}
+
+	return store
+}
+
+func (store *MongoAccessStore) GetUser(ctx context.Context, id string) (User, error) {
+	var user User
+	err := store.users.FindOne(ctx, bson.D{{"_id", id}}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (store *MongoAccessStore) ListUsers(ctx context.Context) ([]User, error) {
+	users := []User{}
+	cursor, err := store.users.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{"_id", 1}}))
+	if err != nil {
+		return users, err
+	}
+	err = cursor.All(ctx, &users)
+	return users, err
+}
+
+func (store *MongoAccessStore) SaveUser(ctx context.Context, user User) error {
+	_, err := store.users.ReplaceOne(ctx, bson.D{{"_id", user.ID}}, user, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (store *MongoAccessStore) RemoveUser(ctx context.Context, id string) error {
+	result, err := store.users.DeleteOne(ctx, bson.D{{"_id", id}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (store *MongoAccessStore) GetRoles(ctx context.Context, names []string) ([]Role, error) {
+	roles := []Role{}
+	if len(names) == 0 {
+		return roles, nil
+	}
+
+	cursor, err := store.roles.Find(ctx, bson.D{{"_id", bson.D{{"$in", names}}}})
+	if err != nil {
+		return roles, err
+	}
+	err = cursor.All(ctx, &roles)
+	return roles, err
+}
+
+func (store *MongoAccessStore) ListRoles(ctx context.Context) ([]Role, error) {
+	roles := []Role{}
+	cursor, err := store.roles.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{"_id", 1}}))
+	if err != nil {
+		return roles, err
+	}
+	err = cursor.All(ctx, &roles)
+	return roles, err
+}
+
+func (store *MongoAccessStore) SaveRole(ctx context.Context, role Role) error {
+	_, err := store.roles.ReplaceOne(ctx, bson.D{{"_id", role.Name}}, role, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (store *MongoAccessStore) SeedRoles(ctx context.Context, roles []Role) error {
+	for _, role := range roles {
+		_, err := store.roles.UpdateOne(
+			ctx,
+			bson.D{{"_id", role.Name}},
+			bson.D{{"$setOnInsert", bson.D{{"description", role.Description}, {"permissions", role.Permissions}}}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *MongoAccessStore) RecordDenial(ctx context.Context, denial AccessDenial) error {
+	_, err := store.denials.InsertOne(ctx, denial)
+	return err
+}
+
+func (store *MongoAccessStore) ListDenials(ctx context.Context, principalID string, limit int) ([]AccessDenial, error) {
+	denials := []AccessDenial{}
+	filter := bson.D{}
+	if principalID != "" {
+		filter = bson.D{{"principalId", principalID}}
+	}
+
+	cursor, err := store.denials.Find(
+		ctx, filter, options.Find().SetSort(bson.D{{"at", -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return denials, err
+	}
+	err = cursor.All(ctx, &denials)
+	return denials, err
+}
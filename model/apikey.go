@@ -0,0 +1,169 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+
+/*APIKey ... Key clients authenticate with. Only the hash of its secret is stored*/
+type APIKey struct {
+	// Public part of the key, shown in listings and logs
+	ID string `bson:"_id" json:"id"`
+	Name string `bson:"name" json:"name"`
+	// User the key acts for. Keys without users act by their scopes alone
+	UserID string `bson:"userId,omitempty" json:"userId,omitempty"`
+	// SHA-256 of the secret part, hex encoded
+	SecretHash string `bson:"secretHash" json:"-"`
+	// Keys of users can't do more than their scopes allow
+	Scopes []string `bson:"scopes" json:"scopes"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	// Nil never expires
+	ExpiresAt *time.Time `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+var ErrAPIKeyNotFound = NewError(CodeNotFound, "API key not found", nil)
+
+/*APIKeyStore ... Where API keys are kept*/
+type APIKeyStore interface {
+	InsertKey(ctx context.Context, key APIKey) error
+	// Fails with ErrAPIKeyNotFound
+	GetKey(ctx context.Context, id string) (APIKey, error)
+	// Sorted by creation, revoked keys included
+	ListKeys(ctx context.Context) ([]APIKey, error)
+	// Fails with ErrAPIKeyNotFound. Revoking twice keeps the first revocation time
+	RevokeKey(ctx context.Context, id string, revokedAt time.Time) error
+}
+
+
+/* Memory store */
+
+/*MemoryAPIKeyStore ... Thread-safe APIKeyStore kept in memory. Nothing survives a restart*/
+type MemoryAPIKeyStore struct {
+	mutex sync.RWMutex
+	keys map[string]APIKey
+}
+
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: map[string]APIKey{}}
+}
+
+func (store *MemoryAPIKeyStore) InsertKey(ctx context.Context, key APIKey) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, found := store.keys[key.ID]; found {
+		return NewError(CodeConflict, "API key " + key.ID + " already exists", nil)
+	}
+	store.keys[key.ID] = key
+	return nil
+}
+
+func (store *MemoryAPIKeyStore) GetKey(ctx context.Context, id string) (APIKey, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	key, found := store.keys[id]
+	if !found {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (store *MemoryAPIKeyStore) ListKeys(ctx context.Context) ([]APIKey, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	keys := make([]APIKey, 0, len(store.keys))
+	for _, key := range store.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(first, second int) bool {
+		return keys[first].CreatedAt.Before(keys[second].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (store *MemoryAPIKeyStore) RevokeKey(ctx context.Context, id string, revokedAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key, found := store.keys[id]
+	if !found {
+		return ErrAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &revokedAt
+		store.keys[id] = key
+	}
+	return nil
+}
+
+
+/* Mongo store */
+
+/*MongoAPIKeyStore ... APIKeyStore backed by a mongo collection, keyed by the public part of each key*/
+type MongoAPIKeyStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoAPIKeyStore(collection *mongo.Collection) *MongoAPIKeyStore {
+	return &MongoAPIKeyStore{collection: collection}
+}
+
+func (store *MongoAPIKeyStore) InsertKey(ctx context.Context, key APIKey) error {
+	_, err := store.collection.InsertOne(ctx, key)
+	if isDuplicateKeyError(err) {
+		return &Error{Code: CodeConflict, Message: "API key " + key.ID + " already exists", Err: err}
+	}
+	return err
+}
+
+func (store *MongoAPIKeyStore) GetKey(ctx context.Context, id string) (APIKey, error) {
+	var key APIKey
+	err := store.collection.FindOne(ctx, bson.D{{"_id", id}}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return key, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+func (store *MongoAPIKeyStore) ListKeys(ctx context.Context) ([]APIKey, error) {
+	keys := []APIKey{}
+	cursor, err := store.collection.Find(ctx, bson.D{})
+	if err != nil {
+		return keys, err
+	}
+	if err = cursor.All(ctx, &keys); err != nil {
+		return keys, err
+	}
+
+	sort.Slice(keys, func(first, second int) bool {
+		return keys[first].CreatedAt.Before(keys[second].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (store *MongoAPIKeyStore) RevokeKey(ctx context.Context, id string, revokedAt time.Time) error {
+	result, err := store.collection.UpdateOne(
+		ctx,
+		bson.D{{"_id", id}, {"revokedAt", bson.D{{"$exists", false}}}},
+		bson.D{{"$set", bson.D{{"revokedAt", revokedAt}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		// Already revoked, or missing
+		if _, err = store.GetKey(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+)
+
+
+/*Actor ... Who a change to planets is made by. Carried by the context of the change*/
+type Actor struct {
+	// Principal of API requests, or a fixed name, like scheduler or cli
+	ID string
+	// User behind the principal, if any
+	UserID string
+}
+
+/*Actor of changes made without one, like requests without credentials*/
+const ACTOR_ANONYMOUS string = "anonymous"
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+/*ActorFrom returns the actor of ctx, or an anonymous one*/
+func ActorFrom(ctx context.Context) Actor {
+	if actor, found := ctx.Value(actorKey{}).(Actor); found {
+		return actor
+	}
+
+	return Actor{ID: ACTOR_ANONYMOUS}
+}
+
+/*AuditAction ... What a change did to a planet*/
+type AuditAction string
+
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	// Moved to the trash
+	AuditDelete AuditAction = "delete"
+	// Taken out of the trash
+	AuditRestore AuditAction = "restore"
+	// Deleted for good, after some time in the trash
+	AuditPurge AuditAction = "purge"
+)
+
+var AUDIT_ACTIONS = []AuditAction{AuditCreate, AuditUpdate, AuditDelete, AuditRestore, AuditPurge}
+
+/*AuditEntry ... One change to a planet, with the planet before and after it*/
+type AuditEntry struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	At time.Time `bson:"at" json:"at"`
+	Action AuditAction `bson:"action" json:"action"`
+	PlanetID string `bson:"planetId" json:"planetId"`
+	PlanetName string `bson:"planetName" json:"planetName"`
+	Actor string `bson:"actor" json:"actor"`
+	UserID string `bson:"userId,omitempty" json:"userId,omitempty"`
+	RequestID string `bson:"requestId,omitempty" json:"requestId,omitempty"`
+	// Nil on creates
+	Before *Planet `bson:"before" json:"before"`
+	// Nil on deletes and purges
+	After *Planet `bson:"after" json:"after"`
+}
+
+/*AuditQuery ... Filters and pagination of audit entries. Zero values mean no restriction*/
+type AuditQuery struct {
+	PlanetID string
+	Actor string
+	Action AuditAction
+	// Entries from From, inclusive, to To, exclusive
+	From time.Time
+	To time.Time
+	// NextCursor of a previous page
+	Cursor string
+	Limit int
+}
+
+/*AuditPage ... One page of audit entries, newest first*/
+type AuditPage struct {
+	Entries []AuditEntry
+	// Empty on the last page
+	NextCursor string
+}
+
+/*Validate checks action, time range and cursor before hitting the database*/
+func (query AuditQuery) Validate() error {
+	if query.Action != "" && !validAuditAction(query.Action) {
+		return NewError(
+			CodeValidation,
+			"invalid action. Valid options: create, update, delete, restore, purge",
+			map[string]interface{}{"action": query.Action},
+		)
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return NewError(CodeValidation, "from must be before to", map[string]interface{}{"from": query.From, "to": query.To})
+	}
+	if _, err := query.cursorID(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validAuditAction(action AuditAction) bool {
+	for _, known := range AUDIT_ACTIONS {
+		if action == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*cursorID is the id of the last entry of the previous page. Zero without a cursor*/
+func (query AuditQuery) cursorID() (primitive.ObjectID, error) {
+	if query.Cursor == "" {
+		return primitive.NilObjectID, nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(query.Cursor)
+	if err != nil {
+		return id, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+/*matches tells whether entry passes the filters of query, besides the cursor*/
+func (query AuditQuery) matches(entry AuditEntry) bool {
+	return (query.PlanetID == "" || entry.PlanetID == query.PlanetID) &&
+		(query.Actor == "" || entry.Actor == query.Actor) &&
+		(query.Action == "" || entry.Action == query.Action) &&
+		(query.From.IsZero() || !entry.At.Before(query.From)) &&
+		(query.To.IsZero() || entry.At.Before(query.To))
+}
+
+/*AuditStore ... Where changes to planets are recorded*/
+type AuditStore interface {
+	RecordAudit(ctx context.Context, entries []AuditEntry) error
+	// Newest first. Queries must be validated
+	ListAudit(ctx context.Context, query AuditQuery) (AuditPage, error)
+}
+
+
+/* Memory store */
+
+/*Most entries kept by MemoryAuditStore. Older ones are dropped*/
+const MAX_MEMORY_AUDIT_ENTRIES int = 10000
+
+/*MemoryAuditStore ... Thread-safe AuditStore kept in memory. Nothing survives a restart*/
+type MemoryAuditStore struct {
+	mutex sync.RWMutex
+	// Oldest first
+	entries []AuditEntry
+}
+
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return &MemoryAuditStore{}
+}
+
+func (store *MemoryAuditStore) RecordAudit(ctx context.Context, entries []AuditEntry) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, entry := range entries {
+		entry.ID = primitive.NewObjectID()
+		store.entries = append(store.entries, entry)
+	}
+	if len(store.entries) > MAX_MEMORY_AUDIT_ENTRIES {
+		store.entries = store.entries[len(store.entries) - MAX_MEMORY_AUDIT_ENTRIES:]
+	}
+	return nil
+}
+
+func (store *MemoryAuditStore) ListAudit(ctx context.Context, query AuditQuery) (AuditPage, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	page := AuditPage{Entries: []AuditEntry{}}
+	cursorID, _ := query.cursorID()
+	for index := len(store.entries) - 1; index >= 0; index-- {
+		entry := store.entries[index]
+		if !cursorID.IsZero() && entry.ID.Hex() >= cursorID.Hex() {
+			continue
+		}
+		if !query.matches(entry) {
+			continue
+		}
+
+		if len(page.Entries) == query.Limit {
+			page.NextCursor = page.Entries[len(page.Entries) - 1].ID.Hex()
+			break
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	return page, nil
+}
+
+
+/* Mongo store */
+
+/*MongoAuditStore ... AuditStore backed by the planet_audit collection of a database*/
+type MongoAuditStore struct {
+	collection *mongo.Collection
+}
+
+/*NewMongoAuditStore also indexes entries by planet, actor and time, for history queries*/
+func NewMongoAuditStore(ctx context.Context, collection *mongo.Collection) *MongoAuditStore {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{"planetId", 1}, {"_id", -1}}},
+		{Keys: bson.D{{"actor", 1}, {"_id", -1}}},
+		{Keys: bson.D{{"at", -1}}},
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		logging.Warn(ctx, "Could not create indexes of planet audit", logging.Fields{"error": err})
+	}
+
+	return &MongoAuditStore{collection: collection}
+}
+
+func (store *MongoAuditStore) RecordAudit(ctx context.Context, entries []AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(entries))
+	for index, entry := range entries {
+		entry.ID = primitive.NewObjectID()
+		documents[index] = entry
+	}
+	_, err := store.collection.InsertMany(ctx, documents)
+	return err
+}
+
+func (store *MongoAuditStore) ListAudit(ctx context.Context, query AuditQuery) (AuditPage, error) {
+	page := AuditPage{Entries: []AuditEntry{}}
+
+	filter := bson.D{}
+	if query.PlanetID != "" {
+		filter = append(filter, bson.E{"planetId", query.PlanetID})
+	}
+	if query.Actor != "" {
+		filter = append(filter, bson.E{"actor", query.Actor})
+	}
+	if query.Action != "" {
+		filter = append(filter, bson.E{"action", query.Action})
+	}
+	timeRange := bson.D{}
+	if !query.From.IsZero() {
+		timeRange = append(timeRange, bson.E{"$gte", query.From})
+	}
+	if !query.To.IsZero() {
+		timeRange = append(timeRange, bson.E{"$lt", query.To})
+	}
+	if len(timeRange) > 0 {
+		filter = append(filter, bson.E{"at", timeRange})
+	}
+	if cursorID, _ := query.cursorID(); !cursorID.IsZero() {
+		filter = append(filter, bson.E{"_id", bson.D{{"$lt", cursorID}}})
+	}
+
+	// One more than asked, to know whether there is a next page
+	findOptions := options.Find().SetSort(bson.D{{"_id", -1}}).SetLimit(int64(query.Limit + 1))
+	cursor, err := store.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return page, err
+	}
+	if err = cursor.All(ctx, &page.Entries); err != nil {
+		return page, err
+	}
+
+	if len(page.Entries) > query.Limit {
+		page.Entries = page.Entries[:query.Limit]
+		page.NextCursor = page.Entries[query.Limit - 1].ID.Hex()
+	}
+	return page, nil
+}
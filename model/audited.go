@@ -0,0 +1,231 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/metrics"
+)
+
+
+var auditFailuresTotal = metrics.NewCounterVec(
+	"planets_audit_failures_total",
+	"Changes to planets made, but not recorded on the audit log, by action.",
+	"action",
+)
+
+/*AuditedRepository ... PlanetRepository recording every create, update, delete, restore and purge of the wrapped repository on an AuditStore.
+Planets are read before changes, for the before snapshots. Changes are made even when recording them fails*/
+type AuditedRepository struct {
+	repository PlanetRepository
+	store AuditStore
+}
+
+func NewAuditedRepository(repository PlanetRepository, store AuditStore) *AuditedRepository {
+	return &AuditedRepository{repository: repository, store: store}
+}
+
+/*newAuditEntry describes a change made on behalf of the actor of ctx. Either snapshot may be nil*/
+func newAuditEntry(ctx context.Context, action AuditAction, before, after *Planet) AuditEntry {
+	actor := ActorFrom(ctx)
+	entry := AuditEntry{
+		At: time.Now().UTC(),
+		Action: action,
+		Actor: actor.ID,
+		UserID: actor.UserID,
+		RequestID: logging.RequestID(ctx),
+		Before: before,
+		After: after,
+	}
+
+	planet := after
+	if planet == nil {
+		planet = before
+	}
+	entry.PlanetID = planet.ID.Hex()
+	entry.PlanetName = planet.Name
+	return entry
+}
+
+/*record stores entries. Failures are logged and counted, since the changes are already made*/
+func (audited *AuditedRepository) record(ctx context.Context, entries ...AuditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	if err := audited.store.RecordAudit(ctx, entries); err != nil {
+		for _, entry := range entries {
+			auditFailuresTotal.Inc(string(entry.Action))
+		}
+		logging.Error(ctx, "Could not record changes on the audit log", logging.Fields{
+			"error": err,
+			"action": entries[0].Action,
+			"planets": len(entries),
+		})
+	}
+}
+
+func (audited *AuditedRepository) Insert(ctx context.Context, newPlanet Planet) (string, error) {
+	id, err := audited.repository.Insert(ctx, newPlanet)
+	if err != nil {
+		return id, err
+	}
+
+	newPlanet.ID, _ = primitive.ObjectIDFromHex(id)
+	audited.record(ctx, newAuditEntry(ctx, AuditCreate, nil, &newPlanet))
+	return id, nil
+}
+
+func (audited *AuditedRepository) InsertMany(ctx context.Context, newPlanets []Planet) ([]error, error) {
+	insertErrors, err := audited.repository.InsertMany(ctx, newPlanets)
+
+	var entries []AuditEntry
+	for index := range newPlanets {
+		// Failed insertions as a whole may have inserted some planets. Only the ones known to be inserted are recorded
+		if err == nil && index < len(insertErrors) && insertErrors[index] == nil {
+			entries = append(entries, newAuditEntry(ctx, AuditCreate, nil, &newPlanets[index]))
+		}
+	}
+	audited.record(ctx, entries...)
+
+	return insertErrors, err
+}
+
+func (audited *AuditedRepository) Get(ctx context.Context, paramName, paramValue string) (Planet, error) {
+	return audited.repository.Get(ctx, paramName, paramValue)
+}
+
+func (audited *AuditedRepository) List(ctx context.Context, listOptions ListOptions) (PlanetPage, error) {
+	return audited.repository.List(ctx, listOptions)
+}
+
+func (audited *AuditedRepository) Delete(ctx context.Context, paramName, paramValue string) error {
+	before, err := audited.repository.Get(ctx, paramName, paramValue)
+	if err != nil {
+		return err
+	}
+
+	if err = audited.repository.Delete(ctx, paramName, paramValue); err != nil {
+		return err
+	}
+	audited.record(ctx, newAuditEntry(ctx, AuditDelete, &before, nil))
+	return nil
+}
+
+func (audited *AuditedRepository) DeleteMany(ctx context.Context, paramName string, paramValues []string) ([]string, error) {
+	before := map[string]Planet{}
+	for _, paramValue := range paramValues {
+		planet, err := audited.repository.Get(ctx, paramName, paramValue)
+		if err == ErrPlanetNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		before[paramValue] = planet
+	}
+
+	deletedValues, err := audited.repository.DeleteMany(ctx, paramName, paramValues)
+	var entries []AuditEntry
+	for _, deletedValue := range deletedValues {
+		if planet, found := before[deletedValue]; found {
+			entries = append(entries, newAuditEntry(ctx, AuditDelete, &planet, nil))
+		}
+	}
+	audited.record(ctx, entries...)
+
+	return deletedValues, err
+}
+
+func (audited *AuditedRepository) Update(ctx context.Context, id string, updatedPlanet Planet) (Planet, error) {
+	before, err := audited.repository.Get(ctx, "id", id)
+	if err != nil {
+		return Planet{}, err
+	}
+
+	after, err := audited.repository.Update(ctx, id, updatedPlanet)
+	if err != nil {
+		return after, err
+	}
+	audited.record(ctx, newAuditEntry(ctx, AuditUpdate, &before, &after))
+	return after, nil
+}
+
+/*Upsert records nothing when the planet is unchanged*/
+func (audited *AuditedRepository) Upsert(ctx context.Context, planet Planet) (UpsertResult, error) {
+	before, err := audited.repository.Get(ctx, "name", planet.Name)
+	if err != nil && err != ErrPlanetNotFound {
+		return "", err
+	}
+
+	result, err := audited.repository.Upsert(ctx, planet)
+	if err != nil || result == UpsertUnchanged {
+		return result, err
+	}
+
+	after, getErr := audited.repository.Get(ctx, "name", planet.Name)
+	if getErr != nil {
+		logging.Error(ctx, "Could not read upserted planet for the audit log", logging.Fields{"error": getErr, "name": planet.Name})
+		return result, nil
+	}
+	if result == UpsertCreated {
+		audited.record(ctx, newAuditEntry(ctx, AuditCreate, nil, &after))
+	} else {
+		audited.record(ctx, newAuditEntry(ctx, AuditUpdate, &before, &after))
+	}
+	return result, nil
+}
+
+/*UpdateSync only records syncs that changed SWAPI fields, so periodic syncs don't flood the audit log*/
+func (audited *AuditedRepository) UpdateSync(ctx context.Context, syncedPlanet Planet) error {
+	before, err := audited.repository.Get(ctx, "id", syncedPlanet.ID.Hex())
+	if err != nil {
+		return err
+	}
+
+	if err = audited.repository.UpdateSync(ctx, syncedPlanet); err != nil {
+		return err
+	}
+
+	after := before
+	after.AppearencesCount = syncedPlanet.AppearencesCount
+	after.PlanetSwapiURL = syncedPlanet.PlanetSwapiURL
+	after.SwapiStatus = syncedPlanet.SwapiStatus
+	after.SwapiMatchConfidence = syncedPlanet.SwapiMatchConfidence
+	after.LastSyncedAt = syncedPlanet.LastSyncedAt
+	after.SyncStatus = syncedPlanet.SyncStatus
+	if !before.SameContent(after) {
+		audited.record(ctx, newAuditEntry(ctx, AuditUpdate, &before, &after))
+	}
+	return nil
+}
+
+func (audited *AuditedRepository) Restore(ctx context.Context, id string) (Planet, error) {
+	trashedPlanet, err := audited.repository.Restore(ctx, id)
+	if err != nil {
+		return trashedPlanet, err
+	}
+
+	restoredPlanet := trashedPlanet.Untrashed()
+	audited.record(ctx, newAuditEntry(ctx, AuditRestore, &trashedPlanet, &restoredPlanet))
+	return trashedPlanet, nil
+}
+
+func (audited *AuditedRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]Planet, error) {
+	purgedPlanets, err := audited.repository.Purge(ctx, deletedBefore, limit)
+
+	entries := make([]AuditEntry, len(purgedPlanets))
+	for index := range purgedPlanets {
+		entries[index] = newAuditEntry(ctx, AuditPurge, &purgedPlanets[index], nil)
+	}
+	audited.record(ctx, entries...)
+
+	return purgedPlanets, err
+}
+
+func (audited *AuditedRepository) CheckHealth(ctx context.Context) error {
+	return audited.repository.CheckHealth(ctx)
+}
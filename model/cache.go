@@ -0,0 +1,71 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+)
+
+
+/*Document of the SWAPI cache collection*/
+type cacheDocument struct {
+	Key string `bson:"_id"`
+	Data []byte `bson:"data"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+/*MongoCacheStore ... Persistent tier of the SWAPI cache (swapi.CacheStore) backed by a mongo collection*/
+type MongoCacheStore struct {
+	collection *mongo.Collection
+}
+
+/*NewMongoCacheStore also lets mongo delete expired entries by itself*/
+func NewMongoCacheStore(ctx context.Context, collection *mongo.Collection) *MongoCacheStore {
+	expirationIndex := mongo.IndexModel{
+		Keys: bson.D{{"expiresAt", 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, expirationIndex); err != nil {
+		logging.Warn(ctx, "Could not create expiration index of SWAPI cache", logging.Fields{"error": err})
+	}
+
+	return &MongoCacheStore{collection: collection}
+}
+
+func (store *MongoCacheStore) Load(ctx context.Context, key string) ([]byte, time.Time, bool, error) {
+	var document cacheDocument
+
+	err := store.collection.FindOne(ctx, bson.D{{"_id", key}}).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	return document.Data, document.ExpiresAt, true, nil
+}
+
+func (store *MongoCacheStore) Save(ctx context.Context, key string, data []byte, expiresAt time.Time) error {
+	document := cacheDocument{Key: key, Data: data, ExpiresAt: expiresAt}
+	_, err := store.collection.ReplaceOne(
+		ctx, bson.D{{"_id", key}}, document, options.Replace().SetUpsert(true),
+	)
+
+	return err
+}
+
+func (store *MongoCacheStore) Remove(ctx context.Context, key string) error {
+	_, err := store.collection.DeleteOne(ctx, bson.D{{"_id", key}})
+	return err
+}
+
+func (store *MongoCacheStore) RemoveAll(ctx context.Context) error {
+	_, err := store.collection.DeleteMany(ctx, bson.D{})
+	return err
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"errors"
+)
+
+
+/*ErrorCode ... Kind of an Error. The API maps each code to an HTTP status*/
+type ErrorCode string
+
+const (
+	CodeValidation ErrorCode = "validation"
+	CodeNotFound ErrorCode = "not_found"
+	CodeConflict ErrorCode = "conflict"
+	CodeUpstreamUnavailable ErrorCode = "upstream_unavailable"
+	CodeInternal ErrorCode = "internal"
+	// Missing, unknown, expired or revoked credentials
+	CodeUnauthenticated ErrorCode = "unauthenticated"
+	// Valid credentials, lacking permission
+	CodeForbidden ErrorCode = "forbidden"
+)
+
+/*Error ... Error returned by model and planet functions*/
+type Error struct {
+	Code ErrorCode `json:"code"`
+	Message string `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	// Cause, if any. Never sent to clients
+	Err error `json:"-"`
+}
+
+func NewError(code ErrorCode, message string, details map[string]interface{}) *Error {
+	return &Error{Code: code, Message: message, Details: details}
+}
+
+func (modelError *Error) Error() string {
+	if modelError.Message == "" && modelError.Err != nil {
+		return modelError.Err.Error()
+	}
+
+	return modelError.Message
+}
+
+func (modelError *Error) Unwrap() error {
+	return modelError.Err
+}
+
+/*Describe returns an error with the same code and a more specific message. It still matches modelError on errors.Is*/
+func (modelError *Error) Describe(message string, details map[string]interface{}) *Error {
+	return &Error{Code: modelError.Code, Message: message, Details: details, Err: modelError}
+}
+
+/*ErrorCodeOf returns the code of the first Error wrapped by err. Other errors are internal*/
+func ErrorCodeOf(err error) ErrorCode {
+	var modelError *Error
+	if errors.As(err, &modelError) {
+		return modelError.Code
+	}
+
+	return CodeInternal
+}
+
+/*AsError returns the first Error wrapped by err. Other errors become internal ones, keeping err as cause*/
+func AsError(err error) *Error {
+	var modelError *Error
+	if errors.As(err, &modelError) {
+		return modelError
+	}
+
+	return &Error{Code: CodeInternal, Message: "Internal error", Err: err}
+}
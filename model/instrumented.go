@@ -0,0 +1,140 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/metrics"
+)
+
+
+var operationsTotal = metrics.NewCounterVec(
+	"planets_db_operations_total",
+	"Planet storage operations, by operation and outcome. Outcomes are ok or an error code.",
+	"operation", "outcome",
+)
+
+var operationDuration = metrics.NewHistogramVec(
+	"planets_db_operation_duration_seconds",
+	"Latency of planet storage operations, by operation.",
+	nil,
+	"operation",
+)
+
+/*InstrumentedRepository ... PlanetRepository recording metrics of every operation of the wrapped repository*/
+type InstrumentedRepository struct {
+	repository PlanetRepository
+}
+
+func NewInstrumentedRepository(repository PlanetRepository) *InstrumentedRepository {
+	return &InstrumentedRepository{repository: repository}
+}
+
+/*observe records an operation started at startedAt that ended with err, logging it with the request ID of ctx*/
+func observe(ctx context.Context, operation string, startedAt time.Time, err error) {
+	latency := time.Since(startedAt)
+	outcome := "ok"
+	if err != nil {
+		outcome = string(ErrorCodeOf(err))
+	}
+
+	operationsTotal.Inc(operation, outcome)
+	operationDuration.Observe(latency.Seconds(), operation)
+
+	fields := logging.Fields{
+		"operation": operation,
+		"outcome": outcome,
+		"latencyMs": float64(latency.Microseconds()) / 1000,
+	}
+	if outcome == string(CodeInternal) {
+		fields["error"] = err
+		logging.Error(ctx, "Storage operation failed", fields)
+		return
+	}
+	logging.Debug(ctx, "Storage operation", fields)
+}
+
+func (instrumented *InstrumentedRepository) Insert(ctx context.Context, newPlanet Planet) (string, error) {
+	startedAt := time.Now()
+	id, err := instrumented.repository.Insert(ctx, newPlanet)
+	observe(ctx, "InsertPlanet", startedAt, err)
+	return id, err
+}
+
+func (instrumented *InstrumentedRepository) InsertMany(ctx context.Context, newPlanets []Planet) ([]error, error) {
+	startedAt := time.Now()
+	insertErrors, err := instrumented.repository.InsertMany(ctx, newPlanets)
+	observe(ctx, "InsertPlanets", startedAt, err)
+	return insertErrors, err
+}
+
+func (instrumented *InstrumentedRepository) Get(ctx context.Context, paramName, paramValue string) (Planet, error) {
+	startedAt := time.Now()
+	planet, err := instrumented.repository.Get(ctx, paramName, paramValue)
+	observe(ctx, "SelectPlanetByParam", startedAt, err)
+	return planet, err
+}
+
+func (instrumented *InstrumentedRepository) List(ctx context.Context, listOptions ListOptions) (PlanetPage, error) {
+	startedAt := time.Now()
+	page, err := instrumented.repository.List(ctx, listOptions)
+	observe(ctx, "SelectPlanets", startedAt, err)
+	return page, err
+}
+
+func (instrumented *InstrumentedRepository) Delete(ctx context.Context, paramName, paramValue string) error {
+	startedAt := time.Now()
+	err := instrumented.repository.Delete(ctx, paramName, paramValue)
+	observe(ctx, "DeletePlanetByParam", startedAt, err)
+	return err
+}
+
+func (instrumented *InstrumentedRepository) DeleteMany(ctx context.Context, paramName string, paramValues []string) ([]string, error) {
+	startedAt := time.Now()
+	deletedValues, err := instrumented.repository.DeleteMany(ctx, paramName, paramValues)
+	observe(ctx, "DeletePlanets", startedAt, err)
+	return deletedValues, err
+}
+
+func (instrumented *InstrumentedRepository) Update(ctx context.Context, id string, updatedPlanet Planet) (Planet, error) {
+	startedAt := time.Now()
+	planet, err := instrumented.repository.Update(ctx, id, updatedPlanet)
+	observe(ctx, "UpdatePlanet", startedAt, err)
+	return planet, err
+}
+
+func (instrumented *InstrumentedRepository) Upsert(ctx context.Context, planet Planet) (UpsertResult, error) {
+	startedAt := time.Now()
+	result, err := instrumented.repository.Upsert(ctx, planet)
+	observe(ctx, "UpsertPlanet", startedAt, err)
+	return result, err
+}
+
+func (instrumented *InstrumentedRepository) UpdateSync(ctx context.Context, syncedPlanet Planet) error {
+	startedAt := time.Now()
+	err := instrumented.repository.UpdateSync(ctx, syncedPlanet)
+	observe(ctx, "UpdatePlanetSync", startedAt, err)
+	return err
+}
+
+func (instrumented *InstrumentedRepository) Restore(ctx context.Context, id string) (Planet, error) {
+	startedAt := time.Now()
+	planet, err := instrumented.repository.Restore(ctx, id)
+	observe(ctx, "RestorePlanet", startedAt, err)
+	return planet, err
+}
+
+func (instrumented *InstrumentedRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]Planet, error) {
+	startedAt := time.Now()
+	planets, err := instrumented.repository.Purge(ctx, deletedBefore, limit)
+	observe(ctx, "PurgePlanets", startedAt, err)
+	return planets, err
+}
+
+func (instrumented *InstrumentedRepository) CheckHealth(ctx context.Context) error {
+	startedAt := time.Now()
+	err := instrumented.repository.CheckHealth(ctx)
+	observe(ctx, "CheckHealth", startedAt, err)
+	return err
+}
@@ -0,0 +1,262 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+
+/*ListOptions ... Filters, sorting and pagination of planet listings. Zero values mean no restriction*/
+type ListOptions struct {
+	Climate string
+	Terrain string
+	MinAppearences int
+	// name or appearencesCount. Prefix with "-" for descending order. Defaults to creation order
+	Sort string
+	// 0 lists everything
+	Limit int
+	// 1-based. Ignored when Cursor is informed
+	Page int
+	// NextCursor or PrevCursor of a previous page
+	Cursor string
+	// Lists trashed planets instead of live ones
+	Trashed bool
+}
+
+/*PlanetPage ... One page of a planet listing*/
+type PlanetPage struct {
+	Planets []Planet
+	// How many planets match the filters, in all pages
+	Total int64
+	// Empty on the last page
+	NextCursor string
+	// Empty on the first page, and on pages not reached by cursor
+	PrevCursor string
+}
+
+var SortableFields = []string{"name", "appearencesCount"}
+
+var ErrInvalidSort = NewError(
+	CodeValidation,
+	"invalid sort. Valid options: name, appearencesCount, -name, -appearencesCount",
+	nil,
+)
+var ErrInvalidCursor = NewError(CodeValidation, "invalid cursor", nil)
+
+
+/* List options methods */
+
+/*Validate checks sort and cursor before hitting the database*/
+func (listOptions ListOptions) Validate() error {
+	if _, _, err := listOptions.sortField(); err != nil {
+		return err
+	}
+
+	if listOptions.Cursor != "" {
+		if _, _, err := decodeCursor(listOptions.Cursor); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*sortField returns the database field to sort by and its direction*/
+func (listOptions ListOptions) sortField() (string, bool, error) {
+	if listOptions.Sort == "" {
+		return "_id", false, nil
+	}
+
+	field := strings.TrimPrefix(listOptions.Sort, "-")
+	descending := field != listOptions.Sort
+
+	for _, sortableField := range SortableFields {
+		if field == sortableField {
+			return field, descending, nil
+		}
+	}
+
+	return "", false, ErrInvalidSort
+}
+
+/*skip is how many planets the informed page jumps over*/
+func (listOptions ListOptions) skip() int {
+	if listOptions.Cursor != "" || listOptions.Page <= 1 || listOptions.Limit <= 0 {
+		return 0
+	}
+
+	return (listOptions.Page - 1) * listOptions.Limit
+}
+
+/*matches applies the filters to a single planet, like mongoFilter does on the database*/
+func (listOptions ListOptions) matches(planet Planet) bool {
+	if planet.IsEmpty() || planet.IsTrashed() != listOptions.Trashed {
+		return false
+	}
+	if !containsFold(planet.Climate, listOptions.Climate) {
+		return false
+	}
+	if !containsFold(planet.Terrain, listOptions.Terrain) {
+		return false
+	}
+
+	return planet.AppearencesCount >= listOptions.MinAppearences
+}
+
+/*mongoFilter translates the filters into a mongo query. Climate and terrain are case insensitive substrings*/
+func (listOptions ListOptions) mongoFilter() bson.D {
+	filter := bson.D{{"name", bson.D{{"$exists", true}}}}
+	if listOptions.Trashed {
+		filter = append(filter, bson.E{"deletedAt", bson.D{{"$ne", nil}}})
+	} else {
+		filter = append(filter, bson.E{"deletedAt", nil})
+	}
+
+	if listOptions.Climate != "" {
+		filter = append(filter, bson.E{"climate", containsRegex(listOptions.Climate)})
+	}
+	if listOptions.Terrain != "" {
+		filter = append(filter, bson.E{"terrain", containsRegex(listOptions.Terrain)})
+	}
+	if listOptions.MinAppearences > 0 {
+		filter = append(filter, bson.E{"appearencesCount", bson.D{{"$gte", listOptions.MinAppearences}}})
+	}
+
+	return filter
+}
+
+
+/* Helpers */
+
+func containsFold(value, term string) bool {
+	return strings.Contains(strings.ToLower(value), strings.ToLower(term))
+}
+
+func containsRegex(term string) primitive.Regex {
+	return primitive.Regex{Pattern: regexp.QuoteMeta(term), Options: "i"}
+}
+
+/*comparePlanets orders planets by field, breaking ties by id*/
+func comparePlanets(first, second Planet, field string) int {
+	switch field {
+	case "name":
+		if first.Name != second.Name {
+			return strings.Compare(first.Name, second.Name)
+		}
+	case "appearencesCount":
+		if first.AppearencesCount != second.AppearencesCount {
+			if first.AppearencesCount < second.AppearencesCount {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(first.ID.Hex(), second.ID.Hex())
+}
+
+/*keysetFilter selects planets placed after position in the listing order*/
+func keysetFilter(position Planet, field string, descending bool) bson.D {
+	operator := "$gt"
+	if descending {
+		operator = "$lt"
+	}
+	idCondition := bson.D{{"_id", bson.D{{operator, position.ID}}}}
+
+	var value interface{}
+	switch field {
+	case "name":
+		value = position.Name
+	case "appearencesCount":
+		value = position.AppearencesCount
+	default:
+		return idCondition
+	}
+
+	return bson.D{{"$or", bson.A{
+		bson.D{{field, bson.D{{operator, value}}}},
+		bson.D{{field, value}, {"_id", bson.D{{operator, position.ID}}}},
+	}}}
+}
+
+
+/* Cursors */
+
+/*Opaque position of the last planet of a page, or of the first one when paging back*/
+type cursorPosition struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	AppearencesCount int `json:"appearencesCount"`
+	// Lists the planets placed before the position, instead of after it
+	Before bool `json:"before,omitempty"`
+}
+
+func encodeCursor(planet Planet, before bool) string {
+	position, _ := json.Marshal(cursorPosition{
+		ID: planet.ID.Hex(),
+		Name: planet.Name,
+		AppearencesCount: planet.AppearencesCount,
+		Before: before,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(position)
+}
+
+/*decodeCursor returns a planet holding only the fields needed to resume a listing, and whether to list the planets before it*/
+func decodeCursor(cursor string) (Planet, bool, error) {
+	var position cursorPosition
+	var planet Planet
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return planet, false, ErrInvalidCursor
+	}
+	if err = json.Unmarshal(data, &position); err != nil {
+		return planet, false, ErrInvalidCursor
+	}
+
+	planet.ID, err = primitive.ObjectIDFromHex(position.ID)
+	if err != nil {
+		return planet, false, ErrInvalidCursor
+	}
+	planet.Name = position.Name
+	planet.AppearencesCount = position.AppearencesCount
+
+	return planet, position.Before, nil
+}
+
+/*cutPage fills page with planets, in listing order, and its cursors. Beyond the limit, planets hold one more planet
+telling there are more: after the page, or before it when paging back*/
+func cutPage(page *PlanetPage, planets []Planet, listOptions ListOptions, before bool) {
+	limit := listOptions.Limit
+	more := limit > 0 && len(planets) > limit
+
+	if before {
+		if more {
+			planets = planets[len(planets) - limit:]
+		}
+		// Paging back always leaves planets after the page
+		if len(planets) > 0 {
+			page.NextCursor = encodeCursor(planets[len(planets) - 1], false)
+		}
+		if more {
+			page.PrevCursor = encodeCursor(planets[0], true)
+		}
+	} else {
+		if more {
+			planets = planets[:limit]
+			page.NextCursor = encodeCursor(planets[limit - 1], false)
+		}
+		// Pages reached by cursor follow some other page
+		if listOptions.Cursor != "" && len(planets) > 0 {
+			page.PrevCursor = encodeCursor(planets[0], true)
+		}
+	}
+
+	page.Planets = planets
+}
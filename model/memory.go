@@ -0,0 +1,337 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+
+/* Memory repository */
+
+/*MemoryRepository ... Thread-safe PlanetRepository that keeps planets in memory. Nothing survives a restart*/
+type MemoryRepository struct {
+	mutex   sync.RWMutex
+	planets map[primitive.ObjectID]Planet
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{planets: map[primitive.ObjectID]Planet{}}
+}
+
+/*find returns the live planet matching id or name. Caller must hold the lock*/
+func (repository *MemoryRepository) find(paramName, paramValue string) (Planet, bool) {
+	if paramName == "id" {
+		objectID, err := primitive.ObjectIDFromHex(paramValue)
+		if err != nil {
+			return Planet{}, false
+		}
+		planet, found := repository.planets[objectID]
+		if !found || planet.IsTrashed() {
+			return Planet{}, false
+		}
+		return planet, true
+	}
+
+	for _, planet := range repository.planets {
+		if planet.Name == paramValue && !planet.IsTrashed() {
+			return planet, true
+		}
+	}
+
+	return Planet{}, false
+}
+
+/*CheckHealth only fails on done contexts, since memory is always available*/
+func (repository *MemoryRepository) CheckHealth(ctx context.Context) error {
+	return ctx.Err()
+}
+
+/*Insert adds a new planet. Refuses planets with the same name, like mongo's unique index, and ids already stored, trashed or not*/
+func (repository *MemoryRepository) Insert(ctx context.Context, newPlanet Planet) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if _, found := repository.find("name", newPlanet.Name); found {
+		return "", ErrDuplicatedPlanet
+	}
+	if _, found := repository.planets[newPlanet.ID]; found && !newPlanet.ID.IsZero() {
+		return "", ErrDuplicatedPlanet
+	}
+
+	newPlanet = newPlanet.Untrashed()
+	if newPlanet.ID.IsZero() {
+		newPlanet.ID = primitive.NewObjectID()
+	}
+	repository.planets[newPlanet.ID] = newPlanet
+
+	return newPlanet.ID.Hex(), nil
+}
+
+func (repository *MemoryRepository) InsertMany(ctx context.Context, newPlanets []Planet) ([]error, error) {
+	insertErrors := make([]error, len(newPlanets))
+	for index, newPlanet := range newPlanets {
+		_, insertErrors[index] = repository.Insert(ctx, newPlanet)
+	}
+
+	return insertErrors, nil
+}
+
+func (repository *MemoryRepository) Get(ctx context.Context, paramName, paramValue string) (Planet, error) {
+	if err := ctx.Err(); err != nil {
+		return Planet{}, err
+	}
+
+	repository.mutex.RLock()
+	defer repository.mutex.RUnlock()
+
+	planet, found := repository.find(paramName, paramValue)
+	if !found {
+		return planet, ErrPlanetNotFound
+	}
+
+	return planet, nil
+}
+
+/*List returns one page of planets, applying the same rules as MongoRepository.List*/
+func (repository *MemoryRepository) List(ctx context.Context, listOptions ListOptions) (PlanetPage, error) {
+	var page PlanetPage
+
+	if err := ctx.Err(); err != nil {
+		return page, err
+	}
+
+	field, descending, err := listOptions.sortField()
+	if err != nil {
+		return page, err
+	}
+
+	var position Planet
+	var before bool
+	if listOptions.Cursor != "" {
+		if position, before, err = decodeCursor(listOptions.Cursor); err != nil {
+			return page, err
+		}
+	}
+
+	repository.mutex.RLock()
+	var planets []Planet
+	for _, planet := range repository.planets {
+		if listOptions.matches(planet) {
+			planets = append(planets, planet)
+		}
+	}
+	repository.mutex.RUnlock()
+
+	inOrder := func(first, second Planet) bool {
+		comparison := comparePlanets(first, second, field)
+		if descending {
+			return comparison > 0
+		}
+		return comparison < 0
+	}
+	sort.Slice(planets, func(i, j int) bool {
+		return inOrder(planets[i], planets[j])
+	})
+	page.Total = int64(len(planets))
+
+	start := listOptions.skip()
+	if listOptions.Cursor != "" && before {
+		// Every planet before the position. cutPage keeps the last ones
+		end := sort.Search(len(planets), func(i int) bool {
+			return !inOrder(planets[i], position)
+		})
+		planets, start = planets[:end], 0
+	} else if listOptions.Cursor != "" {
+		start = sort.Search(len(planets), func(i int) bool {
+			return inOrder(position, planets[i])
+		})
+	}
+	if start > len(planets) {
+		start = len(planets)
+	}
+
+	cutPage(&page, planets[start:], listOptions, before)
+	return page, nil
+}
+
+func (repository *MemoryRepository) Delete(ctx context.Context, paramName, paramValue string) error {
+	_, err := repository.delete(ctx, paramName, paramValue)
+	return err
+}
+
+/*delete moves the planet found by paramName and paramValue to the trash, returning it*/
+func (repository *MemoryRepository) delete(ctx context.Context, paramName, paramValue string) (Planet, error) {
+	if err := ctx.Err(); err != nil {
+		return Planet{}, err
+	}
+
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	planet, found := repository.find(paramName, paramValue)
+	if !found {
+		return Planet{}, ErrPlanetNotFound
+	}
+	deletedAt := time.Now().UTC()
+	planet.DeletedAt = &deletedAt
+	planet.DeletedBy = ActorFrom(ctx).ID
+	repository.planets[planet.ID] = planet
+
+	return planet, nil
+}
+
+func (repository *MemoryRepository) DeleteMany(ctx context.Context, paramName string, paramValues []string) ([]string, error) {
+	deletedValues := []string{}
+	for _, paramValue := range paramValues {
+		deletedPlanet, err := repository.delete(ctx, paramName, paramValue)
+		switch {
+		// Stored values, like mongo answers, so ids come back in lower case hex
+		case err == nil && paramName == "id":
+			deletedValues = append(deletedValues, deletedPlanet.ID.Hex())
+		case err == nil:
+			deletedValues = append(deletedValues, deletedPlanet.Name)
+		case err != ErrPlanetNotFound:
+			return deletedValues, err
+		}
+	}
+
+	return deletedValues, nil
+}
+
+/*Update replaces the planet with the informed id, refusing names used by other planets*/
+func (repository *MemoryRepository) Update(ctx context.Context, id string, updatedPlanet Planet) (Planet, error) {
+	if err := ctx.Err(); err != nil {
+		return Planet{}, err
+	}
+
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	current, found := repository.find("id", id)
+	if !found {
+		return Planet{}, ErrPlanetNotFound
+	}
+
+	if namesake, found := repository.find("name", updatedPlanet.Name); found && namesake.ID != current.ID {
+		return Planet{}, ErrDuplicatedPlanet
+	}
+
+	updatedPlanet = updatedPlanet.Untrashed()
+	updatedPlanet.ID = current.ID
+	repository.planets[current.ID] = updatedPlanet
+
+	return updatedPlanet, nil
+}
+
+/*Upsert creates or updates the planet with the same name, keeping its id*/
+func (repository *MemoryRepository) Upsert(ctx context.Context, planet Planet) (UpsertResult, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	planet = planet.Untrashed()
+	previousPlanet, found := repository.find("name", planet.Name)
+	if !found {
+		planet.ID = primitive.NewObjectID()
+		repository.planets[planet.ID] = planet
+		return UpsertCreated, nil
+	}
+
+	if previousPlanet.SameContent(planet) {
+		return UpsertUnchanged, nil
+	}
+
+	planet.ID = previousPlanet.ID
+	repository.planets[planet.ID] = planet
+
+	return UpsertUpdated, nil
+}
+
+/*UpdateSync saves SWAPI fields and sync bookkeeping, leaving fields edited by users untouched*/
+func (repository *MemoryRepository) UpdateSync(ctx context.Context, syncedPlanet Planet) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	// Trashed planets are left as they were, like on mongo
+	planet, found := repository.planets[syncedPlanet.ID]
+	if !found || planet.IsTrashed() {
+		return ErrPlanetNotFound
+	}
+
+	planet.AppearencesCount = syncedPlanet.AppearencesCount
+	planet.PlanetSwapiURL = syncedPlanet.PlanetSwapiURL
+	planet.SwapiStatus = syncedPlanet.SwapiStatus
+	planet.SwapiMatchConfidence = syncedPlanet.SwapiMatchConfidence
+	planet.LastSyncedAt = syncedPlanet.LastSyncedAt
+	planet.SyncStatus = syncedPlanet.SyncStatus
+	repository.planets[planet.ID] = planet
+
+	return nil
+}
+
+/*Restore refuses names used by live planets, like mongo's unique index*/
+func (repository *MemoryRepository) Restore(ctx context.Context, id string) (Planet, error) {
+	if err := ctx.Err(); err != nil {
+		return Planet{}, err
+	}
+
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Planet{}, ErrPlanetNotFound
+	}
+	trashedPlanet, found := repository.planets[objectID]
+	if !found || !trashedPlanet.IsTrashed() {
+		return Planet{}, ErrPlanetNotFound
+	}
+	if _, found := repository.find("name", trashedPlanet.Name); found {
+		return Planet{}, ErrDuplicatedPlanet
+	}
+
+	repository.planets[objectID] = trashedPlanet.Untrashed()
+	return trashedPlanet, nil
+}
+
+func (repository *MemoryRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]Planet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	var expired []Planet
+	for _, planet := range repository.planets {
+		if planet.IsTrashed() && planet.DeletedAt.Before(deletedBefore) {
+			expired = append(expired, planet)
+		}
+	}
+	sort.Slice(expired, func(first, second int) bool {
+		return expired[first].DeletedAt.Before(*expired[second].DeletedAt)
+	})
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+
+	for _, planet := range expired {
+		delete(repository.planets, planet.ID)
+	}
+	return expired, nil
+}
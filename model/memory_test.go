@@ -0,0 +1,444 @@
+package model
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+
+/*newSeededRepository stores planets, returning their ids in the same order*/
+func newSeededRepository(t *testing.T, planets ...Planet) (*MemoryRepository, []string) {
+	t.Helper()
+	repository := NewMemoryRepository()
+	ids := make([]string, len(planets))
+	for index, planet := range planets {
+		id, err := repository.Insert(context.Background(), planet)
+		if err != nil {
+			t.Fatalf("could not seed %s: %v", planet.Name, err)
+		}
+		ids[index] = id
+	}
+
+	return repository, ids
+}
+
+func planetNames(planets []Planet) []string {
+	names := []string{}
+	for _, planet := range planets {
+		names = append(names, planet.Name)
+	}
+	return names
+}
+
+func TestMemoryRepositoryInsert(t *testing.T) {
+	tests := []struct {
+		name string
+		planet Planet
+		// Index of the seeded planet whose id the planet takes. -1 keeps its own
+		sameIDAs int
+		wantErr error
+	}{
+		{"new name", Planet{Name: "Hoth", Climate: "frozen"}, -1, nil},
+		{"name taken", Planet{Name: "Tatooine", Climate: "temperate"}, -1, ErrDuplicatedPlanet},
+		{"name of a trashed planet", Planet{Name: "Alderaan"}, -1, nil},
+		{"id taken", Planet{Name: "Hoth"}, 0, ErrDuplicatedPlanet},
+		{"id of a trashed planet", Planet{Name: "Hoth"}, 1, ErrDuplicatedPlanet},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repository, ids := newSeededRepository(t, Planet{Name: "Tatooine", Climate: "arid"}, Planet{Name: "Alderaan"})
+			if err := repository.Delete(ctx, "name", "Alderaan"); err != nil {
+				t.Fatal(err)
+			}
+			if test.sameIDAs >= 0 {
+				test.planet.ID = mustObjectID(t, ids[test.sameIDAs])
+			}
+
+			id, err := repository.Insert(ctx, test.planet)
+			if err != test.wantErr {
+				t.Fatalf("Insert() error = %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				// Planets with the id are left as they were
+				if test.sameIDAs == 0 {
+					if stored, _ := repository.Get(ctx, "id", ids[0]); stored.Name != "Tatooine" {
+						t.Errorf("planet with the id taken = %+v, want Tatooine", stored)
+					}
+				}
+				return
+			}
+
+			stored, err := repository.Get(ctx, "id", id)
+			if err != nil {
+				t.Fatalf("Get() of inserted planet: %v", err)
+			}
+			if stored.Name != test.planet.Name || stored.Climate != test.planet.Climate {
+				t.Errorf("stored %+v, want %+v", stored, test.planet)
+			}
+		})
+	}
+}
+
+func TestMemoryRepositoryGet(t *testing.T) {
+	ctx := context.Background()
+	repository, ids := newSeededRepository(t, Planet{Name: "Tatooine"}, Planet{Name: "Alderaan"})
+	if err := repository.Delete(ctx, "id", ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		paramName string
+		paramValue string
+		wantName string
+		wantErr error
+	}{
+		{"by id", "id", ids[0], "Tatooine", nil},
+		{"by name", "name", "Tatooine", "Tatooine", nil},
+		{"unknown id", "id", "5eb2f0a0f1b2c3d4e5f60718", "", ErrPlanetNotFound},
+		{"invalid id", "id", "tatooine", "", ErrPlanetNotFound},
+		{"unknown name", "name", "Hoth", "", ErrPlanetNotFound},
+		{"trashed by id", "id", ids[1], "", ErrPlanetNotFound},
+		{"trashed by name", "name", "Alderaan", "", ErrPlanetNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			planet, err := repository.Get(ctx, test.paramName, test.paramValue)
+			if err != test.wantErr {
+				t.Fatalf("Get() error = %v, want %v", err, test.wantErr)
+			}
+			if planet.Name != test.wantName {
+				t.Errorf("Get() name = %q, want %q", planet.Name, test.wantName)
+			}
+		})
+	}
+}
+
+func TestMemoryRepositoryUpdate(t *testing.T) {
+	tests := []struct {
+		name string
+		// Index of the seeded planet updated. -1 updates an unknown id
+		index int
+		planet Planet
+		wantErr error
+	}{
+		{"same name", 0, Planet{Name: "Tatooine", Climate: "temperate"}, nil},
+		{"rename", 0, Planet{Name: "Geonosis"}, nil},
+		{"name of another planet", 0, Planet{Name: "Hoth"}, ErrDuplicatedPlanet},
+		{"unknown id", -1, Planet{Name: "Naboo"}, ErrPlanetNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repository, ids := newSeededRepository(t, Planet{Name: "Tatooine", Climate: "arid"}, Planet{Name: "Hoth"})
+			id := "5eb2f0a0f1b2c3d4e5f60718"
+			if test.index >= 0 {
+				id = ids[test.index]
+			}
+
+			updated, err := repository.Update(ctx, id, test.planet)
+			if err != test.wantErr {
+				t.Fatalf("Update() error = %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if updated.ID.Hex() != id {
+				t.Errorf("Update() changed id to %s", updated.ID.Hex())
+			}
+			stored, err := repository.Get(ctx, "id", id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(stored, updated) {
+				t.Errorf("stored %+v, want %+v", stored, updated)
+			}
+		})
+	}
+}
+
+func TestMemoryRepositoryDelete(t *testing.T) {
+	tests := []struct {
+		name string
+		paramName string
+		// Seeded planet named Tatooine, besides any other value
+		paramValue string
+		// Deleted before the tested one
+		deletedBefore bool
+		wantErr error
+	}{
+		{"by id", "id", "", false, nil},
+		{"by name", "name", "Tatooine", false, nil},
+		{"unknown name", "name", "Hoth", false, ErrPlanetNotFound},
+		{"already deleted", "name", "Tatooine", true, ErrPlanetNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := WithActor(context.Background(), Actor{ID: "tester"})
+			repository, ids := newSeededRepository(t, Planet{Name: "Tatooine"})
+			paramValue := test.paramValue
+			if paramValue == "" {
+				paramValue = ids[0]
+			}
+			if test.deletedBefore {
+				if err := repository.Delete(ctx, test.paramName, paramValue); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := repository.Delete(ctx, test.paramName, paramValue)
+			if err != test.wantErr {
+				t.Fatalf("Delete() error = %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if _, err = repository.Get(ctx, "id", ids[0]); err != ErrPlanetNotFound {
+				t.Errorf("Get() of deleted planet error = %v, want %v", err, ErrPlanetNotFound)
+			}
+			trash, err := repository.List(ctx, ListOptions{Trashed: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(trash.Planets) != 1 || trash.Planets[0].DeletedBy != "tester" || trash.Planets[0].DeletedAt == nil {
+				t.Errorf("trash = %+v, want Tatooine deleted by tester", trash.Planets)
+			}
+		})
+	}
+}
+
+func TestMemoryRepositoryList(t *testing.T) {
+	ctx := context.Background()
+	repository, _ := newSeededRepository(t,
+		Planet{Name: "Tatooine", Climate: "arid", Terrain: "desert", AppearencesCount: 5},
+		Planet{Name: "Hoth", Climate: "frozen", Terrain: "tundra, ice caves", AppearencesCount: 1},
+		Planet{Name: "Naboo", Climate: "temperate", Terrain: "grassy hills, swamps", AppearencesCount: 4},
+		Planet{Name: "Dagobah", Climate: "murky", Terrain: "swamp, jungles", AppearencesCount: 3},
+		Planet{Name: "Alderaan", Climate: "temperate", Terrain: "grasslands, mountains", AppearencesCount: 2},
+	)
+	if err := repository.Delete(ctx, "name", "Alderaan"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		listOptions ListOptions
+		wantNames []string
+		wantTotal int64
+		wantNext bool
+		wantErr error
+	}{
+		{"everything, in creation order", ListOptions{}, []string{"Tatooine", "Hoth", "Naboo", "Dagobah"}, 4, false, nil},
+		{"climate filter ignores case", ListOptions{Climate: "TEMPERATE"}, []string{"Naboo"}, 1, false, nil},
+		{"terrain substring", ListOptions{Terrain: "swamp", Sort: "name"}, []string{"Dagobah", "Naboo"}, 2, false, nil},
+		{"min appearences", ListOptions{MinAppearences: 4, Sort: "-appearencesCount"}, []string{"Tatooine", "Naboo"}, 2, false, nil},
+		{"first page", ListOptions{Sort: "name", Limit: 3}, []string{"Dagobah", "Hoth", "Naboo"}, 4, true, nil},
+		{"second page by number", ListOptions{Sort: "name", Limit: 3, Page: 2}, []string{"Tatooine"}, 4, false, nil},
+		{"trash", ListOptions{Trashed: true}, []string{"Alderaan"}, 1, false, nil},
+		{"invalid sort", ListOptions{Sort: "climate"}, nil, 0, false, ErrInvalidSort},
+		{"invalid cursor", ListOptions{Cursor: "not a cursor"}, nil, 0, false, ErrInvalidCursor},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := repository.List(ctx, test.listOptions)
+			if err != test.wantErr {
+				t.Fatalf("List() error = %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if names := planetNames(page.Planets); !reflect.DeepEqual(names, test.wantNames) {
+				t.Errorf("List() names = %v, want %v", names, test.wantNames)
+			}
+			if page.Total != test.wantTotal {
+				t.Errorf("List() total = %d, want %d", page.Total, test.wantTotal)
+			}
+			if (page.NextCursor != "") != test.wantNext {
+				t.Errorf("List() next cursor = %q, want one: %v", page.NextCursor, test.wantNext)
+			}
+		})
+	}
+}
+
+func TestMemoryRepositoryListByCursor(t *testing.T) {
+	ctx := context.Background()
+	repository, _ := newSeededRepository(t,
+		Planet{Name: "Alderaan"}, Planet{Name: "Bespin"}, Planet{Name: "Coruscant"},
+		Planet{Name: "Dagobah"}, Planet{Name: "Endor"},
+	)
+	listOptions := ListOptions{Sort: "name", Limit: 2}
+
+	var pages [][]string
+	var last PlanetPage
+	for {
+		page, err := repository.List(ctx, listOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, planetNames(page.Planets))
+		last = page
+		if page.NextCursor == "" {
+			break
+		}
+		listOptions.Cursor = page.NextCursor
+	}
+
+	wantPages := [][]string{{"Alderaan", "Bespin"}, {"Coruscant", "Dagobah"}, {"Endor"}}
+	if !reflect.DeepEqual(pages, wantPages) {
+		t.Fatalf("pages forward = %v, want %v", pages, wantPages)
+	}
+
+	// And back from the last page
+	listOptions.Cursor = last.PrevCursor
+	previous, err := repository.List(ctx, listOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := planetNames(previous.Planets); !reflect.DeepEqual(names, wantPages[1]) {
+		t.Errorf("previous page = %v, want %v", names, wantPages[1])
+	}
+	listOptions.Cursor = previous.PrevCursor
+	first, err := repository.List(ctx, listOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := planetNames(first.Planets); !reflect.DeepEqual(names, wantPages[0]) || first.PrevCursor != "" {
+		t.Errorf("first page = %v, prev cursor %q, want %v and none", names, first.PrevCursor, wantPages[0])
+	}
+}
+
+func TestMemoryRepositoryUpdateSyncSkipsTrash(t *testing.T) {
+	ctx := context.Background()
+	repository, ids := newSeededRepository(t, Planet{Name: "Tatooine", AppearencesCount: 1})
+	trashed, _ := repository.Get(ctx, "id", ids[0])
+	if err := repository.Delete(ctx, "id", ids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	syncedAt := time.Now()
+	trashed.AppearencesCount = 5
+	trashed.LastSyncedAt = &syncedAt
+	if err := repository.UpdateSync(ctx, trashed); err != ErrPlanetNotFound {
+		t.Fatalf("UpdateSync() of trashed planet error = %v, want %v", err, ErrPlanetNotFound)
+	}
+}
+
+func TestMemoryRepositoryPurge(t *testing.T) {
+	ctx := context.Background()
+	repository, ids := newSeededRepository(t,
+		Planet{Name: "Alderaan"}, Planet{Name: "Bespin"}, Planet{Name: "Coruscant"}, Planet{Name: "Dagobah"},
+	)
+
+	// Trashed 40 days, 31 days and a day ago. Dagobah is kept
+	now := time.Now().UTC()
+	for index, age := range []time.Duration{40 * 24 * time.Hour, 31 * 24 * time.Hour, 24 * time.Hour} {
+		if err := repository.Delete(ctx, "id", ids[index]); err != nil {
+			t.Fatal(err)
+		}
+		trashed := repository.planets[mustObjectID(t, ids[index])]
+		deletedAt := now.Add(-age)
+		trashed.DeletedAt = &deletedAt
+		repository.planets[trashed.ID] = trashed
+	}
+
+	retention := now.Add(-30 * 24 * time.Hour)
+	steps := []struct {
+		name string
+		limit int
+		wantPurged []string
+	}{
+		{"oldest first", 1, []string{"Alderaan"}},
+		{"the other expired", 10, []string{"Bespin"}},
+		{"nothing left to purge", 10, []string{}},
+	}
+	for _, step := range steps {
+		purged, err := repository.Purge(ctx, retention, step.limit)
+		if err != nil {
+			t.Fatalf("%s: Purge() error = %v", step.name, err)
+		}
+		if names := planetNames(purged); !reflect.DeepEqual(names, step.wantPurged) {
+			t.Errorf("%s: Purge() = %v, want %v", step.name, names, step.wantPurged)
+		}
+	}
+
+	trash, err := repository.List(ctx, ListOptions{Trashed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := planetNames(trash.Planets); !reflect.DeepEqual(names, []string{"Coruscant"}) {
+		t.Errorf("trash = %v, want Coruscant", names)
+	}
+	if _, err := repository.Get(ctx, "name", "Dagobah"); err != nil {
+		t.Errorf("Get() of a planet never trashed error = %v", err)
+	}
+}
+
+func TestMemoryRepositoryRestore(t *testing.T) {
+	tests := []struct {
+		name string
+		// Index of the seeded planet restored, Tatooine or Hoth. -1 restores an unknown id
+		index int
+		// Tatooine takes the name of the trashed Tatooine first
+		nameTaken bool
+		wantErr error
+	}{
+		{"trashed", 0, false, nil},
+		{"name taken since", 0, true, ErrDuplicatedPlanet},
+		{"not trashed", 1, false, ErrPlanetNotFound},
+		{"unknown id", -1, false, ErrPlanetNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			repository, ids := newSeededRepository(t, Planet{Name: "Tatooine", Climate: "arid"}, Planet{Name: "Hoth"})
+			if err := repository.Delete(ctx, "id", ids[0]); err != nil {
+				t.Fatal(err)
+			}
+			if test.nameTaken {
+				if _, err := repository.Insert(ctx, Planet{Name: "Tatooine"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			id := "5eb2f0a0f1b2c3d4e5f60718"
+			if test.index >= 0 {
+				id = ids[test.index]
+			}
+
+			_, err := repository.Restore(ctx, id)
+			if err != test.wantErr {
+				t.Fatalf("Restore() error = %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			restored, err := repository.Get(ctx, "id", id)
+			if err != nil || restored.Climate != "arid" || restored.IsTrashed() {
+				t.Errorf("Get() of restored planet = %+v, %v, want Tatooine out of the trash", restored, err)
+			}
+		})
+	}
+}
+
+func mustObjectID(t *testing.T, id string) primitive.ObjectID {
+	t.Helper()
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objectID
+}
@@ -2,14 +2,9 @@ package model
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 
@@ -21,8 +16,26 @@ type Planet struct {
 	Terrain string `bson:"terrain" json:"terrain"`
 	AppearencesCount int `bson:"appearencesCount" json:"appearencesCount"`
 	PlanetSwapiURL string `bson:"planetSwapiURL" json:"-"`
+	// resolved, unresolved or not_found. See swapi.ResolvePlanet
+	SwapiStatus string `bson:"swapiStatus" json:"swapiStatus"`
+	// exact, normalized or none
+	SwapiMatchConfidence string `bson:"swapiMatchConfidence" json:"swapiMatchConfidence"`
+	// When SWAPI fields were last refreshed by the scheduler. Nil if never
+	LastSyncedAt *time.Time `bson:"lastSyncedAt,omitempty" json:"lastSyncedAt,omitempty"`
+	// unchanged, updated or failed
+	SyncStatus string `bson:"syncStatus,omitempty" json:"syncStatus,omitempty"`
+	// When the planet was moved to the trash, and by which actor. Nil while not trashed
+	DeletedAt *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	DeletedBy string `bson:"deletedBy,omitempty" json:"deletedBy,omitempty"`
 }
 
+/* Sync statuses */
+const (
+	SyncUnchanged string = "unchanged"
+	SyncUpdated string = "updated"
+	SyncFailed string = "failed"
+)
+
 
 /* Planet methods */
 
@@ -30,174 +43,68 @@ func (planet Planet) IsEmpty() bool {
 	return planet.Name == "";
 }
 
-var collection *mongo.Collection
-
-
-/* Database functions */
-
-func makeURI(host, port, databaseName string) string {
-	uri := "mongodb" + "://" + host + ":" + port + "/" + databaseName + "?retryWrites=true&w=majority"
-	return uri
+func (planet Planet) IsTrashed() bool {
+	return planet.DeletedAt != nil
 }
 
-func MongoDBConnect(host, port, user, password, databaseName, collectionName string) (*mongo.Client, /**mongo.Collection*/) {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	credential := options.Credential{
-		Username: user,
-		Password: password,
-		AuthMechanism: "",
-	}
-	uri := makeURI(host, port, databaseName)
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetAuth(credential))
-
-	if err != nil {
-		log.Println("Could not connect to mongo db") 
-		log.Println(err)
-	}
-
-	database := client.Database(databaseName)
-	collection = database.Collection(collectionName)
-
-	// Ensure that two data keys cannot share the same name.
-	nameIndex := mongo.IndexModel{
-		Keys: bson.D{{"name", 1}},
-		Options: options.Index().
-			SetUnique(true).
-			SetPartialFilterExpression(bson.D{
-				{"name", bson.D{
-					{"$exists", true},
-				}},
-			}),
-	}
-	if _, err = collection.Indexes().CreateOne(context.TODO(), nameIndex); err != nil {
-		log.Println("Erro while saving duplicated planet. Ignoring")
-	}
-
-	log.Print(
-		"Connected to Database: ", databaseName,
-		", collection: ", collectionName,
-		" at ", host,
-	)
-
-	return client//, collection
-
+/*Untrashed returns planet out of the trash. Also keeps clients from trashing planets by sending deletedAt*/
+func (planet Planet) Untrashed() Planet {
+	planet.DeletedAt = nil
+	planet.DeletedBy = ""
+	return planet
 }
 
-func MongoDBDisconnect(client *mongo.Client) {
-	error := client.Disconnect(context.TODO())
-
-	if error != nil {
-		log.Fatal(error)
-	}
-	log.Print("Disconnecting from DB.")
+/*SameContent compares planet data, ignoring id and sync bookkeeping*/
+func (planet Planet) SameContent(other Planet) bool {
+	return planet.Name == other.Name &&
+		planet.Climate == other.Climate &&
+		planet.Terrain == other.Terrain &&
+		planet.AppearencesCount == other.AppearencesCount &&
+		planet.PlanetSwapiURL == other.PlanetSwapiURL &&
+		planet.SwapiStatus == other.SwapiStatus &&
+		planet.SwapiMatchConfidence == other.SwapiMatchConfidence
 }
 
-/*InsertPlanet adds a new planet to the database. Ignores planets with the same name*/
-func InsertPlanet(newPlanet Planet) (bool, string, string) {
-	var created bool = false
-	var errorMessage string = ""
-	var planetUUID string
-	result, err := collection.InsertOne(context.TODO(), newPlanet)
-	
-	if err != nil {
-		created = false
-		log.Println("Error while saving planet: " + newPlanet.Name)
-	} else {
-		created = result.InsertedID != nil
-		planetUUID = result.InsertedID.(primitive.ObjectID).Hex()
-	}
-	if !created {
-		errorMessage = "Planet " + newPlanet.Name + " already exists"
-	}
-
-	return created, planetUUID, errorMessage
-}
 
-func GetPlanetsFromDB() []Planet {
-	var planets [] Planet
-	emptyFilter := bson.D{{}}
-
-	cursor, err := collection.Find(context.TODO(), emptyFilter)
-	if err != nil {
-		log.Fatal(err)
-		log.Fatal("Error while retrieving all planets")
-	}
-
-	// Parsing list of planets
-	for cursor.Next(context.TODO()) {
-		var tempPlanet Planet
-		err := cursor.Decode(&tempPlanet)
-		if err != nil {
-			log.Fatal(err)
-			log.Fatal("Could not parse list of planets")
-		}
-
-		if ! tempPlanet.IsEmpty() {
-			planets = append(planets, tempPlanet)
-		}
-	}
-
-	return planets
+/* Repository */
+
+/*ErrPlanetNotFound is returned when no planet matches the informed id or name*/
+var ErrPlanetNotFound = NewError(CodeNotFound, "planet not found", nil)
+
+/*ErrDuplicatedPlanet is returned when a planet with the same name is already stored*/
+var ErrDuplicatedPlanet = NewError(CodeConflict, "planet already exists", nil)
+
+/*PlanetRepository ... Storage of planets. paramName is always "id" or "name".
+Deletes move planets to the trash. Trashed planets are left out of every method but Restore, Purge and List of trashed planets,
+and their names may be reused*/
+type PlanetRepository interface {
+	Insert(ctx context.Context, newPlanet Planet) (string, error)
+	// Inserts planets with their IDs already set, going on after failures. Returns one error per planet,
+	// nil for inserted ones. The second error is only set when the insertion failed as a whole
+	InsertMany(ctx context.Context, newPlanets []Planet) ([]error, error)
+	Get(ctx context.Context, paramName, paramValue string) (Planet, error)
+	List(ctx context.Context, listOptions ListOptions) (PlanetPage, error)
+	Delete(ctx context.Context, paramName, paramValue string) error
+	// Deletes every planet with paramName in paramValues. Returns the values of the deleted ones
+	DeleteMany(ctx context.Context, paramName string, paramValues []string) ([]string, error)
+	Update(ctx context.Context, id string, updatedPlanet Planet) (Planet, error)
+	Upsert(ctx context.Context, planet Planet) (UpsertResult, error)
+	// Saves only SWAPI fields and sync bookkeeping of syncedPlanet
+	UpdateSync(ctx context.Context, syncedPlanet Planet) error
+	// Takes the trashed planet with id out of the trash. Returns it as it was in the trash.
+	// Fails with ErrDuplicatedPlanet when its name was reused meanwhile
+	Restore(ctx context.Context, id string) (Planet, error)
+	// Deletes for good up to limit planets trashed before deletedBefore, oldest first. Returns the planets deleted
+	Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]Planet, error)
+	// Fails while the storage can't serve requests
+	CheckHealth(ctx context.Context) error
 }
 
-/*SelectPlanetByParam gets planets from database by paramName id or name */
-func SelectPlanetByParam(paramName string, paramValue ...interface{}) Planet {
-	if len(paramValue) != 1 {
-		panic("Please, inform just one parameter for SelectPlanetByParam")
-	}
-	var planet Planet
-	var dbParamName string
-	value := paramValue[0]
-	if paramName == "id" {
-		dbParamName = "_id"
-		strValue := fmt.Sprintf("%v", value)
-		value, _ = primitive.ObjectIDFromHex(strValue)
-	} else {
-		dbParamName = paramName
-	}
-	filter := bson.D{{dbParamName, value}}
-	err := collection.FindOne(context.TODO(), filter).Decode(&planet)
-	if err != nil {
-		log.Println(
-			"Error while retrieving planet with " + paramName + " = " + paramValue[0].(string), "\n",
-			err,
-		)
-	}
-
-	return planet
-}
+/*UpsertResult ... What an upsert did to the stored planet*/
+type UpsertResult string
 
-/*DeletePlanetByParam delets a planet from database, informing a name or id*/
-func DeletePlanetByParam(paramName string, paramValue ...interface{}) (bool, string) {
-	if len(paramValue) != 1 {
-		panic("Please, inform just one parameter for DeletePlanetByParam")
-	}
-	var deleted bool = false
-	var errorMessage string = ""
-	var dbParamName string
-	value := paramValue[0]
-	if paramName == "id" {
-		dbParamName = "_id"
-		strValue := fmt.Sprintf("%v", value)
-		value, _ = primitive.ObjectIDFromHex(strValue)
-	} else {
-		dbParamName = paramName
-	}
-	filter := bson.D{{dbParamName, value}}
-
-	result, err := collection.DeleteOne(context.TODO(), filter)
-	if err != nil {
-		errorMessage = "Error while deleting planet with " + paramName + " = " + paramValue[0].(string)
-		log.Fatal(err)
-		log.Fatal(errorMessage)
-	} else {
-		deleted = result.DeletedCount > 0
-		if !deleted {
-			errorMessage = "Planet with " + paramName + " = " + paramValue[0].(string) + " not found"
-		}
-	}
-	return deleted, errorMessage
-}
\ No newline at end of file
+const (
+	UpsertCreated UpsertResult = "created"
+	UpsertUpdated UpsertResult = "updated"
+	UpsertUnchanged UpsertResult = "unchanged"
+)
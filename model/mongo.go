@@ -0,0 +1,558 @@
+package model
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+)
+
+
+/* Database functions */
+
+/*MongoSettings ... How to reach the database*/
+type MongoSettings struct {
+	// Replaces Host, Port, User and Password when informed
+	URI string
+	Host string
+	Port string
+	// Empty connects without authentication
+	User string
+	Password string
+	DatabaseName string
+	CollectionName string
+	ConnectTimeout time.Duration
+	// nil connects without TLS
+	TLS *tls.Config
+}
+
+func makeURI(host, port, databaseName string) string {
+	uri := "mongodb" + "://" + host + ":" + port + "/" + databaseName + "?retryWrites=true&w=majority"
+	return uri
+}
+
+/*clientOptions translates settings into options of the mongo driver*/
+func (settings MongoSettings) clientOptions() *options.ClientOptions {
+	var clientOptions *options.ClientOptions
+	if settings.URI != "" {
+		clientOptions = options.Client().ApplyURI(settings.URI)
+	} else {
+		clientOptions = options.Client().ApplyURI(makeURI(settings.Host, settings.Port, settings.DatabaseName))
+		if settings.User != "" {
+			clientOptions.SetAuth(options.Credential{
+				Username: settings.User,
+				Password: settings.Password,
+				AuthMechanism: "",
+			})
+		}
+	}
+
+	// Keeps TLS options of the URI, if any
+	if settings.TLS != nil {
+		clientOptions.SetTLSConfig(settings.TLS)
+	}
+	return clientOptions
+}
+
+/*describe tells where settings point to, without credentials*/
+func (settings MongoSettings) describe() string {
+	if settings.URI == "" {
+		return settings.Host + ":" + settings.Port
+	}
+
+	if parsedURI, err := url.Parse(settings.URI); err == nil {
+		return parsedURI.Host
+	}
+	return "mongo URI"
+}
+
+func MongoDBConnect(ctx context.Context, settings MongoSettings) (*mongo.Client, *mongo.Collection, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, settings.ConnectTimeout)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, settings.clientOptions())
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not connect to mongo db: %w", err)
+	}
+
+	database := client.Database(settings.DatabaseName)
+	collection := database.Collection(settings.CollectionName)
+
+	if err = ensureNameIndex(ctx, collection); err != nil {
+		logging.Warn(ctx, "Could not create the unique name index. Not ready until it is created", logging.Fields{"error": err})
+	}
+
+	logging.Info(ctx, "Connected to database", logging.Fields{
+		"database": settings.DatabaseName,
+		"collection": settings.CollectionName,
+		"host": settings.describe(),
+		"tls": settings.TLS != nil,
+	})
+
+	return client, collection, nil
+
+}
+
+/*Unique name index of versions without a trash. Trashed names could not be reused while it exists*/
+const LEGACY_NAME_INDEX string = "name_1"
+
+/*Code of mongo errors dropping indexes that don't exist*/
+const indexNotFoundCode = 27
+
+/*ensureNameIndex makes sure two live planets cannot share the same name. Live planets have no deletedAt, indexed as null,
+while each trashed planet has its own. Does nothing if the index already exists. The legacy index is dropped once this one exists*/
+func ensureNameIndex(ctx context.Context, collection *mongo.Collection) error {
+	nameIndex := mongo.IndexModel{
+		Keys: bson.D{{"name", 1}, {"deletedAt", 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{
+				{"name", bson.D{
+					{"$exists", true},
+				}},
+			}),
+	}
+
+	if _, err := collection.Indexes().CreateOne(ctx, nameIndex); err != nil {
+		return err
+	}
+
+	_, err := collection.Indexes().DropOne(ctx, LEGACY_NAME_INDEX)
+	if commandError, isCommandError := err.(mongo.CommandError); isCommandError && commandError.Code == indexNotFoundCode {
+		return nil
+	}
+	return err
+}
+
+/*MongoDBDisconnect closes every connection of client, waiting for operations in progress until ctx is done*/
+func MongoDBDisconnect(ctx context.Context, client *mongo.Client) error {
+	logging.Info(ctx, "Disconnecting from database", nil)
+
+	if err := client.Disconnect(ctx); err != nil {
+		return fmt.Errorf("could not disconnect from mongo db: %w", err)
+	}
+
+	return nil
+}
+
+/*makeFilter translates "id" or "name" params into a mongo filter of live planets*/
+func makeFilter(paramName, paramValue string) bson.D {
+	if paramName == "id" {
+		// Invalid hexes become NilObjectID, which matches nothing
+		objectID, _ := primitive.ObjectIDFromHex(paramValue)
+		return bson.D{{"_id", objectID}, {"deletedAt", nil}}
+	}
+
+	return bson.D{{paramName, paramValue}, {"deletedAt", nil}}
+}
+
+/*makeManyFilter matches live planets with paramName in paramValues*/
+func makeManyFilter(paramName string, paramValues []string) bson.D {
+	if paramName == "id" {
+		objectIDs := bson.A{}
+		for _, paramValue := range paramValues {
+			// Invalid hexes match nothing
+			if objectID, err := primitive.ObjectIDFromHex(paramValue); err == nil {
+				objectIDs = append(objectIDs, objectID)
+			}
+		}
+		return bson.D{{"_id", bson.D{{"$in", objectIDs}}}, {"deletedAt", nil}}
+	}
+
+	return bson.D{{paramName, bson.D{{"$in", paramValues}}}, {"deletedAt", nil}}
+}
+
+/*Code of mongo errors caused by unique indexes*/
+const duplicateKeyCode = 11000
+
+/*isDuplicateKeyError checks if mongo refused a write because of the unique name index*/
+func isDuplicateKeyError(err error) bool {
+	switch mongoError := err.(type) {
+	case mongo.WriteException:
+		for _, writeError := range mongoError.WriteErrors {
+			if writeError.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	case mongo.BulkWriteException:
+		for _, writeError := range mongoError.WriteErrors {
+			if writeError.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return mongoError.Code == duplicateKeyCode
+	}
+
+	return false
+}
+
+
+/* Mongo repository */
+
+/*MongoRepository ... PlanetRepository backed by a mongo collection*/
+type MongoRepository struct {
+	collection *mongo.Collection
+	// Set once the unique name index is known to exist
+	nameIndexReady int32
+}
+
+func NewMongoRepository(collection *mongo.Collection) *MongoRepository {
+	return &MongoRepository{collection: collection}
+}
+
+/*CheckHealth pings mongo and makes sure the unique name index exists, creating it if needed*/
+func (repository *MongoRepository) CheckHealth(ctx context.Context) error {
+	if err := repository.collection.Database().Client().Ping(ctx, readpref.Primary()); err != nil {
+		return fmt.Errorf("could not ping mongo: %w", err)
+	}
+
+	if atomic.LoadInt32(&repository.nameIndexReady) == 0 {
+		if err := ensureNameIndex(ctx, repository.collection); err != nil {
+			return fmt.Errorf("unique name index is missing: %w", err)
+		}
+		atomic.StoreInt32(&repository.nameIndexReady, 1)
+	}
+
+	return nil
+}
+
+/*Insert adds a new planet to the database. Refuses planets with the same name*/
+func (repository *MongoRepository) Insert(ctx context.Context, newPlanet Planet) (string, error) {
+	result, err := repository.collection.InsertOne(ctx, newPlanet.Untrashed())
+
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return "", ErrDuplicatedPlanet
+		}
+		return "", fmt.Errorf("error while saving planet %s: %w", newPlanet.Name, err)
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func (repository *MongoRepository) InsertMany(ctx context.Context, newPlanets []Planet) ([]error, error) {
+	insertErrors := make([]error, len(newPlanets))
+	if len(newPlanets) == 0 {
+		return insertErrors, nil
+	}
+
+	documents := make([]interface{}, len(newPlanets))
+	for index, newPlanet := range newPlanets {
+		documents[index] = newPlanet.Untrashed()
+	}
+
+	_, err := repository.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	bulkError, isBulkError := err.(mongo.BulkWriteException)
+	switch {
+	case err == nil:
+		return insertErrors, nil
+	case !isBulkError || bulkError.WriteConcernError != nil:
+		return insertErrors, fmt.Errorf("error while saving %d planets: %w", len(newPlanets), err)
+	}
+
+	for _, writeError := range bulkError.WriteErrors {
+		if writeError.Index < 0 || writeError.Index >= len(newPlanets) {
+			continue
+		}
+		if writeError.Code == duplicateKeyCode {
+			insertErrors[writeError.Index] = ErrDuplicatedPlanet
+		} else {
+			insertErrors[writeError.Index] = fmt.Errorf(
+				"error while saving planet %s: %w", newPlanets[writeError.Index].Name, writeError,
+			)
+		}
+	}
+
+	return insertErrors, nil
+}
+
+/*Get gets a planet from database by paramName id or name */
+func (repository *MongoRepository) Get(ctx context.Context, paramName, paramValue string) (Planet, error) {
+	var planet Planet
+
+	err := repository.collection.FindOne(ctx, makeFilter(paramName, paramValue)).Decode(&planet)
+	if err == mongo.ErrNoDocuments {
+		return planet, ErrPlanetNotFound
+	}
+	if err != nil {
+		return planet, fmt.Errorf("error while retrieving planet with %s = %s: %w", paramName, paramValue, err)
+	}
+
+	return planet, nil
+}
+
+/*List retrieves one page of planets from database. Filters, sorting and pagination run on mongo*/
+func (repository *MongoRepository) List(ctx context.Context, listOptions ListOptions) (PlanetPage, error) {
+	var page PlanetPage
+
+	field, descending, err := listOptions.sortField()
+	if err != nil {
+		return page, err
+	}
+
+	filter := listOptions.mongoFilter()
+	page.Total, err = repository.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return page, fmt.Errorf("error while counting planets: %w", err)
+	}
+
+	var before bool
+	if listOptions.Cursor != "" {
+		var position Planet
+		if position, before, err = decodeCursor(listOptions.Cursor); err != nil {
+			return page, err
+		}
+		// Paging back walks the listing in reverse from the position, and turns the planets found around
+		filter = bson.D{{"$and", bson.A{filter, keysetFilter(position, field, descending != before)}}}
+	}
+
+	direction := 1
+	if descending != before {
+		direction = -1
+	}
+	findOptions := options.Find().SetSort(bson.D{{field, direction}, {"_id", direction}})
+	if skip := listOptions.skip(); skip > 0 {
+		findOptions.SetSkip(int64(skip))
+	}
+	if listOptions.Limit > 0 {
+		// One extra planet tells if there is a next page
+		findOptions.SetLimit(int64(listOptions.Limit + 1))
+	}
+
+	cursor, err := repository.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return page, fmt.Errorf("error while retrieving planets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	// Parsing list of planets
+	var planets []Planet
+	for cursor.Next(ctx) {
+		var tempPlanet Planet
+		err := cursor.Decode(&tempPlanet)
+		if err != nil {
+			return page, fmt.Errorf("could not parse list of planets: %w", err)
+		}
+
+		planets = append(planets, tempPlanet)
+	}
+	if err = cursor.Err(); err != nil {
+		return page, fmt.Errorf("error while retrieving planets: %w", err)
+	}
+
+	if before {
+		for left, right := 0, len(planets) - 1; left < right; left, right = left + 1, right - 1 {
+			planets[left], planets[right] = planets[right], planets[left]
+		}
+	}
+	cutPage(&page, planets, listOptions, before)
+	return page, nil
+}
+
+/*trashUpdate moves planets to the trash on behalf of the actor of ctx*/
+func trashUpdate(ctx context.Context) bson.D {
+	return bson.D{{"$set", bson.D{{"deletedAt", time.Now().UTC()}, {"deletedBy", ActorFrom(ctx).ID}}}}
+}
+
+/*Delete moves a planet to the trash, informing a name or id*/
+func (repository *MongoRepository) Delete(ctx context.Context, paramName, paramValue string) error {
+	result, err := repository.collection.UpdateOne(ctx, makeFilter(paramName, paramValue), trashUpdate(ctx))
+	if err != nil {
+		return fmt.Errorf("error while deleting planet with %s = %s: %w", paramName, paramValue, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrPlanetNotFound
+	}
+
+	return nil
+}
+
+func (repository *MongoRepository) DeleteMany(ctx context.Context, paramName string, paramValues []string) ([]string, error) {
+	deletedValues := []string{}
+
+	projection := options.Find().SetProjection(bson.D{{"_id", 1}, {"name", 1}})
+	cursor, err := repository.collection.Find(ctx, makeManyFilter(paramName, paramValues), projection)
+	if err != nil {
+		return deletedValues, fmt.Errorf("error while finding planets to delete: %w", err)
+	}
+
+	var foundPlanets []Planet
+	if err = cursor.All(ctx, &foundPlanets); err != nil {
+		return deletedValues, fmt.Errorf("error while finding planets to delete: %w", err)
+	}
+	if len(foundPlanets) == 0 {
+		return deletedValues, nil
+	}
+
+	objectIDs := bson.A{}
+	for _, foundPlanet := range foundPlanets {
+		objectIDs = append(objectIDs, foundPlanet.ID)
+	}
+	_, err = repository.collection.UpdateMany(ctx, bson.D{{"_id", bson.D{{"$in", objectIDs}}}}, trashUpdate(ctx))
+	if err != nil {
+		return deletedValues, fmt.Errorf("error while deleting %d planets: %w", len(foundPlanets), err)
+	}
+
+	for _, foundPlanet := range foundPlanets {
+		if paramName == "id" {
+			deletedValues = append(deletedValues, foundPlanet.ID.Hex())
+		} else {
+			deletedValues = append(deletedValues, foundPlanet.Name)
+		}
+	}
+
+	return deletedValues, nil
+}
+
+/*Update replaces the planet with the informed id. The unique name index still applies*/
+func (repository *MongoRepository) Update(ctx context.Context, id string, updatedPlanet Planet) (Planet, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Planet{}, ErrPlanetNotFound
+	}
+	updatedPlanet = updatedPlanet.Untrashed()
+	updatedPlanet.ID = objectID
+
+	result, err := repository.collection.ReplaceOne(ctx, bson.D{{"_id", objectID}, {"deletedAt", nil}}, updatedPlanet)
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return Planet{}, ErrDuplicatedPlanet
+		}
+		return Planet{}, fmt.Errorf("error while updating planet with id = %s: %w", id, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return Planet{}, ErrPlanetNotFound
+	}
+
+	return updatedPlanet, nil
+}
+
+/*Upsert creates or updates the planet with the same name, keeping its id*/
+func (repository *MongoRepository) Upsert(ctx context.Context, planet Planet) (UpsertResult, error) {
+	var previousPlanet Planet
+
+	update := bson.D{{"$set", bson.D{
+		{"climate", planet.Climate},
+		{"terrain", planet.Terrain},
+		{"appearencesCount", planet.AppearencesCount},
+		{"planetSwapiURL", planet.PlanetSwapiURL},
+		{"swapiStatus", planet.SwapiStatus},
+		{"swapiMatchConfidence", planet.SwapiMatchConfidence},
+	}}}
+	upsertOptions := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.Before)
+
+	err := repository.collection.FindOneAndUpdate(
+		ctx, bson.D{{"name", planet.Name}, {"deletedAt", nil}}, update, upsertOptions,
+	).Decode(&previousPlanet)
+
+	if err == mongo.ErrNoDocuments {
+		return UpsertCreated, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error while upserting planet %s: %w", planet.Name, err)
+	}
+
+	planet.ID = previousPlanet.ID
+	if previousPlanet.SameContent(planet) {
+		return UpsertUnchanged, nil
+	}
+
+	return UpsertUpdated, nil
+}
+
+/*UpdateSync saves SWAPI fields and sync bookkeeping, leaving fields edited by users untouched*/
+func (repository *MongoRepository) UpdateSync(ctx context.Context, syncedPlanet Planet) error {
+	update := bson.D{{"$set", bson.D{
+		{"appearencesCount", syncedPlanet.AppearencesCount},
+		{"planetSwapiURL", syncedPlanet.PlanetSwapiURL},
+		{"swapiStatus", syncedPlanet.SwapiStatus},
+		{"swapiMatchConfidence", syncedPlanet.SwapiMatchConfidence},
+		{"lastSyncedAt", syncedPlanet.LastSyncedAt},
+		{"syncStatus", syncedPlanet.SyncStatus},
+	}}}
+
+	result, err := repository.collection.UpdateOne(ctx, bson.D{{"_id", syncedPlanet.ID}, {"deletedAt", nil}}, update)
+	if err != nil {
+		return fmt.Errorf("error while saving sync of planet with id = %s: %w", syncedPlanet.ID.Hex(), err)
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrPlanetNotFound
+	}
+
+	return nil
+}
+
+/*Restore refuses names used by live planets, through the unique name index*/
+func (repository *MongoRepository) Restore(ctx context.Context, id string) (Planet, error) {
+	var trashedPlanet Planet
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return trashedPlanet, ErrPlanetNotFound
+	}
+
+	err = repository.collection.FindOneAndUpdate(
+		ctx,
+		bson.D{{"_id", objectID}, {"deletedAt", bson.D{{"$ne", nil}}}},
+		bson.D{{"$unset", bson.D{{"deletedAt", ""}, {"deletedBy", ""}}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&trashedPlanet)
+
+	switch {
+	case err == mongo.ErrNoDocuments:
+		return trashedPlanet, ErrPlanetNotFound
+	case isDuplicateKeyError(err):
+		return trashedPlanet, ErrDuplicatedPlanet
+	case err != nil:
+		return trashedPlanet, fmt.Errorf("error while restoring planet with id = %s: %w", id, err)
+	}
+
+	return trashedPlanet, nil
+}
+
+func (repository *MongoRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]Planet, error) {
+	var expired []Planet
+	expiredFilter := bson.D{{"deletedAt", bson.D{{"$lt", deletedBefore}}}}
+
+	findOptions := options.Find().SetSort(bson.D{{"deletedAt", 1}}).SetLimit(int64(limit))
+	cursor, err := repository.collection.Find(ctx, expiredFilter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error while finding planets to purge: %w", err)
+	}
+	// Nothing is purged yet, so planets decoded before failures aren't returned
+	if err = cursor.All(ctx, &expired); err != nil {
+		return nil, fmt.Errorf("error while finding planets to purge: %w", err)
+	}
+	if len(expired) == 0 {
+		return expired, nil
+	}
+
+	objectIDs := bson.A{}
+	for _, planet := range expired {
+		objectIDs = append(objectIDs, planet.ID)
+	}
+	// Still trashed, in case some were restored meanwhile
+	purgeFilter := append(bson.D{{"_id", bson.D{{"$in", objectIDs}}}}, expiredFilter...)
+	if _, err = repository.collection.DeleteMany(ctx, purgeFilter); err != nil {
+		return nil, fmt.Errorf("error while purging %d planets: %w", len(expired), err)
+	}
+
+	return expired, nil
+}
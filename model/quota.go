@@ -0,0 +1,60 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/ratelimit"
+)
+
+
+/*How long counts of a day are kept after it starts. Mongo drops them later on*/
+const QUOTA_RETENTION time.Duration = 48 * time.Hour
+
+/*Document of the quotas collection*/
+type quotaDocument struct {
+	ID string `bson:"_id"`
+	Count int64 `bson:"count"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+/*MongoQuotaStore ... Daily request counts (ratelimit.QuotaStore) backed by a mongo collection, so every instance shares them*/
+type MongoQuotaStore struct {
+	collection *mongo.Collection
+}
+
+/*NewMongoQuotaStore also lets mongo delete counts of past days by itself*/
+func NewMongoQuotaStore(ctx context.Context, collection *mongo.Collection) *MongoQuotaStore {
+	expirationIndex := mongo.IndexModel{
+		Keys: bson.D{{"expiresAt", 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, expirationIndex); err != nil {
+		logging.Warn(ctx, "Could not create expiration index of quotas", logging.Fields{"error": err})
+	}
+
+	return &MongoQuotaStore{collection: collection}
+}
+
+func (store *MongoQuotaStore) Increment(ctx context.Context, key string, day time.Time) (int64, error) {
+	var document quotaDocument
+	id := ratelimit.QuotaID(key, day)
+	update := bson.D{
+		{"$inc", bson.D{{"count", 1}}},
+		{"$setOnInsert", bson.D{{"expiresAt", day.Add(QUOTA_RETENTION)}}},
+	}
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	err := store.collection.FindOneAndUpdate(ctx, bson.D{{"_id", id}}, update, findOptions).Decode(&document)
+	if isDuplicateKeyError(err) {
+		// Lost the race to create the count of the day. It exists now
+		err = store.collection.FindOneAndUpdate(ctx, bson.D{{"_id", id}}, update, findOptions).Decode(&document)
+	}
+
+	return document.Count, err
+}
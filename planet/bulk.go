@@ -0,0 +1,169 @@
+package planet
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/swapi"
+)
+
+
+/*How many SWAPI resolutions of a batch run at the same time*/
+const MAX_CONCURRENT_RESOLUTIONS int = 8
+
+/*BulkStatus ... Outcome of one item of a batch*/
+type BulkStatus string
+
+const (
+	BulkCreated BulkStatus = "created"
+	BulkDuplicate BulkStatus = "duplicate"
+	BulkInvalid BulkStatus = "invalid"
+	BulkDeleted BulkStatus = "deleted"
+	BulkNotFound BulkStatus = "not_found"
+	// SWAPI or the database failed. Retrying may work
+	BulkFailed BulkStatus = "failed"
+)
+
+/*BulkResult ... Outcome of the item at Index of a batch*/
+type BulkResult struct {
+	Index int `json:"index"`
+	ID string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Status BulkStatus `json:"status"`
+	Error *model.Error `json:"error,omitempty"`
+}
+
+/*failResult marks result as failed by err, picking the status from its code*/
+func failResult(result *BulkResult, err error) {
+	result.Error = model.AsError(err)
+
+	switch result.Error.Code {
+	case model.CodeValidation:
+		result.Status = BulkInvalid
+	case model.CodeConflict:
+		result.Status = BulkDuplicate
+	case model.CodeNotFound:
+		result.Status = BulkNotFound
+	default:
+		result.Status = BulkFailed
+	}
+}
+
+/*Creates every planet it can, resolving SWAPI fields of a few planets at a time. Returns one result per planet*/
+func AddNewPlanets(ctx context.Context, swapiClient swapi.SWAPIClient, newPlanets []model.Planet) ([]BulkResult, error) {
+	results := make([]BulkResult, len(newPlanets))
+	for index := range newPlanets {
+		results[index] = BulkResult{Index: index, Name: newPlanets[index].Name}
+
+		var err error
+		newPlanets[index].Name, err = PrepareString(newPlanets[index].Name)
+		if err != nil {
+			failResult(&results[index], err)
+			continue
+		}
+		results[index].Name = newPlanets[index].Name
+	}
+
+	// Resolve SWAPI fields
+	var waitGroup sync.WaitGroup
+	slots := make(chan struct{}, MAX_CONCURRENT_RESOLUTIONS)
+	for index := range newPlanets {
+		if results[index].Error != nil {
+			continue
+		}
+
+		waitGroup.Add(1)
+		slots <- struct{}{}
+		go func(index int) {
+			defer waitGroup.Done()
+			defer func() { <-slots }()
+
+			if err := ResolveSWAPIFields(ctx, swapiClient, &newPlanets[index]); err != nil {
+				failResult(&results[index], err)
+			}
+		}(index)
+	}
+	waitGroup.Wait()
+
+	// Insert resolved planets at once
+	var resolvedPlanets []model.Planet
+	var resolvedIndexes []int
+	for index := range newPlanets {
+		if results[index].Error != nil {
+			continue
+		}
+
+		newPlanets[index].ID = primitive.NewObjectID()
+		resolvedPlanets = append(resolvedPlanets, newPlanets[index])
+		resolvedIndexes = append(resolvedIndexes, index)
+	}
+
+	insertErrors, err := repository.InsertMany(ctx, resolvedPlanets)
+	for position, index := range resolvedIndexes {
+		switch {
+		case insertErrors[position] != nil:
+			failResult(&results[index], describeDuplicated(insertErrors[position], newPlanets[index].Name))
+		case err != nil:
+			failResult(&results[index], err)
+		default:
+			results[index].ID = newPlanets[index].ID.Hex()
+			results[index].Status = BulkCreated
+		}
+	}
+
+	return results, err
+}
+
+/*Removes every planet with paramName, id or name, in values. Returns one result per value*/
+func RemovePlanets(ctx context.Context, paramName string, values []string) ([]BulkResult, error) {
+	results := make([]BulkResult, len(values))
+	var removableValues []string
+	for index, value := range values {
+		results[index] = BulkResult{Index: index}
+
+		removableValue, err := prepareParam(paramName, value)
+		if paramName == "id" {
+			// Deleted ids come back in lower case hex, whatever the case they were sent in
+			if objectID, hexErr := primitive.ObjectIDFromHex(removableValue); hexErr == nil {
+				removableValue = objectID.Hex()
+			}
+			results[index].ID = removableValue
+		} else {
+			results[index].Name = removableValue
+		}
+		if err != nil {
+			failResult(&results[index], err)
+			continue
+		}
+		removableValues = append(removableValues, removableValue)
+	}
+
+	deletedValues, err := repository.DeleteMany(ctx, paramName, removableValues)
+	deleted := map[string]bool{}
+	for _, deletedValue := range deletedValues {
+		deleted[deletedValue] = true
+	}
+
+	for index := range results {
+		if results[index].Error != nil {
+			continue
+		}
+
+		removableValue := results[index].ID + results[index].Name
+		switch {
+		case deleted[removableValue]:
+			results[index].Status = BulkDeleted
+			// Repeated values are only deleted once
+			delete(deleted, removableValue)
+		case err != nil:
+			failResult(&results[index], err)
+		default:
+			failResult(&results[index], describeNotFound(model.ErrPlanetNotFound, paramName, removableValue))
+		}
+	}
+
+	return results, err
+}
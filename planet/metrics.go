@@ -0,0 +1,31 @@
+package planet
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/metrics"
+)
+
+
+/*How long scrapes wait for planets to be counted. Set with UseCountTimeout*/
+var countTimeout = 2 * time.Second
+
+func UseCountTimeout(timeout time.Duration) {
+	countTimeout = timeout
+}
+
+var storedPlanets = metrics.NewGaugeFunc("planets_stored", "Planets stored, read on every scrape.", readStoredPlanets)
+
+/*readStoredPlanets counts planets for scrapes. Fails, skipping the gauge, until a repository is set*/
+func readStoredPlanets() (float64, error) {
+	if repository == nil {
+		return 0, errors.New("no repository to count planets on")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+	defer cancel()
+	total, err := CountPlanets(ctx)
+	return float64(total), err
+}
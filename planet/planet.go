@@ -1,11 +1,22 @@
 package planet
 
 import (
+	"context"
 	"strings"
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
 	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/swapi"
 )
 
 
+/*Storage used by every planet function. Must be set with UseRepository before serving*/
+var repository model.PlanetRepository
+
+func UseRepository(planetRepository model.PlanetRepository) {
+	repository = planetRepository
+}
+
+
 func capitalizeName(name string) string {
 	var capitalizedName string
 
@@ -18,84 +29,168 @@ func capitalizeName(name string) string {
 	return capitalizedName
 }
 
-/*Applies PrepareString if request is search or delete by name*/
-func prepareParam(paramName string, value ...interface{}) (string, string) {
-	var searcheableValue string
-	var errorMessage string = ""
+/*ErrEmptyParam is returned when a name is empty after trimming*/
+var ErrEmptyParam = model.NewError(model.CodeValidation, "Could not do action for empty param", nil)
 
+/*Applies PrepareString if request is search or delete by name*/
+func prepareParam(paramName string, value ...interface{}) (string, error) {
 	if paramName == "name" {
-		searcheableValue, errorMessage = PrepareString(value[0].(string))
-	} else {
-		searcheableValue = value[0].(string)
+		return PrepareString(value[0].(string))
 	}
 
-	return searcheableValue, errorMessage
+	return value[0].(string), nil
 }
 
 /*Applies trim by space and capitalization*/
-func PrepareString(name string) (string, string) {
+func PrepareString(name string) (string, error) {
 	trimmedName := strings.Trim(name, " ")
 	capitalizedName := capitalizeName(trimmedName)
 
-	errorMessage := ""
 	if len(capitalizedName) == 0 {
-		errorMessage = "Could not do action for empty param"
+		return capitalizedName, ErrEmptyParam
 	}
 
-	return capitalizedName, errorMessage
+	return capitalizedName, nil
 }
 
+/*Describes not found errors with the param used to look the planet up*/
+func describeNotFound(err error, paramName, paramValue string) error {
+	if err == model.ErrPlanetNotFound {
+		return model.ErrPlanetNotFound.Describe(
+			"Planet with " + paramName + " = " + paramValue + " not found",
+			map[string]interface{}{paramName: paramValue},
+		)
+	}
 
-/* Functions */
+	return err
+}
 
-/*Creates new planet*/
-func AddNewPlanet(newPlanet model.Planet) (bool, string, string) {
-	
-	var created bool = false
-	var errorMessage string = ""
-	var planetUUID string
+/*Describes duplicated errors with the name already taken*/
+func describeDuplicated(err error, name string) error {
+	if err == model.ErrDuplicatedPlanet {
+		return model.ErrDuplicatedPlanet.Describe(
+			"Planet " + name + " already exists",
+			map[string]interface{}{"name": name},
+		)
+	}
 
-	if !newPlanet.IsEmpty() {
-		newPlanet.Name, errorMessage = PrepareString(newPlanet.Name)
+	return err
+}
 
-		if errorMessage == "" {
-			created,  planetUUID, errorMessage = model.InsertPlanet(newPlanet)
-		}
+
+/* Functions */
+
+/*Creates new planet and returns its id*/
+func AddNewPlanet(ctx context.Context, newPlanet model.Planet) (string, error) {
+	var err error
+	newPlanet.Name, err = PrepareString(newPlanet.Name)
+	if err != nil {
+		return "", err
 	}
 
-	return created, planetUUID, errorMessage
+	planetUUID, err := repository.Insert(ctx, newPlanet)
+	return planetUUID, describeDuplicated(err, newPlanet.Name)
 }
 
-/* Retrieve all planets from database and returns it*/
-func GetAllPlanets() []model.Planet {
-	var planets []model.Planet
-	planets = model.GetPlanetsFromDB()
+/* Retrieve one page of planets from database and returns it*/
+func GetAllPlanets(ctx context.Context, listOptions model.ListOptions) (model.PlanetPage, error) {
+	if err := listOptions.Validate(); err != nil {
+		return model.PlanetPage{}, err
+	}
 
-	return planets
+	page, err := repository.List(ctx, listOptions)
+	if err != nil {
+		logging.Error(ctx, "Could not retrieve planets", logging.Fields{"error": err})
+	}
+
+	return page, err
 }
 
 // Searches planet by id or name and returns Planet. Case insensitive
-func SearchByParam(paramName string, value ...interface{}) (model.Planet, string) {
-	var planet model.Planet
+func SearchByParam(ctx context.Context, paramName string, value ...interface{}) (model.Planet, error) {
+	searcheableValue, err := prepareParam(paramName, value[0])
+	if err != nil {
+		return model.Planet{}, err
+	}
 
-	searcheableValue, errorMessage := prepareParam(paramName, value[0])
+	planet, err := repository.Get(ctx, paramName, searcheableValue)
+	return planet, describeNotFound(err, paramName, searcheableValue)
+}
+
+// Removes a planet by id or name
+func RemovePlanetByParam(ctx context.Context, paramName string, value ...interface{}) error {
+	removableValue, err := prepareParam(paramName, value[0])
+	if err != nil {
+		return err
+	}
+
+	err = repository.Delete(ctx, paramName, removableValue)
+	return describeNotFound(err, paramName, removableValue)
+}
 
-	if errorMessage == "" {
-		planet = model.SelectPlanetByParam(paramName, searcheableValue)
+// Replaces every field of the planet with the informed id. Names are prepared like on creation
+func ReplacePlanet(ctx context.Context, id string, updatedPlanet model.Planet) (model.Planet, error) {
+	var err error
+	updatedPlanet.Name, err = PrepareString(updatedPlanet.Name)
+	if err != nil {
+		return model.Planet{}, err
 	}
 
-	return planet, errorMessage
+	savedPlanet, err := repository.Update(ctx, id, updatedPlanet)
+	return savedPlanet, describeDuplicated(describeNotFound(err, "id", id), updatedPlanet.Name)
 }
 
-// Removes a planet by id or name. If planet param not found, returns false
-func RemovePlanetByParam(paramName string, value ...interface{}) (bool, string) {
-	var removed bool = false
-	var errorMessage string = ""
-	removableValue, errorMessage := prepareParam(paramName, value[0]) 
+// Creates the planet or updates the one with the same name
+func UpsertPlanet(ctx context.Context, newPlanet model.Planet) (model.UpsertResult, error) {
+	var err error
+	newPlanet.Name, err = PrepareString(newPlanet.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return repository.Upsert(ctx, newPlanet)
+}
 
-	if errorMessage == "" {
-		removed, errorMessage = model.DeletePlanetByParam(paramName, removableValue)
+/*Fills SWAPI fields of planetToResolve with the SWAPI planet of the same name. Unresolved planets get no appearences*/
+func ResolveSWAPIFields(ctx context.Context, swapiClient swapi.SWAPIClient, planetToResolve *model.Planet) error {
+	resolution, err := swapi.ResolvePlanet(ctx, swapiClient, planetToResolve.Name)
+	if err != nil {
+		logging.Warn(ctx, "Could not search planet on SWAPI", logging.Fields{"name": planetToResolve.Name, "error": err})
+		return &model.Error{
+			Code: model.CodeUpstreamUnavailable,
+			Message: "Could not search " + planetToResolve.Name + " on SWAPI",
+			Details: map[string]interface{}{"reason": err.Error()},
+			Err: err,
+		}
 	}
 
-	return removed, errorMessage
-}
\ No newline at end of file
+	planetToResolve.AppearencesCount = len(resolution.Planet.Films)
+	planetToResolve.PlanetSwapiURL = resolution.Planet.URL
+	planetToResolve.SwapiStatus = string(resolution.Status)
+	planetToResolve.SwapiMatchConfidence = string(resolution.Confidence)
+
+	if resolution.Status == swapi.Unresolved {
+		logging.Info(ctx, "Planet matches SWAPI planets, but none of them unambiguously", logging.Fields{
+			"name": planetToResolve.Name,
+			"candidates": resolution.Candidates,
+		})
+	}
+
+	return nil
+}
+
+// Saves SWAPI fields and sync bookkeeping of a refreshed planet
+func SaveSyncedPlanet(ctx context.Context, syncedPlanet model.Planet) error {
+	return repository.UpdateSync(ctx, syncedPlanet)
+}
+
+// Fails while planets can't be stored or read
+func CheckStorage(ctx context.Context) error {
+	return repository.CheckHealth(ctx)
+}
+
+// Counts every stored planet
+func CountPlanets(ctx context.Context) (int64, error) {
+	page, err := repository.List(ctx, model.ListOptions{Limit: 1})
+	return page.Total, err
+}
@@ -0,0 +1,68 @@
+package planet
+
+import (
+	"context"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/*How many planets are purged at a time*/
+const PURGE_BATCH_SIZE int = 500
+
+/*Actor of purges, on the audit log*/
+var PURGER_ACTOR = model.Actor{ID: "purger"}
+
+// Takes the trashed planet with the informed id back, as it was before being deleted
+func RestorePlanet(ctx context.Context, id string) (model.Planet, error) {
+	trashedPlanet, err := repository.Restore(ctx, id)
+	if err == model.ErrDuplicatedPlanet {
+		return model.Planet{}, model.ErrDuplicatedPlanet.Describe(
+			"Planet with id = " + id + " can't be restored, since another planet took its name. Rename or delete that one first",
+			map[string]interface{}{"id": id},
+		)
+	}
+	if err != nil {
+		return model.Planet{}, describeNotFound(err, "id", id)
+	}
+
+	return trashedPlanet.Untrashed(), nil
+}
+
+/*PurgeTrash deletes for good every planet trashed before deletedBefore, a batch at a time. Returns how many were purged*/
+func PurgeTrash(ctx context.Context, deletedBefore time.Time) (int, error) {
+	purged := 0
+	for {
+		purgedPlanets, err := repository.Purge(ctx, deletedBefore, PURGE_BATCH_SIZE)
+		purged += len(purgedPlanets)
+		if err != nil || len(purgedPlanets) < PURGE_BATCH_SIZE {
+			return purged, err
+		}
+	}
+}
+
+/*PurgeTrashEvery purges planets trashed for longer than retention on start and then every interval, until ctx is done.
+Failed purges are logged and tried again on the next interval*/
+func PurgeTrashEvery(ctx context.Context, retention, interval time.Duration) {
+	ctx = model.WithActor(ctx, PURGER_ACTOR)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := PurgeTrash(ctx, time.Now().Add(-retention))
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logging.Error(ctx, "Could not purge trashed planets", logging.Fields{"error": err, "purged": purged})
+		case purged > 0:
+			logging.Info(ctx, "Purged trashed planets", logging.Fields{"purged": purged, "retention": retention.String()})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
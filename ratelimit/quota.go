@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+
+/*QuotaStore ... Counts requests of each key per UTC day. Implementations must be safe for concurrent use*/
+type QuotaStore interface {
+	// Adds a request of key on day, a UTC midnight, returning how many were counted that day so far, this one included
+	Increment(ctx context.Context, key string, day time.Time) (int64, error)
+}
+
+/*Day returns the UTC day of moment, as counted by quotas*/
+func Day(moment time.Time) time.Time {
+	year, month, day := moment.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+/*QuotaID identifies the count of key on day. Shared by every QuotaStore, so counts read the same*/
+func QuotaID(key string, day time.Time) string {
+	return key + "/" + day.Format("2006-01-02")
+}
+
+/*MemoryQuotaStore ... QuotaStore of a single instance. Counts of past days are dropped*/
+type MemoryQuotaStore struct {
+	mutex sync.Mutex
+	day time.Time
+	counts map[string]int64
+}
+
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{counts: map[string]int64{}}
+}
+
+func (store *MemoryQuotaStore) Increment(ctx context.Context, key string, day time.Time) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if day.After(store.day) {
+		for id := range store.counts {
+			if !strings.HasSuffix(id, day.Format("/2006-01-02")) {
+				delete(store.counts, id)
+			}
+		}
+		store.day = day
+	}
+
+	id := QuotaID(key, day)
+	store.counts[id]++
+	return store.counts[id], nil
+}
@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+
+/*Limit ... Token bucket letting Requests through per Per, and up to Burst at once*/
+type Limit struct {
+	Requests int
+	Per time.Duration
+	Burst int
+}
+
+/*Name of the limit of routes without a limit of their own*/
+const DEFAULT_ROUTE string = "default"
+
+var UNITS = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+/*ParseLimit reads limits like 30/m, or 30/m:60 for bursts of 60. Bursts default to the requests*/
+func ParseLimit(text string) (Limit, error) {
+	var limit Limit
+	text = strings.TrimSpace(text)
+
+	rate, burst := text, ""
+	if colon := strings.Index(text, ":"); colon >= 0 {
+		rate, burst = text[:colon], text[colon+1:]
+	}
+	slash := strings.Index(rate, "/")
+	if slash < 0 {
+		return limit, fmt.Errorf("expected a limit like 30/m or 30/m:60, got %q", text)
+	}
+
+	requests, err := strconv.Atoi(rate[:slash])
+	if err != nil || requests < 1 {
+		return limit, fmt.Errorf("requests of %q must be a positive number", text)
+	}
+	per, found := UNITS[rate[slash+1:]]
+	if !found {
+		return limit, fmt.Errorf("unit of %q must be s, m or h", text)
+	}
+	limit = Limit{Requests: requests, Per: per, Burst: requests}
+	if burst != "" {
+		if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst < 1 {
+			return limit, fmt.Errorf("burst of %q must be a positive number", text)
+		}
+	}
+
+	return limit, nil
+}
+
+/*ParseLimits reads comma separated route=limit pairs, like default=300/m,CreatePlanet=30/m:10*/
+func ParseLimits(text string) (map[string]Limit, error) {
+	limits := map[string]Limit{}
+	for _, pair := range strings.Split(text, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		route := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || route == "" {
+			return nil, fmt.Errorf("expected route=limit, like CreatePlanet=30/m, got %q", pair)
+		}
+		if _, found := limits[route]; found {
+			return nil, fmt.Errorf("limit of %s is informed twice", route)
+		}
+		limit, err := ParseLimit(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", route, err)
+		}
+		limits[route] = limit
+	}
+
+	return limits, nil
+}
+
+func (limit Limit) String() string {
+	units := make([]string, 0, len(UNITS))
+	for unit := range UNITS {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	for _, unit := range units {
+		if UNITS[unit] == limit.Per {
+			return fmt.Sprintf("%d/%s:%d", limit.Requests, unit, limit.Burst)
+		}
+	}
+
+	return fmt.Sprintf("%d/%s:%d", limit.Requests, limit.Per, limit.Burst)
+}
+
+/*perSecond is how fast buckets refill*/
+func (limit Limit) perSecond() float64 {
+	return float64(limit.Requests) / limit.Per.Seconds()
+}
+
+/*Decision ... Outcome of taking a request from a bucket*/
+type Decision struct {
+	Allowed bool
+	// Size of the bucket
+	Limit int
+	// Requests left right away
+	Remaining int
+	// Until the bucket is full again
+	Reset time.Duration
+	// Until the next request is allowed. Zero when allowed
+	RetryAfter time.Duration
+}
+
+/*Limiter ... Keeps a token bucket per key. Implementations shared between instances must be safe for concurrent use*/
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Decision, error)
+}
+
+
+/* Memory limiter */
+
+/*How often idle buckets are dropped*/
+const SWEEP_INTERVAL time.Duration = time.Minute
+
+type bucket struct {
+	tokens float64
+	updatedAt time.Time
+	limit Limit
+}
+
+/*MemoryLimiter ... Limiter of a single instance. Full buckets are dropped, so memory follows active clients*/
+type MemoryLimiter struct {
+	mutex sync.Mutex
+	buckets map[string]*bucket
+	lastSweep time.Time
+	now func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: map[string]*bucket{}, lastSweep: time.Now(), now: time.Now}
+}
+
+func (limiter *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Decision, error) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	if now.Sub(limiter.lastSweep) >= SWEEP_INTERVAL {
+		limiter.sweep(now)
+	}
+
+	current, found := limiter.buckets[key]
+	if !found || current.limit != limit {
+		current = &bucket{tokens: float64(limit.Burst), updatedAt: now, limit: limit}
+		limiter.buckets[key] = current
+	}
+	current.refill(now)
+
+	decision := Decision{Limit: limit.Burst}
+	if current.tokens >= 1 {
+		current.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = seconds((1 - current.tokens) / limit.perSecond())
+	}
+	decision.Remaining = int(math.Floor(current.tokens))
+	decision.Reset = seconds((float64(limit.Burst) - current.tokens) / limit.perSecond())
+
+	return decision, nil
+}
+
+func (current *bucket) refill(now time.Time) {
+	elapsed := now.Sub(current.updatedAt).Seconds()
+	if elapsed > 0 {
+		current.tokens = math.Min(float64(current.limit.Burst), current.tokens + elapsed * current.limit.perSecond())
+		current.updatedAt = now
+	}
+}
+
+/*sweep drops buckets full by now, which act like new ones*/
+func (limiter *MemoryLimiter) sweep(now time.Time) {
+	for key, current := range limiter.buckets {
+		current.refill(now)
+		if current.tokens >= float64(current.limit.Burst) {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.lastSweep = now
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		text string
+		want Limit
+		wantErr bool
+	}{
+		{"30/m", Limit{Requests: 30, Per: time.Minute, Burst: 30}, false},
+		{" 5/s:20 ", Limit{Requests: 5, Per: time.Second, Burst: 20}, false},
+		{"1000/h", Limit{Requests: 1000, Per: time.Hour, Burst: 1000}, false},
+		{"30", Limit{}, true},
+		{"0/m", Limit{}, true},
+		{"30/d", Limit{}, true},
+		{"30/m:0", Limit{}, true},
+		{"30/m:lots", Limit{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			limit, err := ParseLimit(test.text)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseLimit() error = %v, want one: %v", err, test.wantErr)
+			}
+			if err == nil && limit != test.want {
+				t.Errorf("ParseLimit() = %+v, want %+v", limit, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	// A request a second, and up to 2 at once
+	limit := Limit{Requests: 60, Per: time.Minute, Burst: 2}
+	otherLimit := Limit{Requests: 1, Per: time.Second, Burst: 1}
+
+	steps := []struct {
+		name string
+		key string
+		limit Limit
+		// Moves the clock forward before the step
+		elapsed time.Duration
+		wantAllowed bool
+		wantRemaining int
+		wantRetryAfter time.Duration
+		wantReset time.Duration
+	}{
+		{"first", "alice", limit, 0, true, 1, 0, time.Second},
+		{"burst", "alice", limit, 0, true, 0, 0, 2 * time.Second},
+		{"past the burst", "alice", limit, 0, false, 0, time.Second, 2 * time.Second},
+		{"another key", "bob", limit, 0, true, 1, 0, time.Second},
+		{"half refilled", "alice", limit, 500 * time.Millisecond, false, 0, 500 * time.Millisecond, 1500 * time.Millisecond},
+		{"refilled", "alice", limit, 500 * time.Millisecond, true, 0, 0, 2 * time.Second},
+		{"refills up to the burst", "alice", limit, time.Hour, true, 1, 0, time.Second},
+		{"another limit starts a new bucket", "alice", otherLimit, 0, true, 0, 0, time.Second},
+	}
+
+	now := time.Date(2020, 5, 4, 12, 0, 0, 0, time.UTC)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+		decision, err := limiter.Allow(context.Background(), step.key, step.limit)
+		if err != nil {
+			t.Fatalf("%s: Allow() error = %v", step.name, err)
+		}
+
+		want := Decision{
+			Allowed: step.wantAllowed,
+			Limit: step.limit.Burst,
+			Remaining: step.wantRemaining,
+			Reset: step.wantReset,
+			RetryAfter: step.wantRetryAfter,
+		}
+		if decision != want {
+			t.Errorf("%s: Allow() = %+v, want %+v", step.name, decision, want)
+		}
+	}
+}
+
+func TestMemoryLimiterSweepsFullBuckets(t *testing.T) {
+	now := time.Date(2020, 5, 4, 12, 0, 0, 0, time.UTC)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	limiter.lastSweep = now
+	limit := Limit{Requests: 1, Per: time.Hour, Burst: 1}
+
+	limiter.Allow(context.Background(), "alice", limit)
+	limiter.Allow(context.Background(), "bob", Limit{Requests: 1, Per: time.Second, Burst: 1})
+	now = now.Add(SWEEP_INTERVAL)
+	limiter.Allow(context.Background(), "carol", limit)
+
+	// Only alice is still waiting for tokens. carol came after the sweep
+	if _, found := limiter.buckets["bob"]; found || len(limiter.buckets) != 2 {
+		t.Errorf("buckets after sweep = %v, want alice and carol", limiter.buckets)
+	}
+}
+
+func TestMemoryQuotaStore(t *testing.T) {
+	day := Day(time.Date(2020, 5, 4, 23, 59, 0, 0, time.FixedZone("UTC-3", -3 * 60 * 60)))
+	if want := time.Date(2020, 5, 5, 0, 0, 0, 0, time.UTC); !day.Equal(want) {
+		t.Fatalf("Day() = %s, want %s", day, want)
+	}
+	nextDay := day.Add(24 * time.Hour)
+
+	steps := []struct {
+		key string
+		day time.Time
+		wantCount int64
+	}{
+		{"alice", day, 1},
+		{"alice", day, 2},
+		{"bob", day, 1},
+		{"alice", day, 3},
+		{"alice", nextDay, 1},
+		{"bob", nextDay, 1},
+	}
+
+	store := NewMemoryQuotaStore()
+	for index, step := range steps {
+		count, err := store.Increment(context.Background(), step.key, step.day)
+		if err != nil {
+			t.Fatalf("step %d: Increment() error = %v", index + 1, err)
+		}
+		if count != step.wantCount {
+			t.Errorf("step %d: Increment(%s, %s) = %d, want %d", index + 1, step.key, step.day.Format("2006-01-02"), count, step.wantCount)
+		}
+	}
+
+	// Counts of past days are dropped
+	if _, found := store.counts[QuotaID("alice", day)]; found || len(store.counts) != 2 {
+		t.Errorf("counts = %v, want the ones of the next day", store.counts)
+	}
+}
@@ -0,0 +1,189 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+	"github.com/HosanaUFRRJ2014/planets-api/swapi"
+)
+
+
+/*How many planets are read from the database at a time*/
+const PAGE_SIZE int = 100
+
+/*Actor of periodic syncs, on the audit log. Syncs asked through the API are made by whoever asked*/
+var SCHEDULER_ACTOR = model.Actor{ID: "scheduler"}
+
+var ErrAlreadyRunning = model.NewError(model.CodeConflict, "a SWAPI sync is already running", nil)
+
+/*RunReport ... Summary of a sync of every stored planet*/
+type RunReport struct {
+	StartedAt time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Checked int `json:"checked"`
+	Updated int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Failed int `json:"failed"`
+	Errors []string `json:"errors"`
+}
+
+/*Scheduler ... Periodically re-resolves every stored planet against SWAPI, refreshing SWAPI fields*/
+type Scheduler struct {
+	// Should not be cached, or syncs would just read the cache back
+	swapiClient swapi.SWAPIClient
+	interval time.Duration
+
+	mutex sync.Mutex
+	running bool
+	lastRun *RunReport
+
+	// Done when the background loop started by Start returns
+	background sync.WaitGroup
+}
+
+/*NewScheduler creates a scheduler running every interval, once started. Zero interval only syncs on demand*/
+func NewScheduler(swapiClient swapi.SWAPIClient, interval time.Duration) *Scheduler {
+	return &Scheduler{swapiClient: swapiClient, interval: interval}
+}
+
+/*Start syncs every interval in background, until ctx is done*/
+func (scheduler *Scheduler) Start(ctx context.Context) {
+	if scheduler.interval <= 0 {
+		logging.Info(ctx, "Periodic SWAPI sync is disabled", nil)
+		return
+	}
+
+	ctx = model.WithActor(ctx, SCHEDULER_ACTOR)
+	scheduler.background.Add(1)
+	go func() {
+		defer scheduler.background.Done()
+		ticker := time.NewTicker(scheduler.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := scheduler.RunOnce(ctx); err != nil {
+					logging.Warn(ctx, "Skipping SWAPI sync", logging.Fields{"error": err})
+				}
+			}
+		}
+	}()
+}
+
+/*Wait blocks until the background loop stops, after the ctx given to Start is done. Returns at once if never started*/
+func (scheduler *Scheduler) Wait() {
+	scheduler.background.Wait()
+}
+
+/*LastRun returns the report of the last finished run, if any*/
+func (scheduler *Scheduler) LastRun() (RunReport, bool) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if scheduler.lastRun == nil {
+		return RunReport{}, false
+	}
+
+	return *scheduler.lastRun, true
+}
+
+/*RunOnce syncs every stored planet. Refuses to run while another run is going on*/
+func (scheduler *Scheduler) RunOnce(ctx context.Context) (RunReport, error) {
+	scheduler.mutex.Lock()
+	if scheduler.running {
+		scheduler.mutex.Unlock()
+		return RunReport{}, ErrAlreadyRunning
+	}
+	scheduler.running = true
+	scheduler.mutex.Unlock()
+
+	report := RunReport{StartedAt: time.Now().UTC(), Errors: []string{}}
+	var err error
+
+	listOptions := model.ListOptions{Limit: PAGE_SIZE}
+	for {
+		var page model.PlanetPage
+		page, err = planet.GetAllPlanets(ctx, listOptions)
+		if err != nil {
+			report.Errors = append(report.Errors, "Could not list planets: " + err.Error())
+			break
+		}
+
+		for _, storedPlanet := range page.Planets {
+			syncedPlanet, syncErr := scheduler.sync(ctx, storedPlanet)
+			report.Checked++
+
+			switch syncedPlanet.SyncStatus {
+			case model.SyncUpdated:
+				report.Updated++
+			case model.SyncUnchanged:
+				report.Unchanged++
+			default:
+				report.Failed++
+				report.Errors = append(report.Errors, storedPlanet.Name + ": " + syncErr.Error())
+			}
+		}
+
+		if page.NextCursor == "" || ctx.Err() != nil {
+			break
+		}
+		listOptions.Cursor = page.NextCursor
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	logging.Info(ctx, "Synced planets with SWAPI", logging.Fields{
+		"checked": report.Checked,
+		"updated": report.Updated,
+		"unchanged": report.Unchanged,
+		"failed": report.Failed,
+	})
+
+	scheduler.mutex.Lock()
+	scheduler.running = false
+	scheduler.lastRun = &report
+	scheduler.mutex.Unlock()
+
+	return report, err
+}
+
+/*SyncPlanet re-resolves a single planet right away*/
+func (scheduler *Scheduler) SyncPlanet(ctx context.Context, id string) (model.Planet, error) {
+	storedPlanet, err := planet.SearchByParam(ctx, "id", id)
+	if err != nil {
+		return storedPlanet, err
+	}
+
+	return scheduler.sync(ctx, storedPlanet)
+}
+
+/*sync re-resolves storedPlanet and saves the outcome. Failed syncs keep previous SWAPI fields*/
+func (scheduler *Scheduler) sync(ctx context.Context, storedPlanet model.Planet) (model.Planet, error) {
+	syncedPlanet := storedPlanet
+	resolveErr := planet.ResolveSWAPIFields(ctx, scheduler.swapiClient, &syncedPlanet)
+
+	syncedAt := time.Now().UTC()
+	switch {
+	case resolveErr != nil:
+		syncedPlanet = storedPlanet
+		syncedPlanet.SyncStatus = model.SyncFailed
+	case syncedPlanet.SameContent(storedPlanet):
+		syncedPlanet.SyncStatus = model.SyncUnchanged
+	default:
+		syncedPlanet.SyncStatus = model.SyncUpdated
+	}
+	syncedPlanet.LastSyncedAt = &syncedAt
+
+	if err := planet.SaveSyncedPlanet(ctx, syncedPlanet); err != nil {
+		syncedPlanet.SyncStatus = model.SyncFailed
+		return syncedPlanet, err
+	}
+
+	return syncedPlanet, resolveErr
+}
@@ -0,0 +1,204 @@
+package swapi
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+)
+
+
+/*CacheStore ... Persistent tier of the SWAPI cache, shared by every API instance*/
+type CacheStore interface {
+	Load(ctx context.Context, key string) (data []byte, expiresAt time.Time, found bool, err error)
+	Save(ctx context.Context, key string, data []byte, expiresAt time.Time) error
+	Remove(ctx context.Context, key string) error
+	RemoveAll(ctx context.Context) error
+}
+
+/*Cached search results*/
+type cacheEntry struct {
+	key string
+	response SWAPIResponse
+	expiresAt time.Time
+}
+
+/*CachedClient ... SWAPIClient that caches planet searches in an in-memory LRU and, optionally, in a CacheStore.
+Searches without results are cached for a shorter time. Catalogue pages are never cached*/
+type CachedClient struct {
+	client SWAPIClient
+	store CacheStore
+	capacity int
+	ttl time.Duration
+	negativeTTL time.Duration
+	now func() time.Time
+
+	mutex sync.Mutex
+	// Most recently used entries first
+	order *list.List
+	entries map[string]*list.Element
+}
+
+/*NewCachedClient wraps client. store may be nil to keep the cache in memory only*/
+func NewCachedClient(client SWAPIClient, capacity int, ttl, negativeTTL time.Duration, store CacheStore) *CachedClient {
+	return &CachedClient{
+		client: client,
+		store: store,
+		capacity: capacity,
+		ttl: ttl,
+		negativeTTL: negativeTTL,
+		now: time.Now,
+		order: list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+/*Names differing only by case or surrounding spaces share entries*/
+func cacheKey(planetName string) string {
+	return strings.ToLower(strings.TrimSpace(planetName))
+}
+
+func (cachedClient *CachedClient) SearchPlanets(ctx context.Context, planetName string) (SWAPIResponse, error) {
+	key := cacheKey(planetName)
+
+	if response, found := cachedClient.getFromMemory(key); found {
+		observeCacheLookup(ctx, planetName, "memory_hit")
+		return response, nil
+	}
+	if response, found := cachedClient.getFromStore(ctx, key); found {
+		observeCacheLookup(ctx, planetName, "store_hit")
+		return response, nil
+	}
+	observeCacheLookup(ctx, planetName, "miss")
+
+	response, err := cachedClient.client.SearchPlanets(ctx, planetName)
+	if err != nil {
+		return response, err
+	}
+
+	ttl := cachedClient.ttl
+	if len(response.Planets) == 0 {
+		ttl = cachedClient.negativeTTL
+	}
+	expiresAt := cachedClient.now().Add(ttl)
+	cachedClient.putInMemory(key, response, expiresAt)
+	cachedClient.putInStore(ctx, key, response, expiresAt)
+
+	return response, nil
+}
+
+func (cachedClient *CachedClient) GetPlanetsPage(ctx context.Context, pageURL string) (SWAPIResponse, error) {
+	return cachedClient.client.GetPlanetsPage(ctx, pageURL)
+}
+
+/*Purge forgets the searches of planetName. An empty planetName purges every search*/
+func (cachedClient *CachedClient) Purge(ctx context.Context, planetName string) error {
+	key := cacheKey(planetName)
+
+	cachedClient.mutex.Lock()
+	if key == "" {
+		cachedClient.order.Init()
+		cachedClient.entries = map[string]*list.Element{}
+	} else if element, found := cachedClient.entries[key]; found {
+		cachedClient.order.Remove(element)
+		delete(cachedClient.entries, key)
+	}
+	cachedClient.mutex.Unlock()
+
+	if cachedClient.store == nil {
+		return nil
+	}
+	if key == "" {
+		return cachedClient.store.RemoveAll(ctx)
+	}
+	return cachedClient.store.Remove(ctx, key)
+}
+
+
+/* Memory tier */
+
+func (cachedClient *CachedClient) getFromMemory(key string) (SWAPIResponse, bool) {
+	cachedClient.mutex.Lock()
+	defer cachedClient.mutex.Unlock()
+
+	element, found := cachedClient.entries[key]
+	if !found {
+		return SWAPIResponse{}, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if cachedClient.now().After(entry.expiresAt) {
+		cachedClient.order.Remove(element)
+		delete(cachedClient.entries, key)
+		return SWAPIResponse{}, false
+	}
+
+	cachedClient.order.MoveToFront(element)
+	return entry.response, true
+}
+
+func (cachedClient *CachedClient) putInMemory(key string, response SWAPIResponse, expiresAt time.Time) {
+	if cachedClient.capacity <= 0 {
+		return
+	}
+
+	cachedClient.mutex.Lock()
+	defer cachedClient.mutex.Unlock()
+
+	if element, found := cachedClient.entries[key]; found {
+		element.Value = &cacheEntry{key: key, response: response, expiresAt: expiresAt}
+		cachedClient.order.MoveToFront(element)
+		return
+	}
+
+	cachedClient.entries[key] = cachedClient.order.PushFront(
+		&cacheEntry{key: key, response: response, expiresAt: expiresAt},
+	)
+
+	// Evicts the least recently used entry
+	if cachedClient.order.Len() > cachedClient.capacity {
+		oldest := cachedClient.order.Back()
+		cachedClient.order.Remove(oldest)
+		delete(cachedClient.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+
+/* Persistent tier. Its failures are logged and treated as misses */
+
+func (cachedClient *CachedClient) getFromStore(ctx context.Context, key string) (SWAPIResponse, bool) {
+	var response SWAPIResponse
+	if cachedClient.store == nil {
+		return response, false
+	}
+
+	data, expiresAt, found, err := cachedClient.store.Load(ctx, key)
+	if err != nil {
+		logging.Warn(ctx, "Could not load SWAPI cache entry", logging.Fields{"key": key, "error": err})
+		return response, false
+	}
+	if !found || cachedClient.now().After(expiresAt) {
+		return response, false
+	}
+	if err = json.Unmarshal(data, &response); err != nil {
+		return response, false
+	}
+
+	cachedClient.putInMemory(key, response, expiresAt)
+	return response, true
+}
+
+func (cachedClient *CachedClient) putInStore(ctx context.Context, key string, response SWAPIResponse, expiresAt time.Time) {
+	if cachedClient.store == nil {
+		return
+	}
+
+	data, _ := json.Marshal(response)
+	if err := cachedClient.store.Save(ctx, key, data, expiresAt); err != nil {
+		logging.Warn(ctx, "Could not save SWAPI cache entry", logging.Fields{"key": key, "error": err})
+	}
+}
@@ -0,0 +1,192 @@
+package swapi
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+
+/*countingSWAPI ... SWAPIClient searching planets in memory, counting searches by name*/
+type countingSWAPI struct {
+	mutex sync.Mutex
+	planets []SWAPIPlanet
+	searches map[string]int
+}
+
+func newCountingSWAPI(planets ...SWAPIPlanet) *countingSWAPI {
+	return &countingSWAPI{planets: planets, searches: map[string]int{}}
+}
+
+func (client *countingSWAPI) SearchPlanets(ctx context.Context, planetName string) (SWAPIResponse, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.searches[planetName]++
+
+	response := SWAPIResponse{Planets: []SWAPIPlanet{}}
+	for _, swapiPlanet := range client.planets {
+		if strings.Contains(strings.ToLower(swapiPlanet.Name), strings.ToLower(planetName)) {
+			response.Planets = append(response.Planets, swapiPlanet)
+		}
+	}
+	response.Count = len(response.Planets)
+	return response, nil
+}
+
+func (client *countingSWAPI) GetPlanetsPage(ctx context.Context, pageURL string) (SWAPIResponse, error) {
+	return SWAPIResponse{}, nil
+}
+
+func (client *countingSWAPI) searchCount() int {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	count := 0
+	for _, searches := range client.searches {
+		count += searches
+	}
+	return count
+}
+
+/*memoryCacheStore ... CacheStore keeping entries in a map*/
+type memoryCacheStore struct {
+	entries map[string][]byte
+	expirations map[string]time.Time
+}
+
+func newMemoryCacheStore() *memoryCacheStore {
+	return &memoryCacheStore{entries: map[string][]byte{}, expirations: map[string]time.Time{}}
+}
+
+func (store *memoryCacheStore) Load(ctx context.Context, key string) ([]byte, time.Time, bool, error) {
+	data, found := store.entries[key]
+	return data, store.expirations[key], found, nil
+}
+
+func (store *memoryCacheStore) Save(ctx context.Context, key string, data []byte, expiresAt time.Time) error {
+	store.entries[key] = data
+	store.expirations[key] = expiresAt
+	return nil
+}
+
+func (store *memoryCacheStore) Remove(ctx context.Context, key string) error {
+	delete(store.entries, key)
+	return nil
+}
+
+func (store *memoryCacheStore) RemoveAll(ctx context.Context) error {
+	store.entries = map[string][]byte{}
+	return nil
+}
+
+var TEST_CACHED_PLANETS = []SWAPIPlanet{{Name: "Tatooine"}, {Name: "Hoth"}, {Name: "Naboo"}, {Name: "Dagobah"}}
+
+/*cacheStep ... Something done to a cached client, and how many searches reached SWAPI so far afterwards*/
+type cacheStep struct {
+	// Searched name. Purge purges purged, instead
+	search string
+	purge bool
+	purged string
+	// Moves the clock forward before the step
+	elapsed time.Duration
+	wantSearches int
+}
+
+func runCacheSteps(t *testing.T, cachedClient *CachedClient, client *countingSWAPI, steps []cacheStep) {
+	t.Helper()
+	now := time.Date(2020, 5, 4, 12, 0, 0, 0, time.UTC)
+	cachedClient.now = func() time.Time { return now }
+
+	for index, step := range steps {
+		now = now.Add(step.elapsed)
+		if step.purge {
+			if err := cachedClient.Purge(context.Background(), step.purged); err != nil {
+				t.Fatalf("step %d: Purge() error = %v", index + 1, err)
+			}
+		} else if _, err := cachedClient.SearchPlanets(context.Background(), step.search); err != nil {
+			t.Fatalf("step %d: SearchPlanets() error = %v", index + 1, err)
+		}
+
+		if searches := client.searchCount(); searches != step.wantSearches {
+			t.Fatalf("step %d: SWAPI searched %d times, want %d. Searches: %v", index + 1, searches, step.wantSearches, client.searches)
+		}
+	}
+}
+
+func TestCachedClient(t *testing.T) {
+	// Capacity is 2, TTL 1h and negative TTL 1m
+	tests := []struct {
+		name string
+		steps []cacheStep
+	}{
+		{"hit", []cacheStep{
+			{search: "Tatooine", wantSearches: 1},
+			{search: " tatooine ", elapsed: 59 * time.Minute, wantSearches: 1},
+		}},
+		{"expired", []cacheStep{
+			{search: "Tatooine", wantSearches: 1},
+			{search: "Tatooine", elapsed: time.Hour + time.Second, wantSearches: 2},
+		}},
+		{"negative cache expires sooner", []cacheStep{
+			{search: "Kamino", wantSearches: 1},
+			{search: "Kamino", elapsed: 30 * time.Second, wantSearches: 1},
+			{search: "Kamino", elapsed: 31 * time.Second, wantSearches: 2},
+		}},
+		{"least recently used is evicted", []cacheStep{
+			{search: "Tatooine", wantSearches: 1},
+			{search: "Hoth", wantSearches: 2},
+			{search: "Tatooine", wantSearches: 2},
+			{search: "Naboo", wantSearches: 3},
+			{search: "Tatooine", wantSearches: 3},
+			{search: "Hoth", wantSearches: 4},
+		}},
+		{"purge of a name", []cacheStep{
+			{search: "Tatooine", wantSearches: 1},
+			{search: "Hoth", wantSearches: 2},
+			{purge: true, purged: "TATOOINE", wantSearches: 2},
+			{search: "Tatooine", wantSearches: 3},
+			{search: "Hoth", wantSearches: 3},
+		}},
+		{"purge of every name", []cacheStep{
+			{search: "Tatooine", wantSearches: 1},
+			{search: "Hoth", wantSearches: 2},
+			{purge: true, wantSearches: 2},
+			{search: "Tatooine", wantSearches: 3},
+			{search: "Hoth", wantSearches: 4},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newCountingSWAPI(TEST_CACHED_PLANETS...)
+			runCacheSteps(t, NewCachedClient(client, 2, time.Hour, time.Minute, nil), client, test.steps)
+		})
+	}
+}
+
+func TestCachedClientStore(t *testing.T) {
+	client := newCountingSWAPI(TEST_CACHED_PLANETS...)
+	store := newMemoryCacheStore()
+
+	// Searches cached by another instance are read from the store, until purged from it
+	runCacheSteps(t, NewCachedClient(client, 2, time.Hour, time.Minute, store), client, []cacheStep{
+		{search: "Tatooine", wantSearches: 1},
+	})
+	otherClient := NewCachedClient(client, 2, time.Hour, time.Minute, store)
+	runCacheSteps(t, otherClient, client, []cacheStep{
+		{search: "Tatooine", wantSearches: 1},
+		{purge: true, purged: "Tatooine", wantSearches: 1},
+		{search: "Tatooine", wantSearches: 2},
+	})
+
+	response, err := otherClient.SearchPlanets(context.Background(), "Tatooine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []SWAPIPlanet{{Name: "Tatooine"}}; !reflect.DeepEqual(response.Planets, want) {
+		t.Errorf("SearchPlanets() = %+v, want %+v", response.Planets, want)
+	}
+}
@@ -0,0 +1,50 @@
+package swapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+
+/* Kinds of SWAPI errors. Check them with errors.Is */
+
+/*ErrUnavailable ... SWAPI could not be reached or kept failing with 5xx or 429*/
+var ErrUnavailable = errors.New("SWAPI is unavailable")
+
+/*ErrTimeout ... SWAPI did not answer in time*/
+var ErrTimeout = errors.New("SWAPI timed out")
+
+/*ErrInvalidResponse ... SWAPI refused the request or answered something we can't read*/
+var ErrInvalidResponse = errors.New("SWAPI answered an invalid response")
+
+
+/*RequestError ... Failed request to SWAPI*/
+type RequestError struct {
+	// One of ErrUnavailable, ErrTimeout or ErrInvalidResponse
+	Kind error
+	URL string
+	// 0 when no response was received
+	StatusCode int
+	// Underlying error, if any
+	Err error
+}
+
+func (requestError *RequestError) Error() string {
+	message := requestError.Kind.Error() + ": GET " + requestError.URL
+	if requestError.StatusCode != 0 {
+		message += fmt.Sprintf(" answered %d", requestError.StatusCode)
+	}
+	if requestError.Err != nil {
+		message += ": " + requestError.Err.Error()
+	}
+
+	return message
+}
+
+func (requestError *RequestError) Is(target error) bool {
+	return target == requestError.Kind
+}
+
+func (requestError *RequestError) Unwrap() error {
+	return requestError.Err
+}
@@ -0,0 +1,163 @@
+package swapi
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+
+/*Longest wait between two retries, even if SWAPI asks for more with Retry-After*/
+const MAX_BACKOFF time.Duration = 30 * time.Second
+
+/*Guards searches against SWAPI pages pointing back to each other*/
+const MAX_SEARCH_PAGES int = 100
+
+/*HTTPClient ... SWAPIClient that talks to SWAPI over HTTP, retrying 5xx and 429 answers with exponential backoff*/
+type HTTPClient struct {
+	// Planets endpoint, like PLANETS_SWAPI_URL
+	BaseURL string
+	// Retries after the first attempt
+	MaxRetries int
+	// Wait before the first retry. Doubles on every retry
+	InitialBackoff time.Duration
+	client *http.Client
+}
+
+/*NewHTTPClient creates a client with timeout applied to every attempt*/
+func NewHTTPClient(baseURL string, timeout time.Duration, maxRetries int) *HTTPClient {
+	return &HTTPClient{
+		BaseURL: baseURL,
+		MaxRetries: maxRetries,
+		InitialBackoff: 500 * time.Millisecond,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+/*SearchPlanets follows every result page, returning all results at once*/
+func (swapiClient *HTTPClient) SearchPlanets(ctx context.Context, planetName string) (SWAPIResponse, error) {
+	startedAt := time.Now()
+	searchResponse, err := swapiClient.search(ctx, planetName)
+	observeLookup(ctx, "search", planetName, startedAt, err)
+	return searchResponse, err
+}
+
+func (swapiClient *HTTPClient) search(ctx context.Context, planetName string) (SWAPIResponse, error) {
+	pageURL := swapiClient.BaseURL + "?search=" + url.QueryEscape(planetName)
+	visited := map[string]bool{}
+
+	var searchResponse SWAPIResponse
+	for pageURL != "" && !visited[pageURL] && len(visited) < MAX_SEARCH_PAGES {
+		visited[pageURL] = true
+
+		response, err := swapiClient.get(ctx, pageURL)
+		if err != nil {
+			return searchResponse, err
+		}
+
+		searchResponse.Count = response.Count
+		searchResponse.Planets = append(searchResponse.Planets, response.Planets...)
+		pageURL = response.Next
+	}
+
+	return searchResponse, nil
+}
+
+func (swapiClient *HTTPClient) GetPlanetsPage(ctx context.Context, pageURL string) (SWAPIResponse, error) {
+	if pageURL == "" {
+		pageURL = swapiClient.BaseURL
+	}
+
+	startedAt := time.Now()
+	response, err := swapiClient.get(ctx, pageURL)
+	observeLookup(ctx, "page", pageURL, startedAt, err)
+	return response, err
+}
+
+/*Ping makes a single request to the planets endpoint, without retries*/
+func (swapiClient *HTTPClient) Ping(ctx context.Context) error {
+	_, _, err := swapiClient.fetch(ctx, swapiClient.BaseURL)
+	return err
+}
+
+/*get fetches and decodes pageURL, retrying while SWAPI is unavailable*/
+func (swapiClient *HTTPClient) get(ctx context.Context, pageURL string) (SWAPIResponse, error) {
+	var responseObject SWAPIResponse
+	backoff := swapiClient.InitialBackoff
+
+	for attempt := 0; ; attempt++ {
+		responseData, retryAfter, err := swapiClient.fetch(ctx, pageURL)
+		if err == nil {
+			if err = json.Unmarshal(responseData, &responseObject); err != nil {
+				return responseObject, &RequestError{Kind: ErrInvalidResponse, URL: pageURL, StatusCode: http.StatusOK, Err: err}
+			}
+			return responseObject, nil
+		}
+
+		requestError := err.(*RequestError)
+		if requestError.Kind == ErrInvalidResponse || attempt >= swapiClient.MaxRetries {
+			return responseObject, err
+		}
+
+		wait := backoff
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > MAX_BACKOFF {
+			wait = MAX_BACKOFF
+		}
+		backoff *= 2
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return responseObject, &RequestError{Kind: ErrTimeout, URL: pageURL, Err: ctx.Err()}
+		case <-timer.C:
+		}
+	}
+}
+
+/*fetch makes a single attempt. Besides the body, returns how long SWAPI asked us to wait*/
+func (swapiClient *HTTPClient) fetch(ctx context.Context, pageURL string) ([]byte, time.Duration, error) {
+	request, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, 0, &RequestError{Kind: ErrInvalidResponse, URL: pageURL, Err: err}
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Accept", "application/json")
+
+	response, err := swapiClient.client.Do(request)
+	if err != nil {
+		observeAttempt(ctx, pageURL, 0)
+		kind := ErrUnavailable
+		if urlError, ok := err.(*url.Error); (ok && urlError.Timeout()) || ctx.Err() != nil {
+			kind = ErrTimeout
+		}
+		return nil, 0, &RequestError{Kind: kind, URL: pageURL, Err: err}
+	}
+	defer response.Body.Close()
+	observeAttempt(ctx, pageURL, response.StatusCode)
+
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		retryAfter := time.Duration(0)
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, retryAfter, &RequestError{Kind: ErrUnavailable, URL: pageURL, StatusCode: response.StatusCode}
+	case response.StatusCode != http.StatusOK:
+		return nil, 0, &RequestError{Kind: ErrInvalidResponse, URL: pageURL, StatusCode: response.StatusCode}
+	}
+
+	responseData, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, &RequestError{Kind: ErrUnavailable, URL: pageURL, Err: err}
+	}
+
+	return responseData, 0, nil
+}
@@ -0,0 +1,141 @@
+package swapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+
+/*scriptedAnswer ... How the scripted SWAPI answers one request*/
+type scriptedAnswer struct {
+	status int
+	retryAfter string
+	body string
+	// Before answering
+	delay time.Duration
+}
+
+/*scriptedSWAPI answers requests with its answers in order, repeating the last one, and records when each request came*/
+type scriptedSWAPI struct {
+	*httptest.Server
+	mutex sync.Mutex
+	answers []scriptedAnswer
+	requests []time.Time
+}
+
+func newScriptedSWAPI(answers ...scriptedAnswer) *scriptedSWAPI {
+	server := &scriptedSWAPI{answers: answers}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		server.mutex.Lock()
+		answer := server.answers[len(server.answers) - 1]
+		if len(server.requests) < len(server.answers) {
+			answer = server.answers[len(server.requests)]
+		}
+		server.requests = append(server.requests, time.Now())
+		server.mutex.Unlock()
+
+		time.Sleep(answer.delay)
+		if answer.retryAfter != "" {
+			writer.Header().Set("Retry-After", answer.retryAfter)
+		}
+		writer.WriteHeader(answer.status)
+		writer.Write([]byte(answer.body))
+	}))
+
+	return server
+}
+
+/*waits between requests received*/
+func (server *scriptedSWAPI) waits() []time.Duration {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	waits := []time.Duration{}
+	for index := 1; index < len(server.requests); index++ {
+		waits = append(waits, server.requests[index].Sub(server.requests[index - 1]))
+	}
+	return waits
+}
+
+const TATOOINE_PAGE string = `{"count": 1, "next": null, "results": [{"name": "Tatooine", "films": ["1", "3"]}]}`
+
+func TestHTTPClientRetries(t *testing.T) {
+	ok := scriptedAnswer{status: http.StatusOK, body: TATOOINE_PAGE}
+	unavailable := scriptedAnswer{status: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name string
+		answers []scriptedAnswer
+		maxRetries int
+		timeout time.Duration
+		wantErr error
+		// Shortest wait before each retry
+		wantWaits []time.Duration
+	}{
+		{"answered right away", []scriptedAnswer{ok}, 3, time.Second, nil, []time.Duration{}},
+		{"5xx then 200", []scriptedAnswer{unavailable, unavailable, ok}, 3, time.Second, nil, []time.Duration{20 * time.Millisecond, 40 * time.Millisecond}},
+		{
+			"429 asking for more than the backoff",
+			[]scriptedAnswer{{status: http.StatusTooManyRequests, retryAfter: "1"}, ok}, 3, time.Second,
+			nil, []time.Duration{time.Second},
+		},
+		{"5xx past the retries", []scriptedAnswer{unavailable}, 2, time.Second, ErrUnavailable, []time.Duration{20 * time.Millisecond, 40 * time.Millisecond}},
+		{"4xx is not retried", []scriptedAnswer{{status: http.StatusNotFound}, ok}, 3, time.Second, ErrInvalidResponse, []time.Duration{}},
+		{"invalid body is not retried", []scriptedAnswer{{status: http.StatusOK, body: "<html>"}, ok}, 3, time.Second, ErrInvalidResponse, []time.Duration{}},
+		{"slow answer", []scriptedAnswer{{status: http.StatusOK, body: TATOOINE_PAGE, delay: 200 * time.Millisecond}}, 0, 50 * time.Millisecond, ErrTimeout, []time.Duration{}},
+		{
+			"slow answer then 200",
+			[]scriptedAnswer{{status: http.StatusOK, body: TATOOINE_PAGE, delay: 200 * time.Millisecond}, ok}, 1, 50 * time.Millisecond,
+			nil, []time.Duration{20 * time.Millisecond},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newScriptedSWAPI(test.answers...)
+			defer server.Close()
+			client := NewHTTPClient(server.URL + "/", test.timeout, test.maxRetries)
+			client.InitialBackoff = 20 * time.Millisecond
+
+			response, err := client.GetPlanetsPage(context.Background(), "")
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("GetPlanetsPage() error = %v, want %v", err, test.wantErr)
+			}
+			if err == nil && (len(response.Planets) != 1 || response.Planets[0].Name != "Tatooine") {
+				t.Errorf("GetPlanetsPage() = %+v, want Tatooine", response)
+			}
+
+			waits := server.waits()
+			if len(waits) != len(test.wantWaits) {
+				t.Fatalf("retried %d times, want %d", len(waits), len(test.wantWaits))
+			}
+			for index, wait := range waits {
+				if wait < test.wantWaits[index] {
+					t.Errorf("retry %d waited %s, want at least %s", index + 1, wait, test.wantWaits[index])
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPClientStopsRetryingWithContext(t *testing.T) {
+	server := newScriptedSWAPI(scriptedAnswer{status: http.StatusServiceUnavailable, retryAfter: "10"})
+	defer server.Close()
+	client := NewHTTPClient(server.URL + "/", time.Second, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+	defer cancel()
+	startedAt := time.Now()
+	_, err := client.GetPlanetsPage(ctx, "")
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("GetPlanetsPage() error = %v, want %v", err, ErrTimeout)
+	}
+	if elapsed := time.Since(startedAt); elapsed > time.Second {
+		t.Errorf("gave up after %s, want the context deadline", elapsed)
+	}
+}
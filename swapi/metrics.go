@@ -0,0 +1,84 @@
+package swapi
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/logging"
+	"github.com/HosanaUFRRJ2014/planets-api/metrics"
+)
+
+
+var lookupsTotal = metrics.NewCounterVec(
+	"swapi_lookups_total",
+	"SWAPI lookups, retries included, by operation (search or page) and outcome.",
+	"operation", "outcome",
+)
+
+var lookupDuration = metrics.NewHistogramVec(
+	"swapi_lookup_duration_seconds",
+	"Latency of SWAPI lookups, retries included, by operation (search or page).",
+	nil,
+	"operation",
+)
+
+var attemptsTotal = metrics.NewCounterVec(
+	"swapi_http_attempts_total",
+	"Single HTTP requests to SWAPI, by status code. Requests without answer have status 0.",
+	"status",
+)
+
+var cacheLookupsTotal = metrics.NewCounterVec(
+	"swapi_cache_lookups_total",
+	"SWAPI searches looked up on the cache, by result: memory_hit, store_hit or miss.",
+	"result",
+)
+
+/*outcomeOf labels err by its kind*/
+func outcomeOf(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrUnavailable):
+		return "unavailable"
+	case errors.Is(err, ErrTimeout):
+		return "timeout"
+	case errors.Is(err, ErrInvalidResponse):
+		return "invalid_response"
+	}
+
+	return "error"
+}
+
+/*observeLookup records a lookup of target started at startedAt that ended with err, logging it with the request ID of ctx*/
+func observeLookup(ctx context.Context, operation, target string, startedAt time.Time, err error) {
+	latency := time.Since(startedAt)
+	outcome := outcomeOf(err)
+	lookupsTotal.Inc(operation, outcome)
+	lookupDuration.Observe(latency.Seconds(), operation)
+
+	fields := logging.Fields{
+		"operation": operation,
+		"target": target,
+		"outcome": outcome,
+		"latencyMs": float64(latency.Microseconds()) / 1000,
+	}
+	if err != nil {
+		fields["error"] = err
+		logging.Warn(ctx, "SWAPI lookup failed", fields)
+		return
+	}
+	logging.Debug(ctx, "SWAPI lookup", fields)
+}
+
+func observeAttempt(ctx context.Context, pageURL string, statusCode int) {
+	attemptsTotal.Inc(strconv.Itoa(statusCode))
+	logging.Debug(ctx, "SWAPI request", logging.Fields{"url": pageURL, "status": statusCode})
+}
+
+func observeCacheLookup(ctx context.Context, planetName, result string) {
+	cacheLookupsTotal.Inc(result)
+	logging.Debug(ctx, "SWAPI cache lookup", logging.Fields{"name": planetName, "result": result})
+}
@@ -0,0 +1,105 @@
+package swapi
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+
+/*ResolutionStatus ... Outcome of matching one of our planets to a SWAPI planet*/
+type ResolutionStatus string
+
+const (
+	Resolved ResolutionStatus = "resolved"
+	// SWAPI knows planets with similar names, but none or many of them match
+	Unresolved ResolutionStatus = "unresolved"
+	NotFound ResolutionStatus = "not_found"
+)
+
+/*MatchConfidence ... How the resolved SWAPI planet name matched ours*/
+type MatchConfidence string
+
+const (
+	// Same name, ignoring case
+	MatchExact MatchConfidence = "exact"
+	// Same name, ignoring case and accents
+	MatchNormalized MatchConfidence = "normalized"
+	MatchNone MatchConfidence = "none"
+)
+
+/*Resolution ... SWAPI planet matching one of our planets*/
+type Resolution struct {
+	Status ResolutionStatus
+	Confidence MatchConfidence
+	// Empty unless Status is Resolved
+	Planet SWAPIPlanet
+	// SWAPI planets whose names contain ours
+	Candidates int
+}
+
+/*Lower cases and collapses spaces*/
+func lowerName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+/*Lower cases, removes accents and collapses spaces*/
+func normalizeName(name string) string {
+	var builder strings.Builder
+
+	for _, character := range norm.NFD.String(name) {
+		if !unicode.Is(unicode.Mn, character) {
+			builder.WriteRune(unicode.ToLower(character))
+		}
+	}
+
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+/*ResolvePlanet searches planetName on SWAPI and picks the single planet with the same name.
+Exact names are preferred over names differing only by accents. Ties are left unresolved instead of guessed*/
+func ResolvePlanet(ctx context.Context, client SWAPIClient, planetName string) (Resolution, error) {
+	var resolution Resolution
+
+	response, err := client.SearchPlanets(ctx, planetName)
+	if err != nil {
+		return resolution, err
+	}
+
+	resolution.Candidates = len(response.Planets)
+	if resolution.Candidates == 0 {
+		resolution.Status = NotFound
+		resolution.Confidence = MatchNone
+		return resolution, nil
+	}
+
+	var exactMatches, normalizedMatches []SWAPIPlanet
+	loweredName := lowerName(planetName)
+	normalizedName := normalizeName(planetName)
+
+	for _, swapiPlanet := range response.Planets {
+		if lowerName(swapiPlanet.Name) == loweredName {
+			exactMatches = append(exactMatches, swapiPlanet)
+		} else if normalizeName(swapiPlanet.Name) == normalizedName {
+			normalizedMatches = append(normalizedMatches, swapiPlanet)
+		}
+	}
+
+	switch {
+	case len(exactMatches) == 1:
+		resolution.Status = Resolved
+		resolution.Confidence = MatchExact
+		resolution.Planet = exactMatches[0]
+	case len(exactMatches) == 0 && len(normalizedMatches) == 1:
+		resolution.Status = Resolved
+		resolution.Confidence = MatchNormalized
+		resolution.Planet = normalizedMatches[0]
+	default:
+		resolution.Status = Unresolved
+		resolution.Confidence = MatchNone
+	}
+
+	return resolution, nil
+}
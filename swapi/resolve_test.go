@@ -0,0 +1,101 @@
+package swapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+
+/*How many planets the paginated SWAPI answers per page*/
+const TEST_PAGE_SIZE int = 2
+
+/*newPaginatedSWAPI answers searches of catalogue TEST_PAGE_SIZE planets at a time, linking pages by next like SWAPI does.
+Names are searched ignoring case and accents*/
+func newPaginatedSWAPI(catalogue []SWAPIPlanet) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		search := request.URL.Query().Get("search")
+		page, err := strconv.Atoi(request.URL.Query().Get("page"))
+		if err != nil {
+			page = 1
+		}
+
+		var found []SWAPIPlanet
+		for _, swapiPlanet := range catalogue {
+			if strings.Contains(normalizeName(swapiPlanet.Name), normalizeName(search)) {
+				found = append(found, swapiPlanet)
+			}
+		}
+
+		response := SWAPIResponse{Count: len(found), Planets: []SWAPIPlanet{}}
+		start, end := (page - 1) * TEST_PAGE_SIZE, page * TEST_PAGE_SIZE
+		if end >= len(found) {
+			end = len(found)
+		} else {
+			response.Next = server.URL + "/?search=" + url.QueryEscape(search) + "&page=" + strconv.Itoa(page + 1)
+		}
+		if start < end {
+			response.Planets = found[start:end]
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(response)
+	}))
+
+	return server
+}
+
+func TestResolvePlanet(t *testing.T) {
+	// Matches of Naboo, Alderaan and Ryloth are past the first page
+	server := newPaginatedSWAPI([]SWAPIPlanet{
+		{Name: "Naboo Orbit", URL: "1"}, {Name: "Naboo Moon", URL: "2"}, {Name: "Naboo", URL: "3"},
+		{Name: "Ålderaan", URL: "4"}, {Name: "Alderaan Belt", URL: "5"}, {Name: "Alderaan", URL: "6"},
+		{Name: "Ryloth Station", URL: "7"}, {Name: "Ryloth Moon", URL: "8"}, {Name: "Rylóth", URL: "9"},
+		{Name: "Kashyyyk", URL: "10"}, {Name: "KASHYYYK", URL: "11"},
+		{Name: "Cató Neimoidia", URL: "12"}, {Name: "Catô Neimoidia", URL: "13"},
+		{Name: "Mustafar Outpost", URL: "14"},
+	})
+	defer server.Close()
+	client := NewHTTPClient(server.URL + "/", time.Second, 0)
+
+	tests := []struct {
+		name string
+		planetName string
+		wantStatus ResolutionStatus
+		wantConfidence MatchConfidence
+		wantURL string
+		wantCandidates int
+	}{
+		{"exact on the second page", "Naboo", Resolved, MatchExact, "3", 3},
+		{"exact ignoring case and spaces", "  naboo ", Resolved, MatchExact, "3", 3},
+		{"exact preferred over normalized", "Alderaan", Resolved, MatchExact, "6", 3},
+		{"normalized when nothing is exact", "Ryloth", Resolved, MatchNormalized, "9", 3},
+		{"many exact", "Kashyyyk", Unresolved, MatchNone, "", 2},
+		{"many normalized", "Cato Neimoidia", Unresolved, MatchNone, "", 2},
+		{"candidates without a match", "Mustafar", Unresolved, MatchNone, "", 1},
+		{"nothing found", "Kamino", NotFound, MatchNone, "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolution, err := ResolvePlanet(context.Background(), client, test.planetName)
+			if err != nil {
+				t.Fatalf("ResolvePlanet() error = %v", err)
+			}
+
+			if resolution.Status != test.wantStatus || resolution.Confidence != test.wantConfidence ||
+				resolution.Planet.URL != test.wantURL || resolution.Candidates != test.wantCandidates {
+				t.Errorf("ResolvePlanet() = %s %s %q of %d candidates, want %s %s %q of %d",
+					resolution.Status, resolution.Confidence, resolution.Planet.URL, resolution.Candidates,
+					test.wantStatus, test.wantConfidence, test.wantURL, test.wantCandidates)
+			}
+		})
+	}
+}
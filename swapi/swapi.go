@@ -0,0 +1,32 @@
+package swapi
+
+import (
+	"context"
+)
+
+/*Structure of a response from SWAPI planets endpoint */
+type SWAPIResponse struct {
+	Count int `json:"count"`
+	Next string `json:"next"`
+	Planets [] SWAPIPlanet `json:"results"`
+}
+
+/*Structure of planet from SWAPI that matters*/
+type SWAPIPlanet struct {
+	Name    string `json:"name"`
+	Climate string `json:"climate"`
+	Terrain string `json:"terrain"`
+	URL string `json:"url"`
+	Films [] string `json:"films"`
+}
+
+const PLANETS_SWAPI_URL string = "https://swapi.dev/api/planets/"
+
+
+/*SWAPIClient ... Access to SWAPI planets. Errors are *RequestError*/
+type SWAPIClient interface {
+	// Planets whose names contain planetName, from every result page. Next is always empty
+	SearchPlanets(ctx context.Context, planetName string) (SWAPIResponse, error)
+	// Page of planets at pageURL, usually the Next of a previous page. Empty pageURL is the first page of the catalogue
+	GetPlanetsPage(ctx context.Context, pageURL string) (SWAPIResponse, error)
+}
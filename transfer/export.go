@@ -0,0 +1,156 @@
+package transfer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+)
+
+
+/*How many planets are read from the database at a time*/
+const PAGE_SIZE int = 100
+
+/*planetWriter ... Encodes planets one at a time into a format*/
+type planetWriter interface {
+	Begin() error
+	Write(exportedPlanet model.Planet) error
+	End() error
+}
+
+func newPlanetWriter(writer io.Writer, format Format) planetWriter {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(writer)}
+	case FormatNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(writer)}
+	default:
+		return &jsonArrayWriter{writer: writer}
+	}
+}
+
+/*Export streams every planet matching listOptions filters and sort to writer. Returns how many were written.
+Nothing is written when the first page can't be read, so callers may still answer errors*/
+func Export(ctx context.Context, writer io.Writer, format Format, listOptions model.ListOptions) (int, error) {
+	listOptions.Limit = PAGE_SIZE
+	listOptions.Page = 0
+	listOptions.Cursor = ""
+
+	encoder := newPlanetWriter(writer, format)
+	exported := 0
+
+	for {
+		page, err := planet.GetAllPlanets(ctx, listOptions)
+		if err != nil {
+			return exported, err
+		}
+
+		if listOptions.Cursor == "" {
+			if err = encoder.Begin(); err != nil {
+				return exported, err
+			}
+		}
+
+		for _, exportedPlanet := range page.Planets {
+			if err = encoder.Write(exportedPlanet); err != nil {
+				return exported, err
+			}
+			exported++
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			return exported, err
+		}
+		listOptions.Cursor = page.NextCursor
+	}
+
+	return exported, encoder.End()
+}
+
+
+/* Writers */
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (csvEncoder *csvWriter) Begin() error {
+	return csvEncoder.writer.Write(CSV_COLUMNS)
+}
+
+func (csvEncoder *csvWriter) Write(exportedPlanet model.Planet) error {
+	err := csvEncoder.writer.Write([]string{
+		exportedPlanet.ID.Hex(),
+		exportedPlanet.Name,
+		exportedPlanet.Climate,
+		exportedPlanet.Terrain,
+		strconv.Itoa(exportedPlanet.AppearencesCount),
+		exportedPlanet.SwapiStatus,
+		exportedPlanet.SwapiMatchConfidence,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keep memory flat on big catalogues
+	csvEncoder.writer.Flush()
+	return csvEncoder.writer.Error()
+}
+
+func (csvEncoder *csvWriter) End() error {
+	csvEncoder.writer.Flush()
+	return csvEncoder.writer.Error()
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (ndjsonEncoder *ndjsonWriter) Begin() error {
+	return nil
+}
+
+func (ndjsonEncoder *ndjsonWriter) Write(exportedPlanet model.Planet) error {
+	return ndjsonEncoder.encoder.Encode(exportedPlanet)
+}
+
+func (ndjsonEncoder *ndjsonWriter) End() error {
+	return nil
+}
+
+type jsonArrayWriter struct {
+	writer io.Writer
+	written bool
+}
+
+func (jsonEncoder *jsonArrayWriter) Begin() error {
+	_, err := io.WriteString(jsonEncoder.writer, "[")
+	return err
+}
+
+func (jsonEncoder *jsonArrayWriter) Write(exportedPlanet model.Planet) error {
+	separator := "\n"
+	if jsonEncoder.written {
+		separator = ",\n"
+	}
+	jsonEncoder.written = true
+
+	data, err := json.Marshal(exportedPlanet)
+	if err == nil {
+		_, err = io.WriteString(jsonEncoder.writer, separator + string(data))
+	}
+
+	return err
+}
+
+func (jsonEncoder *jsonArrayWriter) End() error {
+	_, err := io.WriteString(jsonEncoder.writer, "\n]\n")
+	return err
+}
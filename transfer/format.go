@@ -0,0 +1,72 @@
+package transfer
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+/*Format ... Encoding of exported and imported planets*/
+type Format string
+
+const (
+	FormatCSV Format = "csv"
+	// One planet per line
+	FormatNDJSON Format = "ndjson"
+	// A single array of planets
+	FormatJSON Format = "json"
+)
+
+/*Formats, by preference when content negotiation ties*/
+var FORMATS = []Format{FormatJSON, FormatNDJSON, FormatCSV}
+
+/*Columns of CSV files, in order. Import only requires name*/
+var CSV_COLUMNS = []string{
+	"id", "name", "climate", "terrain", "appearencesCount", "swapiStatus", "swapiMatchConfidence",
+}
+
+var ErrUnknownFormat = model.NewError(model.CodeValidation, "unknown format. Valid options: csv, ndjson, json", nil)
+
+/*ParseFormat accepts format names like csv, as well as their content types*/
+func ParseFormat(name string) (Format, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if index := strings.Index(name, ";"); index >= 0 {
+		name = strings.TrimSpace(name[:index])
+	}
+
+	for _, format := range FORMATS {
+		if name == string(format) || name == format.ContentType() {
+			return format, nil
+		}
+	}
+
+	switch name {
+	case "text/comma-separated-values", "application/csv":
+		return FormatCSV, nil
+	case "application/ndjson", "application/jsonl", "application/x-jsonlines", "jsonl":
+		return FormatNDJSON, nil
+	}
+
+	return "", ErrUnknownFormat.Describe(
+		"unknown format " + name + ". Valid options: csv, ndjson, json",
+		map[string]interface{}{"format": name},
+	)
+}
+
+/*FormatFromFileName guesses the format by the extension of fileName*/
+func FormatFromFileName(fileName string) (Format, error) {
+	return ParseFormat(strings.TrimPrefix(filepath.Ext(fileName), "."))
+}
+
+func (format Format) ContentType() string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json"
+	}
+}
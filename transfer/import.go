@@ -0,0 +1,406 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+	"github.com/HosanaUFRRJ2014/planets-api/planet"
+	"github.com/HosanaUFRRJ2014/planets-api/swapi"
+)
+
+
+/*ConflictMode ... What imports do with rows named like a stored planet*/
+type ConflictMode string
+
+const (
+	// Keep the stored planet
+	ModeSkip ConflictMode = "skip"
+	// Replace the stored planet with the row
+	ModeOverwrite ConflictMode = "overwrite"
+	// Import nothing at all
+	ModeFail ConflictMode = "fail"
+)
+
+var ErrUnknownMode = model.NewError(model.CodeValidation, "unknown mode. Valid options: skip, overwrite, fail", nil)
+
+func ParseConflictMode(name string) (ConflictMode, error) {
+	for _, mode := range []ConflictMode{ModeSkip, ModeOverwrite, ModeFail} {
+		if name == string(mode) {
+			return mode, nil
+		}
+	}
+
+	return "", ErrUnknownMode
+}
+
+/*ImportOptions ... How Import handles conflicts, and whether it writes at all*/
+type ImportOptions struct {
+	Mode ConflictMode
+	// Only reports what would be imported
+	DryRun bool
+}
+
+/*RowError ... Why a row was not imported. Rows are counted from 1, not counting CSV headers*/
+type RowError struct {
+	Row int `json:"row"`
+	Name string `json:"name,omitempty"`
+	Error *model.Error `json:"error"`
+}
+
+/*ImportReport ... Summary of an import. On dry runs, what would have happened*/
+type ImportReport struct {
+	DryRun bool `json:"dryRun"`
+	Mode ConflictMode `json:"mode"`
+	Rows int `json:"rows"`
+	Created int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped int `json:"skipped"`
+	Invalid int `json:"invalid"`
+	Failed int `json:"failed"`
+	Errors []RowError `json:"errors"`
+}
+
+var ErrImportConflict = model.NewError(model.CodeConflict, "some rows are named like stored planets. Nothing was imported", nil)
+
+/*importedRow ... Fields read from each row. Ids are not imported, since they differ between environments*/
+type importedRow struct {
+	Name string `json:"name"`
+	Climate string `json:"climate"`
+	Terrain string `json:"terrain"`
+	AppearencesCount int `json:"appearencesCount"`
+	SwapiStatus string `json:"swapiStatus"`
+	SwapiMatchConfidence string `json:"swapiMatchConfidence"`
+}
+
+func (row importedRow) toPlanet() model.Planet {
+	return model.Planet{
+		Name: row.Name,
+		Climate: row.Climate,
+		Terrain: row.Terrain,
+		AppearencesCount: row.AppearencesCount,
+		SwapiStatus: row.SwapiStatus,
+		SwapiMatchConfidence: row.SwapiMatchConfidence,
+	}
+}
+
+type rowAction int
+
+const (
+	actionInvalid rowAction = iota
+	actionCreate
+	actionOverwrite
+	actionSkip
+	// Named like a stored planet, in fail mode
+	actionConflict
+)
+
+/*plannedRow ... A row read, validated and matched against stored planets, before anything is written*/
+type plannedRow struct {
+	row int
+	planet model.Planet
+	action rowAction
+	// Stored planet of the same name, for overwrites
+	stored model.Planet
+	err *model.Error
+}
+
+/*keepSWAPIFields fills the SWAPI fields of importedPlanet with the ones of storedPlanet, unless the row
+informed a swapiStatus. SWAPI URLs are never exported, and sync fields are only set by syncs, so they are always kept*/
+func keepSWAPIFields(importedPlanet, storedPlanet model.Planet) model.Planet {
+	importedPlanet.PlanetSwapiURL = storedPlanet.PlanetSwapiURL
+	importedPlanet.LastSyncedAt = storedPlanet.LastSyncedAt
+	importedPlanet.SyncStatus = storedPlanet.SyncStatus
+	if importedPlanet.SwapiStatus != "" {
+		return importedPlanet
+	}
+
+	importedPlanet.AppearencesCount = storedPlanet.AppearencesCount
+	importedPlanet.SwapiStatus = storedPlanet.SwapiStatus
+	importedPlanet.SwapiMatchConfidence = storedPlanet.SwapiMatchConfidence
+	return importedPlanet
+}
+
+func invalidRow(reason string, err error) *model.Error {
+	return &model.Error{
+		Code: model.CodeValidation,
+		Message: reason,
+		Details: map[string]interface{}{"reason": err.Error()},
+		Err: err,
+	}
+}
+
+/*Import reads every row of reader before writing anything, so malformed files and fail mode conflicts import nothing.
+Names are validated with planet.PrepareString. SWAPI fields are imported as they are, if the row has a swapiStatus*/
+func Import(ctx context.Context, reader io.Reader, format Format, options ImportOptions) (ImportReport, error) {
+	report := ImportReport{DryRun: options.DryRun, Mode: options.Mode, Errors: []RowError{}}
+
+	rows, err := readRows(reader, format)
+	if err != nil {
+		return report, err
+	}
+	report.Rows = len(rows)
+
+	conflicts := planRows(ctx, rows, options.Mode)
+	for _, row := range rows {
+		switch {
+		case row.action == actionInvalid && row.err.Code != model.CodeValidation:
+			report.Failed++
+			report.Errors = append(report.Errors, RowError{Row: row.row, Name: row.planet.Name, Error: row.err})
+		case row.action == actionInvalid:
+			report.Invalid++
+			report.Errors = append(report.Errors, RowError{Row: row.row, Name: row.planet.Name, Error: row.err})
+		case row.action == actionSkip:
+			report.Skipped++
+		case row.action == actionConflict:
+			report.Errors = append(report.Errors, RowError{Row: row.row, Name: row.planet.Name, Error: row.err})
+		}
+	}
+
+	if options.Mode == ModeFail && conflicts > 0 {
+		return report, ErrImportConflict
+	}
+
+	for _, row := range rows {
+		switch row.action {
+		case actionCreate:
+			if !options.DryRun {
+				_, err = planet.AddNewPlanet(ctx, row.planet)
+			}
+			if err == nil {
+				report.Created++
+			}
+		case actionOverwrite:
+			if !options.DryRun {
+				_, err = planet.ReplacePlanet(ctx, row.stored.ID.Hex(), row.planet)
+			}
+			if err == nil {
+				report.Overwritten++
+			}
+		default:
+			continue
+		}
+
+		if err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, RowError{Row: row.row, Name: row.planet.Name, Error: model.AsError(err)})
+			err = nil
+		}
+	}
+
+	return report, nil
+}
+
+/*planRows decides what to do with every row. Returns how many rows conflict with stored planets*/
+func planRows(ctx context.Context, rows []plannedRow, mode ConflictMode) int {
+	conflicts := 0
+	seen := map[string]int{}
+
+	for index := range rows {
+		row := &rows[index]
+		if row.err != nil {
+			continue
+		}
+
+		name, err := planet.PrepareString(row.planet.Name)
+		if err != nil {
+			row.err = model.AsError(err)
+			continue
+		}
+		row.planet.Name = name
+
+		if firstRow, found := seen[name]; found {
+			row.err = model.NewError(
+				model.CodeValidation,
+				"Planet " + name + " is repeated in the file",
+				map[string]interface{}{"name": name, "firstRow": firstRow},
+			)
+			continue
+		}
+		seen[name] = row.row
+
+		storedPlanet, err := planet.SearchByParam(ctx, "name", name)
+		switch {
+		case errors.Is(err, model.ErrPlanetNotFound):
+			row.action = actionCreate
+			if row.planet.SwapiStatus == "" {
+				// Until the next SWAPI sync
+				row.planet.SwapiStatus = string(swapi.Unresolved)
+				row.planet.SwapiMatchConfidence = string(swapi.MatchNone)
+			}
+			continue
+		case err != nil:
+			row.err = model.AsError(err)
+			continue
+		}
+
+		conflicts++
+		row.stored = storedPlanet
+		row.planet = keepSWAPIFields(row.planet, storedPlanet)
+		row.err = model.ErrDuplicatedPlanet.Describe(
+			"Planet " + name + " already exists",
+			map[string]interface{}{"name": name, "id": storedPlanet.ID.Hex()},
+		)
+		switch mode {
+		case ModeOverwrite:
+			row.action = actionOverwrite
+		case ModeSkip:
+			row.action = actionSkip
+		default:
+			row.action = actionConflict
+		}
+	}
+
+	return conflicts
+}
+
+
+/* Readers */
+
+/*readRows reads every row of reader. Malformed rows become invalid rows, unless the file can't be read any further*/
+func readRows(reader io.Reader, format Format) ([]plannedRow, error) {
+	var rows []plannedRow
+	var err error
+
+	switch format {
+	case FormatCSV:
+		rows, err = readCSV(reader)
+	case FormatNDJSON:
+		rows, err = readNDJSON(reader)
+	default:
+		rows, err = readJSONArray(reader)
+	}
+
+	if err != nil {
+		return rows, &model.Error{
+			Code: model.CodeValidation,
+			Message: "Could not read " + string(format) + " file",
+			Details: map[string]interface{}{"reason": err.Error(), "row": len(rows) + 1},
+			Err: err,
+		}
+	}
+
+	return rows, nil
+}
+
+func readCSV(reader io.Reader) ([]plannedRow, error) {
+	var rows []plannedRow
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return rows, fmt.Errorf("could not read header: %w", err)
+	}
+	columns := map[string]int{}
+	for index, column := range header {
+		columns[strings.TrimSpace(column)] = index
+	}
+	if _, found := columns["name"]; !found {
+		return rows, errors.New("header has no name column")
+	}
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+
+		field := func(column string) string {
+			index, found := columns[column]
+			if !found || index >= len(record) {
+				return ""
+			}
+			return record[index]
+		}
+
+		row := plannedRow{row: len(rows) + 1}
+		fields := importedRow{
+			Name: field("name"),
+			Climate: field("climate"),
+			Terrain: field("terrain"),
+			SwapiStatus: field("swapiStatus"),
+			SwapiMatchConfidence: field("swapiMatchConfidence"),
+		}
+		if appearencesCount := field("appearencesCount"); appearencesCount != "" {
+			fields.AppearencesCount, err = strconv.Atoi(appearencesCount)
+			if err != nil {
+				row.err = invalidRow("appearencesCount must be an integer", err)
+			}
+		}
+		row.planet = fields.toPlanet()
+
+		rows = append(rows, row)
+	}
+}
+
+func readNDJSON(reader io.Reader) ([]plannedRow, error) {
+	var rows []plannedRow
+
+	lineReader := bufio.NewReader(reader)
+	for {
+		line, err := lineReader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return rows, err
+		}
+
+		if trimmedLine := bytes.TrimSpace(line); len(trimmedLine) > 0 {
+			var fields importedRow
+			row := plannedRow{row: len(rows) + 1}
+			if decodeErr := json.Unmarshal(trimmedLine, &fields); decodeErr != nil {
+				row.err = invalidRow("Row is not a valid planet", decodeErr)
+			}
+			row.planet = fields.toPlanet()
+			rows = append(rows, row)
+		}
+
+		if err == io.EOF {
+			return rows, nil
+		}
+	}
+}
+
+func readJSONArray(reader io.Reader) ([]plannedRow, error) {
+	var rows []plannedRow
+
+	decoder := json.NewDecoder(reader)
+	token, err := decoder.Token()
+	if err != nil {
+		return rows, err
+	}
+	if delimiter, isDelimiter := token.(json.Delim); !isDelimiter || delimiter != '[' {
+		return rows, errors.New("expected an array of planets")
+	}
+
+	for decoder.More() {
+		var fields importedRow
+		row := plannedRow{row: len(rows) + 1}
+
+		if err = decoder.Decode(&fields); err != nil {
+			var typeError *json.UnmarshalTypeError
+			if !errors.As(err, &typeError) {
+				return rows, err
+			}
+			// The decoder skips mistyped values, so the next rows can still be read
+			row.err = invalidRow("Row is not a valid planet", err)
+		}
+		row.planet = fields.toPlanet()
+		rows = append(rows, row)
+	}
+
+	_, err = decoder.Token()
+	return rows, err
+}
@@ -0,0 +1,56 @@
+package transfer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/HosanaUFRRJ2014/planets-api/model"
+)
+
+
+func TestKeepSWAPIFields(t *testing.T) {
+	syncedAt := time.Date(2020, 5, 4, 12, 0, 0, 0, time.UTC)
+	importedAt := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	storedPlanet := model.Planet{
+		Name: "Tatooine", Climate: "arid",
+		PlanetSwapiURL: "https://swapi.dev/api/planets/1/", AppearencesCount: 5, SwapiStatus: "resolved",
+		LastSyncedAt: &syncedAt, SyncStatus: model.SyncUnchanged,
+	}
+
+	tests := []struct {
+		name string
+		imported model.Planet
+		want model.Planet
+	}{
+		{
+			"row without SWAPI fields",
+			model.Planet{Name: "Tatooine", Climate: "temperate"},
+			model.Planet{
+				Name: "Tatooine", Climate: "temperate",
+				PlanetSwapiURL: "https://swapi.dev/api/planets/1/", AppearencesCount: 5, SwapiStatus: "resolved",
+				LastSyncedAt: &syncedAt, SyncStatus: model.SyncUnchanged,
+			},
+		},
+		{
+			"row with SWAPI fields and sync fields",
+			model.Planet{
+				Name: "Tatooine", AppearencesCount: 2, SwapiStatus: "not_found",
+				LastSyncedAt: &importedAt, SyncStatus: model.SyncFailed,
+			},
+			model.Planet{
+				Name: "Tatooine", AppearencesCount: 2, SwapiStatus: "not_found",
+				PlanetSwapiURL: "https://swapi.dev/api/planets/1/",
+				LastSyncedAt: &syncedAt, SyncStatus: model.SyncUnchanged,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := keepSWAPIFields(test.imported, storedPlanet); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("keepSWAPIFields() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}